@@ -0,0 +1,152 @@
+package libunifiedcore
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// builtinOutboundProtocols are Xray outbounds that do not proxy anywhere and
+// are always allowed.
+var builtinOutboundProtocols = map[string]bool{
+	"freedom":   true,
+	"blackhole": true,
+	"dns":       true,
+	"loopback":  true,
+}
+
+// SetAllowedProtocols restricts the proxy protocols a config may use.
+// Entries are protocol names ("vless", "shadowsocks", "hysteria2"), optionally
+// qualified by transport security as "protocol+security" ("vless+reality",
+// "trojan+tls", "vmess+none"); a bare name allows any security. Mihomo's
+// "ss" is treated as "shadowsocks". Xray's freedom, blackhole, dns and
+// loopback outbounds are always allowed. RunConfig, ApplyConfig,
+// SoftRestart and TestConfig reject configs with other protocols, and
+// MihomoCoreManager.AddProxy rejects such proxies. While a list is set,
+// Mihomo configs may only use inline proxy-providers, whose proxies are
+// checked too; other providers load proxies at runtime and are rejected.
+// An empty list removes the restriction.
+func (u *UnifiedCoreManager) SetAllowedProtocols(protocols []string) error {
+	allowed := make(map[string]bool, len(protocols))
+	for _, p := range protocols {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" || strings.Count(p, "+") > 1 || strings.HasPrefix(p, "+") || strings.HasSuffix(p, "+") {
+			return fmt.Errorf("invalid protocol entry %q", p)
+		}
+		allowed[p] = true
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if len(allowed) == 0 {
+		allowed = nil
+	}
+	u.allowedProtocols = allowed
+	if u.mihomoManager != nil {
+		u.mihomoManager.setAllowedProtocols(allowed)
+	}
+	if allowed == nil {
+		log.Println("Protocol allowlist removed")
+		return nil
+	}
+	log.Printf("Protocol allowlist set: %v", protocols)
+	return nil
+}
+
+// checkAllowedProtocolsLocked returns an error naming the first proxy whose
+// protocol is not allowed. Callers must hold u.mu (read or write).
+func (u *UnifiedCoreManager) checkAllowedProtocolsLocked(coreType CoreType, config map[string]interface{}) error {
+	return checkAllowedProtocols(u.allowedProtocols, coreType, unwrapCoreConfig(config))
+}
+
+// checkAllowedProtocols checks the proxies of a config against an
+// allowlist; a nil allowlist allows everything.
+func checkAllowedProtocols(allowed map[string]bool, coreType CoreType, config map[string]interface{}) error {
+	if allowed == nil {
+		return nil
+	}
+
+	proxies := configProxyProtocols(coreType, config)
+	if coreType == CoreTypeMihomo {
+		providerProxies, err := inlineProviderProxies(config)
+		if err != nil {
+			return err
+		}
+		proxies = append(proxies, providerProxies...)
+	}
+	for _, proxy := range proxies {
+		if allowed[proxy.protocol] || allowed[proxy.protocol+"+"+proxy.security] {
+			continue
+		}
+		return fmt.Errorf("proxy %q uses %s with %s security, which is not in the allowed protocols", proxy.name, proxy.protocol, proxy.security)
+	}
+	return nil
+}
+
+// inlineProviderProxies lists the proxies of the inline proxy-providers of
+// a Mihomo config. Other providers fetch or read their proxies at runtime,
+// so they cannot be checked and are reported as an error.
+func inlineProviderProxies(config map[string]interface{}) ([]proxyProtocol, error) {
+	providers, _ := config["proxy-providers"].(map[string]interface{})
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var proxies []proxyProtocol
+	for _, name := range names {
+		provider, _ := providers[name].(map[string]interface{})
+		if providerType, _ := provider["type"].(string); providerType != "inline" {
+			return nil, fmt.Errorf("proxy provider %q loads its proxies at runtime, which cannot be checked against the allowed protocols", name)
+		}
+		payload := map[string]interface{}{"proxies": provider["payload"]}
+		proxies = append(proxies, configProxyProtocols(CoreTypeMihomo, payload)...)
+	}
+	return proxies, nil
+}
+
+type proxyProtocol struct {
+	name     string
+	protocol string
+	security string
+}
+
+// configProxyProtocols lists the protocol and transport security of every
+// proxy in a config, sorted by name.
+func configProxyProtocols(coreType CoreType, config map[string]interface{}) []proxyProtocol {
+	var proxies []proxyProtocol
+	switch coreType {
+	case CoreTypeV2Ray, CoreTypeXray:
+		for _, outbound := range xrayOutbounds(config) {
+			protocol, _ := outbound["protocol"].(string)
+			if builtinOutboundProtocols[protocol] {
+				continue
+			}
+			stream, _ := outbound["streamSettings"].(map[string]interface{})
+			security := firstNonEmpty(stringValue(stream["security"]), "none")
+			tag, _ := outbound["tag"].(string)
+			proxies = append(proxies, proxyProtocol{tag, strings.ToLower(protocol), security})
+		}
+	case CoreTypeMihomo:
+		for _, proxy := range mihomoProxies(config) {
+			protocol, _ := proxy["type"].(string)
+			protocol = strings.ToLower(protocol)
+			if protocol == "ss" {
+				protocol = "shadowsocks"
+			}
+			security := "none"
+			if _, reality := proxy["reality-opts"]; reality {
+				security = "reality"
+			} else if tls, _ := proxy["tls"].(bool); tls || protocol == "trojan" {
+				security = "tls"
+			}
+			name, _ := proxy["name"].(string)
+			proxies = append(proxies, proxyProtocol{name, protocol, security})
+		}
+	}
+	sort.SliceStable(proxies, func(i, j int) bool { return proxies[i].name < proxies[j].name })
+	return proxies
+}
@@ -0,0 +1,127 @@
+package libunifiedcore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// defaultIPEchoURL returns the caller's public IP as plain text.
+const defaultIPEchoURL = "https://api.ipify.org"
+
+// ErrNotTunneled is returned by GetApparentIP when the IP seen through the
+// proxy is the same as the device's own public IP.
+var ErrNotTunneled = errors.New("request did not go through the tunnel")
+
+// SetProbeURLs overrides the URLs used for connectivity probes
+// (ValidateConnectivity) and for IP echo (GetApparentIP). The IP echo
+// service must answer with the bare IP address as its body. An empty string
+// restores the default.
+func (u *UnifiedCoreManager) SetProbeURLs(connectivityURL, ipEchoURL string) error {
+	for _, raw := range []string{connectivityURL, ipEchoURL} {
+		if raw == "" {
+			continue
+		}
+		parsed, err := url.Parse(raw)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("invalid probe URL: %s", raw)
+		}
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.probeURL = connectivityURL
+	u.ipEchoURL = ipEchoURL
+	log.Printf("Probe URLs set - connectivity: %q, IP echo: %q", connectivityURL, ipEchoURL)
+	return nil
+}
+
+// connectivityProbeURL returns the URL ValidateConnectivity probes.
+func (u *UnifiedCoreManager) connectivityProbeURL() string {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.connectivityProbeURLLocked()
+}
+
+// connectivityProbeURLLocked is connectivityProbeURL for callers holding u.mu.
+func (u *UnifiedCoreManager) connectivityProbeURLLocked() string {
+	if u.probeURL != "" {
+		return u.probeURL
+	}
+	return defaultProbeURL
+}
+
+// GetApparentIP asks the IP echo service, through the running core's SOCKS
+// port, which public IP it sees. The same request is also made directly; if
+// both report the same IP, the IP is returned together with ErrNotTunneled.
+// In TUN mode the direct request is routed through the tunnel too, so the
+// comparison can only catch leaks when the core runs as a plain proxy.
+func (u *UnifiedCoreManager) GetApparentIP(timeout time.Duration) (string, error) {
+	if timeout <= 0 {
+		return "", fmt.Errorf("invalid timeout: %v", timeout)
+	}
+	proxied, err := u.ProxyHTTPClientWithTimeout(timeout)
+	if err != nil {
+		return "", err
+	}
+
+	u.mu.RLock()
+	echoURL := u.ipEchoURL
+	u.mu.RUnlock()
+	if echoURL == "" {
+		echoURL = defaultIPEchoURL
+	}
+
+	type result struct {
+		ip  string
+		err error
+	}
+	direct := make(chan result, 1)
+	go func() {
+		ip, err := fetchIP(&http.Client{Timeout: timeout}, echoURL)
+		direct <- result{ip, err}
+	}()
+
+	ip, err := fetchIP(proxied, echoURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to query IP through proxy: %w", err)
+	}
+
+	own := <-direct
+	if own.err != nil {
+		log.Printf("Could not query own IP, skipping leak check: %v", own.err)
+		return ip, nil
+	}
+	if own.ip == ip {
+		return ip, fmt.Errorf("%w: apparent IP %s is the device's own IP", ErrNotTunneled, ip)
+	}
+	return ip, nil
+}
+
+// fetchIP reads an IP address from an IP echo service.
+func fetchIP(client *http.Client, echoURL string) (string, error) {
+	resp, err := client.Get(echoURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return "", err
+	}
+	ip := strings.TrimSpace(string(body))
+	if net.ParseIP(ip) == nil {
+		return "", fmt.Errorf("IP echo service returned %q, not an IP address", ip)
+	}
+	return ip, nil
+}
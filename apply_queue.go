@@ -0,0 +1,57 @@
+package libunifiedcore
+
+import "sync"
+
+// applyQueue serializes restarts and config applies. While one runs, later
+// requests collapse into a single pending one: each new request replaces the
+// pending operation, and everyone who asked in the meantime gets the result
+// of the operation that finally runs.
+type applyQueue struct {
+	mu      sync.Mutex
+	active  bool
+	pending *applyBatch
+}
+
+type applyBatch struct {
+	op      func() error
+	waiters []chan error
+}
+
+// submit queues op and waits for the result of the operation that ends up
+// running in its place.
+func (q *applyQueue) submit(op func() error) error {
+	done := make(chan error, 1)
+
+	q.mu.Lock()
+	if q.pending == nil {
+		q.pending = &applyBatch{}
+	}
+	q.pending.op = op
+	q.pending.waiters = append(q.pending.waiters, done)
+	if !q.active {
+		q.active = true
+		go q.drain()
+	}
+	q.mu.Unlock()
+
+	return <-done
+}
+
+func (q *applyQueue) drain() {
+	for {
+		q.mu.Lock()
+		batch := q.pending
+		q.pending = nil
+		if batch == nil {
+			q.active = false
+			q.mu.Unlock()
+			return
+		}
+		q.mu.Unlock()
+
+		err := batch.op()
+		for _, done := range batch.waiters {
+			done <- err
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package libunifiedcore
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestApplyQueueCollapsesToLatest(t *testing.T) {
+	var q applyQueue
+	var running, maxRunning atomic.Int32
+	var ran []int
+	var ranMu sync.Mutex
+
+	op := func(id int, wait <-chan struct{}) func() error {
+		return func() error {
+			if n := running.Add(1); n > maxRunning.Load() {
+				maxRunning.Store(n)
+			}
+			defer running.Add(-1)
+			if wait != nil {
+				<-wait
+			}
+			ranMu.Lock()
+			ran = append(ran, id)
+			ranMu.Unlock()
+			return fmt.Errorf("result of %d", id)
+		}
+	}
+	pendingWaiters := func() int {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if q.pending == nil {
+			return 0
+		}
+		return len(q.pending.waiters)
+	}
+
+	release := make(chan struct{})
+	first := make(chan error, 1)
+	go func() { first <- q.submit(op(0, release)) }()
+	if !waitFor(5*time.Second, func() bool { return running.Load() == 1 }) {
+		t.Fatal("first operation did not start")
+	}
+
+	// Queue 19 more in a known order while the first one runs
+	results := make([]chan error, 20)
+	for id := 1; id < 20; id++ {
+		results[id] = make(chan error, 1)
+		go func(id int) { results[id] <- q.submit(op(id, nil)) }(id)
+		if !waitFor(5*time.Second, func() bool { return pendingWaiters() == id }) {
+			t.Fatalf("request %d was not queued", id)
+		}
+	}
+	close(release)
+
+	if err := <-first; err == nil || err.Error() != "result of 0" {
+		t.Errorf("first request got %v, want its own result", err)
+	}
+	for id := 1; id < 20; id++ {
+		if err := <-results[id]; err == nil || err.Error() != "result of 19" {
+			t.Errorf("request %d got %v, want the result of the latest request", id, err)
+		}
+	}
+	if fmt.Sprint(ran) != "[0 19]" {
+		t.Errorf("ran %v, want [0 19]", ran)
+	}
+	if maxRunning.Load() != 1 {
+		t.Errorf("%d operations ran at once", maxRunning.Load())
+	}
+}
+
+func TestConcurrentApplyConfig(t *testing.T) {
+	dir := t.TempDir()
+	ports := make(map[string]int, 20)
+	paths := make([]string, 20)
+	for i := range paths {
+		port := freePort(t)
+		paths[i] = writeXrayConfig(t, dir, fmt.Sprintf("config-%d.json", i), port)
+		ports[paths[i]] = port
+	}
+
+	u := NewUnifiedCoreManager()
+	t.Cleanup(func() { u.Stop() })
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(paths))
+	for i, path := range paths {
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+			errs[i] = u.ApplyConfig(path)
+		}(i, path)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("ApplyConfig(%s): %v", paths[i], err)
+		}
+	}
+
+	u.mu.RLock()
+	applied, socksPort, running := u.configPath, u.socksPort, u.running
+	u.mu.RUnlock()
+	if !running {
+		t.Fatal("no core running after the applies")
+	}
+	want, ok := ports[applied]
+	if !ok {
+		t.Fatalf("running config %q is none of the applied ones", applied)
+	}
+	if socksPort != want {
+		t.Errorf("SOCKS port %d, want %d from %s", socksPort, want, applied)
+	}
+
+	// Only the applied config's core may be left listening
+	for path, port := range ports {
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), time.Second)
+		if err == nil {
+			conn.Close()
+		}
+		if listening := err == nil; listening != (path == applied) {
+			t.Errorf("port %d of %s listening = %v", port, path, listening)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package libunifiedcore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"unsafe"
+
+	"github.com/metacubex/mihomo/listener"
+	core "github.com/xtls/xray-core/core"
+	"github.com/xtls/xray-core/features/inbound"
+)
+
+// GetBoundSOCKSPort returns the SOCKS/mixed port the running core actually
+// listens on, which can differ from GetSOCKSPort when the config was edited
+// or Mihomo picked the port.
+//
+// Mihomo: read from the live listeners. Xray: the port the listener of the
+// first socks/mixed/http inbound of the started config is bound to, which
+// resolves inbounds on port 0, or the port SoftRestart holds for it.
+func (u *UnifiedCoreManager) GetBoundSOCKSPort() (int, error) {
+	u.mu.RLock()
+	running := u.running
+	coreType := u.coreType
+	v2rayManager := u.v2rayManager
+	front := u.socksFront
+	u.mu.RUnlock()
+
+	if !running {
+		return 0, fmt.Errorf("no core running")
+	}
+
+	switch coreType {
+	case CoreTypeV2Ray, CoreTypeXray:
+		if front != nil {
+			return front.port(), nil
+		}
+		if v2rayManager == nil {
+			return 0, fmt.Errorf("V2Ray core is not running")
+		}
+		return v2rayManager.boundSOCKSPort()
+	case CoreTypeMihomo:
+		ports := listener.GetPorts()
+		for _, port := range []int{ports.MixedPort, ports.SocksPort, ports.Port} {
+			if port != 0 {
+				return port, nil
+			}
+		}
+		return 0, fmt.Errorf("mihomo has no mixed/SOCKS/HTTP listener")
+	default:
+		return 0, fmt.Errorf("unsupported core type: %v", coreType)
+	}
+}
+
+func (v *V2RayCoreManager) boundSOCKSPort() (int, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if v.instance == nil {
+		return 0, fmt.Errorf("V2Ray core is not running")
+	}
+	if !v.socksInbound.found {
+		return 0, fmt.Errorf("no SOCKS/mixed/HTTP inbound in V2Ray config")
+	}
+	if handler := findXrayInbound(v.instance, v.socksInbound); handler != nil {
+		if ports := xrayListenerPorts(handler); len(ports) > 0 {
+			return ports[0], nil
+		}
+	}
+	if v.socksInbound.port == 0 {
+		return 0, fmt.Errorf("could not read the port of the SOCKS inbound listener")
+	}
+	return v.socksInbound.port, nil
+}
+
+// xrayInboundRef identifies an inbound of the started config.
+type xrayInboundRef struct {
+	found    bool
+	tag      string
+	protocol string
+	port     int // as configured; 0 for an ephemeral port
+}
+
+// xraySOCKSInbound returns the first socks inbound, falling back to
+// mixed/http. The port is 0 if it is not a number.
+func xraySOCKSInbound(configBytes []byte) xrayInboundRef {
+	var config struct {
+		Inbounds []struct {
+			Tag      string      `json:"tag"`
+			Protocol string      `json:"protocol"`
+			Port     interface{} `json:"port"`
+		} `json:"inbounds"`
+	}
+	if err := json.Unmarshal(configBytes, &config); err != nil {
+		return xrayInboundRef{}
+	}
+
+	for _, protocols := range [][]string{{"socks"}, {"mixed", "http"}} {
+		for _, in := range config.Inbounds {
+			for _, protocol := range protocols {
+				if in.Protocol == protocol {
+					return xrayInboundRef{found: true, tag: in.Tag, protocol: protocol, port: configPort(in.Port)}
+				}
+			}
+		}
+	}
+	return xrayInboundRef{}
+}
+
+// findXrayInbound returns the running handler of ref. Untagged inbounds are
+// matched by protocol and configured port.
+func findXrayInbound(instance *core.Instance, ref xrayInboundRef) inbound.Handler {
+	manager, ok := instance.GetFeature(inbound.ManagerType()).(inbound.Manager)
+	if !ok {
+		return nil
+	}
+	if ref.tag != "" {
+		handler, err := manager.GetHandler(context.Background(), ref.tag)
+		if err != nil {
+			return nil
+		}
+		return handler
+	}
+
+	// mixed inbounds are built as socks servers
+	settingsType := "xray.proxy.socks.ServerConfig"
+	if ref.protocol == "http" {
+		settingsType = "xray.proxy.http.ServerConfig"
+	}
+	for _, handler := range manager.ListHandlers(context.Background()) {
+		if handler.Tag() != "" || handler.ProxySettings() == nil || handler.ProxySettings().Type != settingsType {
+			continue
+		}
+		if _, port, _ := handler.GetRandomInboundProxy(); int(port) == ref.port {
+			return handler
+		}
+	}
+	return nil
+}
+
+// xrayListenerPorts returns the TCP ports the listeners of an inbound
+// handler are bound to. Xray does not expose its listeners, so they are
+// read from the handler's workers; an empty result means the layout was
+// not recognized.
+func xrayListenerPorts(handler inbound.Handler) []int {
+	h := reflect.ValueOf(handler)
+	if h.Kind() != reflect.Ptr || h.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	workers := h.Elem().FieldByName("workers")
+	if workers.Kind() != reflect.Slice {
+		return nil
+	}
+
+	var ports []int
+	for i := 0; i < workers.Len(); i++ {
+		w := workers.Index(i).Elem()
+		if w.Kind() != reflect.Ptr || w.Elem().Kind() != reflect.Struct {
+			continue
+		}
+		hub := w.Elem().FieldByName("hub")
+		if !hub.IsValid() || !hub.CanAddr() {
+			continue
+		}
+		value := reflect.NewAt(hub.Type(), unsafe.Pointer(hub.UnsafeAddr())).Elem()
+		if (value.Kind() == reflect.Interface || value.Kind() == reflect.Ptr) && value.IsNil() {
+			continue
+		}
+		listener, ok := value.Interface().(interface{ Addr() net.Addr })
+		if !ok {
+			continue
+		}
+		if addr, ok := listener.Addr().(*net.TCPAddr); ok && addr.Port != 0 {
+			ports = append(ports, addr.Port)
+		}
+	}
+	return ports
+}
@@ -0,0 +1,197 @@
+package libunifiedcore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/metacubex/mihomo/adapter"
+)
+
+// bulkPingWorkers bounds concurrent probes in BulkPing.
+const bulkPingWorkers = 8
+
+// bulkOps tracks the running bulk operations, such as TestConfigs and
+// BulkPing, so they can be cancelled together.
+var bulkOps = struct {
+	sync.Mutex
+	next    int
+	cancels map[int]context.CancelFunc
+}{cancels: make(map[int]context.CancelFunc)}
+
+// startBulkOperation registers a bulk operation and returns its context,
+// cancelled by parent or CancelBulkOperations, and the func that must be
+// called when the operation is done.
+func startBulkOperation(parent context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(parent)
+
+	bulkOps.Lock()
+	id := bulkOps.next
+	bulkOps.next++
+	bulkOps.cancels[id] = cancel
+	bulkOps.Unlock()
+
+	return ctx, func() {
+		bulkOps.Lock()
+		delete(bulkOps.cancels, id)
+		bulkOps.Unlock()
+		cancel()
+	}
+}
+
+// GetBulkOperationCount returns how many bulk operations are running.
+func GetBulkOperationCount() int {
+	bulkOps.Lock()
+	defer bulkOps.Unlock()
+	return len(bulkOps.cancels)
+}
+
+// CancelBulkOperations cancels every running bulk operation and returns how
+// many there were. Running pings are aborted and their ephemeral cores
+// closed; configs TestConfigs is already validating finish first. The rest
+// are reported with context.Canceled.
+func CancelBulkOperations() int {
+	bulkOps.Lock()
+	defer bulkOps.Unlock()
+
+	n := len(bulkOps.cancels)
+	for _, cancel := range bulkOps.cancels {
+		cancel()
+	}
+	if n > 0 {
+		log.Printf("Cancelled %d bulk operations", n)
+	}
+	return n
+}
+
+// BulkPing probes the main server of every config through an ephemeral core
+// and returns the result per path: the first proxy outbound (Xray) or the
+// first proxy (Mihomo), like CompareCores. The probes open no listening
+// ports and run concurrently, each bounded by timeout.
+func BulkPing(paths []string, testURL string, timeout time.Duration) map[string]CoreProbeResult {
+	return BulkPingContext(context.Background(), paths, testURL, timeout)
+}
+
+// BulkPingContext is BulkPing with a context. Once ctx is done, or
+// CancelBulkOperations is called, running probes are aborted and their
+// ephemeral cores closed, and the remaining paths report the context's
+// error.
+func BulkPingContext(ctx context.Context, paths []string, testURL string, timeout time.Duration) map[string]CoreProbeResult {
+	ctx, done := startBulkOperation(ctx)
+	defer done()
+
+	results := make(map[string]CoreProbeResult, len(paths))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	jobs := make(chan string)
+	for i := 0; i < bulkPingWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				result := coreProbeResult(pingConfigFile(ctx, path, testURL, timeout))
+				mu.Lock()
+				results[path] = result
+				mu.Unlock()
+			}
+		}()
+	}
+
+	seen := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		select {
+		case jobs <- path:
+		case <-ctx.Done():
+			mu.Lock()
+			results[path] = coreProbeResult(0, ctx.Err())
+			mu.Unlock()
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	log.Printf("Pinged %d configs", len(seen))
+	return results
+}
+
+// pingConfigFile probes the main server of the config at path. An empty
+// testURL means defaultProbeURL.
+func pingConfigFile(ctx context.Context, path, testURL string, timeout time.Duration) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if testURL == "" {
+		testURL = defaultProbeURL
+	}
+	configBytes, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(configBytes, &config); err != nil {
+		return 0, fmt.Errorf("failed to parse config JSON: %w", err)
+	}
+	coreTypeStr, _ := config["coreType"].(string)
+	coreType, err := ParseCoreType(coreTypeStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid coreType in config: %s - %w", coreTypeStr, err)
+	}
+	config = unwrapCoreConfig(config)
+
+	switch coreType {
+	case CoreTypeV2Ray, CoreTypeXray:
+		for _, outbound := range xrayOutbounds(config) {
+			if protocol, _ := outbound["protocol"].(string); builtinOutboundProtocols[protocol] {
+				continue
+			}
+			tag, _ := outbound["tag"].(string)
+			if tag == "" {
+				tag = "ping"
+				outbound["tag"] = tag
+			}
+			innerBytes, err := json.Marshal(config)
+			if err != nil {
+				return 0, fmt.Errorf("failed to marshal config: %w", err)
+			}
+			return TestOutboundContext(ctx, innerBytes, tag, testURL, timeout)
+		}
+		return 0, fmt.Errorf("no proxy outbound to ping")
+	case CoreTypeMihomo:
+		proxies := mihomoProxies(config)
+		if len(proxies) == 0 {
+			return 0, fmt.Errorf("no proxies to ping")
+		}
+		name, _ := proxies[0]["name"].(string)
+		cacheKey := pingCacheKeyBytes(configBytes, name, testURL)
+		if latency, cached := pingCache.latency(cacheKey); cached {
+			log.Printf("Proxy %s latency served from ping cache: %dms", name, latency)
+			return latency, nil
+		}
+
+		proxy, err := adapter.ParseProxy(proxies[0])
+		if err != nil {
+			return 0, fmt.Errorf("invalid Mihomo proxy: %w", err)
+		}
+		defer proxy.Close()
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		delay, err := proxy.URLTest(ctx, testURL, nil)
+		if err != nil {
+			return 0, err
+		}
+		pingCache.put(cacheKey, int(delay))
+		return int(delay), nil
+	default:
+		return 0, fmt.Errorf("unsupported core type: %v", coreType)
+	}
+}
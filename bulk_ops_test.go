@@ -0,0 +1,195 @@
+package libunifiedcore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stallServer accepts connections and never answers, counting the ones
+// still open.
+type stallServer struct {
+	listener net.Listener
+	accepted atomic.Int64
+	open     atomic.Int64
+}
+
+func newStallServer(t *testing.T) *stallServer {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &stallServer{listener: l}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.accepted.Add(1)
+			s.open.Add(1)
+			go func() {
+				io.Copy(io.Discard, conn)
+				conn.Close()
+				s.open.Add(-1)
+			}()
+		}
+	}()
+	t.Cleanup(func() { l.Close() })
+	return s
+}
+
+func (s *stallServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func writeStallConfigs(t *testing.T, port, n int) []string {
+	t.Helper()
+
+	dir := t.TempDir()
+	paths := make([]string, n)
+	for i := range paths {
+		config := map[string]interface{}{
+			"coreType": "xray",
+			"outbounds": []interface{}{
+				map[string]interface{}{
+					"tag":      "proxy",
+					"protocol": "shadowsocks",
+					"settings": map[string]interface{}{
+						"servers": []interface{}{
+							map[string]interface{}{
+								"address":  "127.0.0.1",
+								"port":     port,
+								"method":   "aes-128-gcm",
+								"password": fmt.Sprintf("password-%d", i),
+							},
+						},
+					},
+				},
+			},
+		}
+		data, err := json.Marshal(config)
+		if err != nil {
+			t.Fatalf("marshal config: %v", err)
+		}
+		paths[i] = filepath.Join(dir, fmt.Sprintf("config-%d.json", i))
+		if err := os.WriteFile(paths[i], data, 0o600); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+	}
+	return paths
+}
+
+func waitFor(timeout time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return true
+}
+
+func TestBulkPingCancelLeavesNothingOpen(t *testing.T) {
+	server := newStallServer(t)
+	testBulkPingCancel(t, server, writeStallConfigs(t, server.port(), 100))
+}
+
+func TestBulkPingCancelLeavesNothingOpenMihomo(t *testing.T) {
+	server := newStallServer(t)
+	testBulkPingCancel(t, server, writeMihomoConfigs(t, t.TempDir(), server.port(), 100))
+}
+
+// testBulkPingCancel cancels a BulkPing of paths, whose servers all point at
+// server, while the probes hang, and checks that no connection or goroutine
+// outlives it.
+func testBulkPingCancel(t *testing.T, server *stallServer, paths []string) {
+	t.Helper()
+	const testURL = "http://example.com/"
+
+	// One probe up front, so state Xray sets up once is not counted as leaked
+	warmup := coreProbeResult(pingConfigFile(context.Background(), paths[0], testURL, 200*time.Millisecond))
+	if warmup.Success {
+		t.Fatal("probe through the stalled server succeeded")
+	}
+	if !waitFor(5*time.Second, func() bool { return server.open.Load() == 0 }) {
+		t.Fatalf("warm-up probe left %d connections open", server.open.Load())
+	}
+	baseline := runtime.NumGoroutine()
+
+	results := make(chan map[string]CoreProbeResult, 1)
+	go func() {
+		results <- BulkPingContext(context.Background(), paths, testURL, time.Minute)
+	}()
+
+	if !waitFor(10*time.Second, func() bool { return server.accepted.Load() > bulkPingWorkers }) {
+		t.Fatalf("probes did not reach the server, %d connections", server.accepted.Load())
+	}
+	if n := CancelBulkOperations(); n != 1 {
+		t.Errorf("CancelBulkOperations() = %d, want 1", n)
+	}
+
+	var got map[string]CoreProbeResult
+	select {
+	case got = <-results:
+	case <-time.After(10 * time.Second):
+		t.Fatal("BulkPing did not return after cancel")
+	}
+
+	if len(got) != len(paths) {
+		t.Errorf("got %d results, want %d", len(got), len(paths))
+	}
+	for path, result := range got {
+		if result.Success || result.Error == "" {
+			t.Errorf("%s: got %+v, want an error", path, result)
+		}
+	}
+	if accepted := server.accepted.Load(); accepted >= int64(len(paths))+1 {
+		t.Errorf("all %d configs were probed despite the cancel", accepted-1)
+	}
+	if n := GetBulkOperationCount(); n != 0 {
+		t.Errorf("GetBulkOperationCount() = %d after the run, want 0", n)
+	}
+
+	if !waitFor(10*time.Second, func() bool { return server.open.Load() == 0 }) {
+		t.Errorf("%d probe connections left open after cancel", server.open.Load())
+	}
+	if !waitFor(10*time.Second, func() bool { return runtime.NumGoroutine() <= baseline }) {
+		t.Errorf("goroutines leaked: %d running, %d before the run", runtime.NumGoroutine(), baseline)
+	}
+}
+
+func TestBulkPingServesMihomoFromPingCache(t *testing.T) {
+	if err := SetPingCacheTTL(time.Minute); err != nil {
+		t.Fatalf("SetPingCacheTTL: %v", err)
+	}
+	t.Cleanup(func() { SetPingCacheTTL(0) })
+
+	server := newStallServer(t)
+	paths := writeMihomoConfigs(t, t.TempDir(), server.port(), 1)
+	configBytes, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	const testURL = "http://example.com/"
+	pingCache.put(pingCacheKeyBytes(configBytes, "proxy", testURL), 42)
+
+	result := BulkPing(paths, testURL, time.Second)[paths[0]]
+	if !result.Success || result.LatencyMs != 42 {
+		t.Errorf("got %+v, want the cached 42ms", result)
+	}
+	if n := server.accepted.Load(); n != 0 {
+		t.Errorf("cached config was probed, %d connections", n)
+	}
+}
@@ -46,6 +46,8 @@ func main() {
 	// Create temporary config file
 	configPath := createTestConfig()
 	defer os.Remove(configPath)
+	// Remove temp dirs left behind when a step fails before shutdown
+	defer libunifiedcore.CleanupTempDirs()
 
 	// Test configuration validation
 	fmt.Println("\n1. Testing configuration validation...")
@@ -120,13 +122,14 @@ func testManagerCreation() *libunifiedcore.MihomoCoreManager {
 	manager := libunifiedcore.NewMihomoCoreManager(15491, 15490)
 	manager.SetLogLevel("info")
 
-	// Set up temporary directory
-	tempDir, err := os.MkdirTemp("", "mihomo-test-*")
+	// Set up temporary directory, removed when the manager stops
+	tempDir, err := libunifiedcore.CreateTempDir("mihomo-test-*")
 	if err != nil {
 		panic(fmt.Sprintf("Failed to create temp dir: %v", err))
 	}
 
 	manager.SetAssetPath(tempDir)
+	manager.RegisterTempDir(tempDir)
 
 	return manager
 }
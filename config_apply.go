@@ -0,0 +1,176 @@
+package libunifiedcore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Actions reported by GetLastApplyAction.
+const (
+	ApplyActionStarted   = "started"   // no core was running, config started
+	ApplyActionUnchanged = "unchanged" // identical to the running config
+	ApplyActionReloaded  = "reloaded"  // hot-reloaded into the running core
+	ApplyActionRestarted = "restarted" // core restarted with the new config
+)
+
+// mihomoRestartKeys are the Mihomo config sections that change listeners the
+// unified manager tracks, so a change to them needs a full restart.
+var mihomoRestartKeys = map[string]bool{
+	"port":                true,
+	"socks-port":          true,
+	"mixed-port":          true,
+	"redir-port":          true,
+	"tproxy-port":         true,
+	"external-controller": true,
+	"listeners":           true,
+	"tun":                 true,
+}
+
+// ApplyConfig is the single entry point for config pushes. It returns
+// immediately when the config is identical to the running one, hot-reloads
+// Mihomo when only reloadable sections changed, and restarts the core when
+// the core type, ports or inbounds changed. Xray cannot reload in place, so
+// any Xray change restarts. The path taken is available from
+// GetLastApplyAction.
+//
+// Overlapping ApplyConfig and Restart calls are serialized; requests made
+// while one is in progress collapse into the latest, and all of their callers
+// get its result.
+func (u *UnifiedCoreManager) ApplyConfig(configPath string) error {
+	return u.applies.submit(func() error {
+		return u.applyConfig(configPath)
+	})
+}
+
+func (u *UnifiedCoreManager) applyConfig(configPath string) error {
+	absPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve config path: %w", err)
+	}
+	retries, delay := u.configReadPolicy()
+	configBytes, err := readConfigFile(absPath, retries, delay)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	var newConfig map[string]interface{}
+	if err := json.Unmarshal(configBytes, &newConfig); err != nil {
+		return fmt.Errorf("failed to parse injected config as JSON: %w", err)
+	}
+
+	u.mu.RLock()
+	running := u.running
+	coreType := u.coreType
+	lastChecksum := u.lastConfigChecksum
+	lastConfig := u.lastConfig
+	u.mu.RUnlock()
+
+	if !running {
+		return u.applyByRestart(absPath, ApplyActionStarted)
+	}
+	if configChecksum(configBytes) == lastChecksum {
+		u.setLastApplyAction(ApplyActionUnchanged)
+		log.Printf("Config unchanged, nothing to apply: %s", absPath)
+		return nil
+	}
+
+	coreTypeStr, _ := newConfig["coreType"].(string)
+	newCoreType, err := ParseCoreType(coreTypeStr)
+	if err != nil {
+		return u.applyByRestart(absPath, ApplyActionRestarted)
+	}
+
+	changed := changedConfigKeys(lastConfig, newConfig)
+	if restartRequired(coreType, newCoreType, changed) {
+		log.Printf("Config changes need a restart (changed: %v)", changed)
+		return u.applyByRestart(absPath, ApplyActionRestarted)
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if err := checkGeoAssets(newCoreType, newConfig, u.assetPath); err != nil {
+		return fmt.Errorf("asset preflight failed: %w", err)
+	}
+	if err := u.checkAllowedProtocolsLocked(newCoreType, newConfig); err != nil {
+		return err
+	}
+
+	if u.mihomoManager == nil {
+		return fmt.Errorf("mihomo core is not running")
+	}
+	u.mihomoManager.setSharedPatches(u.mihomoPatches.clone())
+	u.mihomoManager.setAllowedProtocols(u.allowedProtocols)
+	if err := u.mihomoManager.ReloadConfig(absPath); err != nil {
+		return fmt.Errorf("failed to reload config: %w", err)
+	}
+
+	u.configPath = absPath
+	u.flushTrafficStatsLocked()
+	u.recordAppliedConfigLocked(configBytes, newConfig)
+	u.lastApplyAction = ApplyActionReloaded
+	log.Printf("Config hot-reloaded (changed: %v): %s", changed, absPath)
+	return nil
+}
+
+// GetLastApplyAction reports what the last ApplyConfig call did, one of the
+// ApplyAction constants, or "" if it has not been called.
+func (u *UnifiedCoreManager) GetLastApplyAction() string {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.lastApplyAction
+}
+
+func (u *UnifiedCoreManager) applyByRestart(configPath, action string) error {
+	if err := u.RunConfig(configPath); err != nil {
+		return err
+	}
+	u.setLastApplyAction(action)
+	return nil
+}
+
+func (u *UnifiedCoreManager) setLastApplyAction(action string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.lastApplyAction = action
+}
+
+// recordAppliedConfigLocked remembers the running config for ApplyConfig.
+// Callers must hold u.mu.
+func (u *UnifiedCoreManager) recordAppliedConfigLocked(configBytes []byte, config map[string]interface{}) {
+	u.lastConfigChecksum = configChecksum(configBytes)
+	u.lastConfig = config
+	u.appliedConfigPath = u.configPath
+	u.configAppliedAt = time.Now()
+}
+
+func configChecksum(configBytes []byte) string {
+	sum := sha256.Sum256(configBytes)
+	return hex.EncodeToString(sum[:])
+}
+
+// changedConfigKeys returns the sorted top-level keys whose values differ
+// between two decoded configs, looking inside a coreConfig wrapper.
+func changedConfigKeys(oldConfig, newConfig map[string]interface{}) []string {
+	oldConfig, newConfig = unwrapCoreConfig(oldConfig), unwrapCoreConfig(newConfig)
+
+	var changed []string
+	for key, value := range newConfig {
+		if !reflect.DeepEqual(oldConfig[key], value) {
+			changed = append(changed, key)
+		}
+	}
+	for key := range oldConfig {
+		if _, exists := newConfig[key]; !exists {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,150 @@
+package libunifiedcore
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+)
+
+// ChangeSet describes how a config differs from the running one, as
+// reported by DryRunConfig.
+type ChangeSet struct {
+	Running         bool     `json:"running"` // false: nothing to compare, the config would be started
+	OldCoreType     string   `json:"oldCoreType"`
+	NewCoreType     string   `json:"newCoreType"`
+	Unchanged       bool     `json:"unchanged"`
+	ChangedSections []string `json:"changedSections"`
+	PortsChanged    []string `json:"portsChanged"` // port keys (Mihomo) or inbound tags (Xray)
+	ProxiesAdded    []string `json:"proxiesAdded"`
+	ProxiesRemoved  []string `json:"proxiesRemoved"`
+	ProxiesModified []string `json:"proxiesModified"`
+	RulesChanged    bool     `json:"rulesChanged"`
+	DNSChanged      bool     `json:"dnsChanged"`
+	RequiresRestart bool     `json:"requiresRestart"` // what ApplyConfig would do
+}
+
+// mihomoPortKeys are the Mihomo keys holding listener ports.
+var mihomoPortKeys = []string{"port", "socks-port", "mixed-port", "redir-port", "tproxy-port", "external-controller"}
+
+// DryRunConfig compares configPath against the running config and reports
+// the changes without applying anything.
+func (u *UnifiedCoreManager) DryRunConfig(configPath string) (*ChangeSet, error) {
+	configBytes, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var newConfig map[string]interface{}
+	if err := json.Unmarshal(configBytes, &newConfig); err != nil {
+		return nil, fmt.Errorf("failed to parse injected config as JSON: %w", err)
+	}
+	coreTypeStr, _ := newConfig["coreType"].(string)
+	newCoreType, err := ParseCoreType(coreTypeStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid coreType in injected config: %s - %w", coreTypeStr, err)
+	}
+
+	u.mu.RLock()
+	running := u.running
+	coreType := u.coreType
+	lastChecksum := u.lastConfigChecksum
+	lastConfig := u.lastConfig
+	u.mu.RUnlock()
+
+	changes := &ChangeSet{Running: running, NewCoreType: newCoreType.String()}
+	if !running || lastConfig == nil {
+		changes.Running = false
+		changes.RequiresRestart = true
+		return changes, nil
+	}
+	changes.OldCoreType = coreType.String()
+	if configChecksum(configBytes) == lastChecksum {
+		changes.Unchanged = true
+		return changes, nil
+	}
+
+	changes.ChangedSections = changedConfigKeys(lastConfig, newConfig)
+	changes.RequiresRestart = restartRequired(coreType, newCoreType, changes.ChangedSections)
+	if newCoreType != coreType {
+		return changes, nil
+	}
+
+	oldInner, newInner := unwrapCoreConfig(lastConfig), unwrapCoreConfig(newConfig)
+	switch coreType {
+	case CoreTypeMihomo:
+		for _, key := range mihomoPortKeys {
+			if !reflect.DeepEqual(oldInner[key], newInner[key]) {
+				changes.PortsChanged = append(changes.PortsChanged, key)
+			}
+		}
+		changes.ProxiesAdded, changes.ProxiesRemoved, changes.ProxiesModified =
+			diffNamedEntries(configMaps(oldInner, "proxies"), configMaps(newInner, "proxies"), "name")
+		changes.RulesChanged = !reflect.DeepEqual(oldInner["rules"], newInner["rules"]) ||
+			!reflect.DeepEqual(oldInner["rule-providers"], newInner["rule-providers"])
+	case CoreTypeV2Ray, CoreTypeXray:
+		added, removed, modified := diffNamedEntries(configMaps(oldInner, "inbounds"), configMaps(newInner, "inbounds"), "tag")
+		changes.PortsChanged = append(append(append(changes.PortsChanged, added...), removed...), modified...)
+		sort.Strings(changes.PortsChanged)
+		changes.ProxiesAdded, changes.ProxiesRemoved, changes.ProxiesModified =
+			diffNamedEntries(configMaps(oldInner, "outbounds"), configMaps(newInner, "outbounds"), "tag")
+		changes.RulesChanged = !reflect.DeepEqual(oldInner["routing"], newInner["routing"])
+	}
+	changes.DNSChanged = !reflect.DeepEqual(oldInner["dns"], newInner["dns"])
+	return changes, nil
+}
+
+// restartRequired reports whether ApplyConfig would restart the core rather
+// than hot-reload it.
+func restartRequired(coreType, newCoreType CoreType, changed []string) bool {
+	if newCoreType != coreType || coreType != CoreTypeMihomo {
+		return true
+	}
+	for _, key := range changed {
+		if mihomoRestartKeys[key] {
+			return true
+		}
+	}
+	return false
+}
+
+func unwrapCoreConfig(config map[string]interface{}) map[string]interface{} {
+	if inner, ok := config["coreConfig"].(map[string]interface{}); ok {
+		return inner
+	}
+	return config
+}
+
+// diffNamedEntries compares two lists of config entries identified by the
+// string field key, returning sorted added, removed and modified names.
+func diffNamedEntries(oldEntries, newEntries []map[string]interface{}, key string) (added, removed, modified []string) {
+	index := func(entries []map[string]interface{}) map[string]map[string]interface{} {
+		byName := make(map[string]map[string]interface{}, len(entries))
+		for _, entry := range entries {
+			if name, _ := entry[key].(string); name != "" {
+				byName[name] = entry
+			}
+		}
+		return byName
+	}
+	oldByName, newByName := index(oldEntries), index(newEntries)
+
+	for name, entry := range newByName {
+		old, exists := oldByName[name]
+		switch {
+		case !exists:
+			added = append(added, name)
+		case !reflect.DeepEqual(old, entry):
+			modified = append(modified, name)
+		}
+	}
+	for name := range oldByName {
+		if _, exists := newByName[name]; !exists {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(modified)
+	return added, removed, modified
+}
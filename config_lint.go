@@ -0,0 +1,215 @@
+package libunifiedcore
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// LintWarning is a non-fatal problem found by LintConfig. Code is stable and
+// meant for programmatic use; Message is for display.
+type LintWarning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// mihomoBuiltinTargets are the rule targets Mihomo provides without a
+// matching proxy or group.
+var mihomoBuiltinTargets = map[string]bool{
+	"DIRECT":      true,
+	"REJECT":      true,
+	"REJECT-DROP": true,
+	"PASS":        true,
+	"COMPATIBLE":  true,
+	"GLOBAL":      true,
+}
+
+// LintConfig reports mistakes that parse fine but make the core misbehave:
+// duplicate proxy names, rules or groups pointing at missing targets, rules
+// after the catch-all rule, and DNS enabled without nameservers. configBytes
+// is a JSON config as passed to RunConfig, with or without the coreType
+// wrapper. A config that does not parse is reported as a single warning.
+func LintConfig(configBytes []byte, coreType string) []LintWarning {
+	ct, err := ParseCoreType(coreType)
+	if err != nil {
+		return []LintWarning{{Code: "invalid-core-type", Message: err.Error()}}
+	}
+
+	var config map[string]interface{}
+	if err := json.Unmarshal(configBytes, &config); err != nil {
+		return []LintWarning{{Code: "invalid-json", Message: fmt.Sprintf("config is not valid JSON: %v", err)}}
+	}
+	config = unwrapCoreConfig(config)
+
+	switch ct {
+	case CoreTypeMihomo:
+		return lintMihomoConfig(config)
+	case CoreTypeV2Ray, CoreTypeXray:
+		return lintXrayConfig(config)
+	default:
+		return nil
+	}
+}
+
+func lintMihomoConfig(config map[string]interface{}) []LintWarning {
+	var warnings []LintWarning
+	warn := func(code, format string, args ...interface{}) {
+		warnings = append(warnings, LintWarning{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	targets := make(map[string]bool)
+	for _, section := range []string{"proxies", "proxy-groups"} {
+		for _, entry := range configMaps(config, section) {
+			name, _ := entry["name"].(string)
+			if name == "" {
+				continue
+			}
+			if targets[name] {
+				warn("duplicate-name", "proxy name %q is used more than once", name)
+			}
+			targets[name] = true
+		}
+	}
+	hasTarget := func(name string) bool {
+		return targets[name] || mihomoBuiltinTargets[strings.ToUpper(name)]
+	}
+
+	for _, group := range configMaps(config, "proxy-groups") {
+		name, _ := group["name"].(string)
+		members, _ := group["proxies"].([]interface{})
+		for _, member := range members {
+			if proxy, _ := member.(string); proxy != "" && !hasTarget(proxy) {
+				warn("unknown-target", "group %q references unknown proxy %q", name, proxy)
+			}
+		}
+	}
+
+	rules, _ := config["rules"].([]interface{})
+	for i, item := range rules {
+		rule, _ := item.(string)
+		ruleType, target := mihomoRuleTarget(rule)
+		if ruleType == "MATCH" && i != len(rules)-1 {
+			warn("match-not-last", "MATCH is rule %d of %d, the %d rules after it are unreachable", i+1, len(rules), len(rules)-1-i)
+		}
+		if target != "" && ruleType != "SUB-RULE" && !hasTarget(target) {
+			warn("unknown-target", "rule %q references unknown proxy or group %q", rule, target)
+		}
+	}
+
+	if dns, ok := config["dns"].(map[string]interface{}); ok {
+		if enabled, _ := dns["enable"].(bool); enabled {
+			if servers, _ := dns["nameserver"].([]interface{}); len(servers) == 0 {
+				warn("dns-no-nameservers", "DNS is enabled but has no nameserver")
+			}
+		}
+	}
+
+	return warnings
+}
+
+// mihomoRuleTarget returns the type and target of a rule string such as
+// "DOMAIN-SUFFIX,example.com,PROXY,no-resolve" or
+// "AND,((DOMAIN,a.com),(NETWORK,udp)),PROXY".
+func mihomoRuleTarget(rule string) (ruleType, target string) {
+	parts := strings.Split(rule, ",")
+	ruleType = strings.ToUpper(strings.TrimSpace(parts[0]))
+	if ruleType == "MATCH" {
+		if len(parts) < 2 {
+			return ruleType, ""
+		}
+		return ruleType, strings.TrimSpace(parts[1])
+	}
+
+	// Logic rules nest commas inside parentheses; the target follows them.
+	rest := rule
+	if end := strings.LastIndex(rule, ")"); end >= 0 {
+		rest = rule[end+1:]
+	}
+	var fields []string
+	for _, field := range strings.Split(rest, ",") {
+		field = strings.TrimSpace(field)
+		switch strings.ToLower(field) {
+		case "", "no-resolve", "src":
+			continue
+		}
+		fields = append(fields, field)
+	}
+	// Without parentheses the first two fields are the type and payload.
+	if rest == rule && len(fields) < 3 {
+		return ruleType, ""
+	}
+	if len(fields) == 0 {
+		return ruleType, ""
+	}
+	return ruleType, fields[len(fields)-1]
+}
+
+func lintXrayConfig(config map[string]interface{}) []LintWarning {
+	var warnings []LintWarning
+	warn := func(code, format string, args ...interface{}) {
+		warnings = append(warnings, LintWarning{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	tags := func(section string) map[string]bool {
+		seen := make(map[string]bool)
+		for _, entry := range configMaps(config, section) {
+			tag, _ := entry["tag"].(string)
+			if tag == "" {
+				continue
+			}
+			if seen[tag] {
+				warn("duplicate-name", "%s tag %q is used more than once", strings.TrimSuffix(section, "s"), tag)
+			}
+			seen[tag] = true
+		}
+		return seen
+	}
+	tags("inbounds")
+	outboundTags := tags("outbounds")
+
+	routing, _ := config["routing"].(map[string]interface{})
+	balancerTags := make(map[string]bool)
+	for _, balancer := range configMaps(routing, "balancers") {
+		if tag, _ := balancer["tag"].(string); tag != "" {
+			balancerTags[tag] = true
+		}
+	}
+
+	rules := configMaps(routing, "rules")
+	for i, rule := range rules {
+		if tag, _ := rule["outboundTag"].(string); tag != "" && !outboundTags[tag] {
+			warn("unknown-target", "routing rule %d references unknown outbound %q", i+1, tag)
+		}
+		if tag, _ := rule["balancerTag"].(string); tag != "" && !balancerTags[tag] {
+			warn("unknown-target", "routing rule %d references unknown balancer %q", i+1, tag)
+		}
+		if xrayCatchAllRule(rule) && i != len(rules)-1 {
+			warn("match-not-last", "routing rule %d matches all traffic, the %d rules after it are unreachable", i+1, len(rules)-1-i)
+		}
+	}
+
+	if dns, ok := config["dns"].(map[string]interface{}); ok {
+		if servers, _ := dns["servers"].([]interface{}); len(servers) == 0 {
+			warn("dns-no-nameservers", "dns section has no servers")
+		}
+	}
+
+	return warnings
+}
+
+// xrayCatchAllRule reports whether a routing rule has no matcher other than
+// a network covering both tcp and udp.
+func xrayCatchAllRule(rule map[string]interface{}) bool {
+	network := ""
+	for key, value := range rule {
+		switch key {
+		case "type", "outboundTag", "balancerTag", "ruleTag":
+		case "network":
+			network, _ = value.(string)
+		default:
+			return false
+		}
+	}
+	network = strings.ReplaceAll(network, " ", "")
+	return network == "tcp,udp" || network == "udp,tcp"
+}
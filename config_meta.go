@@ -0,0 +1,101 @@
+package libunifiedcore
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+)
+
+// configMetadataKey is the reserved top-level config key for app metadata
+// (profile name, region, ...). It is removed, like coreType, before the
+// config reaches the core.
+const configMetadataKey = "_meta"
+
+// Config sources reported in ConfigMeta.
+const (
+	ConfigSourceFile      = "file"      // a config file passed to RunConfig and friends
+	ConfigSourceURL       = "url"       // downloaded from a subscription or update URL
+	ConfigSourceBytes     = "bytes"     // generated in memory by the app
+	ConfigSourceShareLink = "sharelink" // built from a share link by RunShareLink
+)
+
+// ConfigMeta describes the config that is currently applied.
+type ConfigMeta struct {
+	Path      string    `json:"path"`
+	Source    string    `json:"source"`
+	Origin    string    `json:"origin,omitempty"` // URL or share link name the config came from
+	Checksum  string    `json:"checksum"`
+	AppliedAt time.Time `json:"appliedAt"`
+}
+
+type configOrigin struct {
+	source string
+	origin string
+}
+
+// SetConfigSource records where the config file at configPath came from, for
+// loaders outside this package (subscription updates, generated configs).
+// GetConfigMeta reports it once that file is applied; files without a
+// recorded source are reported as ConfigSourceFile.
+func (u *UnifiedCoreManager) SetConfigSource(configPath, source, origin string) error {
+	switch source {
+	case ConfigSourceFile, ConfigSourceURL, ConfigSourceBytes, ConfigSourceShareLink:
+	default:
+		return fmt.Errorf("unknown config source: %s", source)
+	}
+	absPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve config path: %w", err)
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.configOrigins == nil {
+		u.configOrigins = make(map[string]configOrigin)
+	}
+	u.configOrigins[absPath] = configOrigin{source: source, origin: origin}
+	log.Printf("Config source for %s set to %s", absPath, source)
+	return nil
+}
+
+// GetConfigMeta reports the path, source, checksum and apply time of the
+// config that was last started or applied.
+func (u *UnifiedCoreManager) GetConfigMeta() (*ConfigMeta, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	if u.lastConfigChecksum == "" {
+		return nil, fmt.Errorf("no config applied")
+	}
+
+	meta := &ConfigMeta{
+		Path:      u.appliedConfigPath,
+		Source:    ConfigSourceFile,
+		Checksum:  u.lastConfigChecksum,
+		AppliedAt: u.configAppliedAt,
+	}
+	if origin, exists := u.configOrigins[u.appliedConfigPath]; exists {
+		meta.Source = origin.source
+		meta.Origin = origin.origin
+	}
+	return meta, nil
+}
+
+// GetConfigMetadata returns the _meta object of the config that was last
+// started or applied, or nil when it had none.
+func (u *UnifiedCoreManager) GetConfigMetadata() map[string]interface{} {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	meta, _ := u.lastConfig[configMetadataKey].(map[string]interface{})
+	return meta
+}
+
+// stripInjectedFields removes the fields added for this package, coreType
+// and _meta, from a decoded config before it is handed to the core.
+func stripInjectedFields(config map[string]interface{}) {
+	delete(config, "coreType")
+	delete(config, configMetadataKey)
+}
@@ -0,0 +1,90 @@
+package libunifiedcore
+
+import "fmt"
+
+// configPatch mutates a decoded core config before it is handed to the core.
+type configPatch func(config map[string]interface{}) error
+
+// patchSet is an ordered collection of named config patches. Setting a patch
+// under an existing name replaces it in place; setting nil removes it.
+type patchSet struct {
+	names   []string
+	patches map[string]configPatch
+}
+
+func (p *patchSet) set(name string, patch configPatch) {
+	if p.patches == nil {
+		p.patches = make(map[string]configPatch)
+	}
+
+	if patch == nil {
+		if _, exists := p.patches[name]; !exists {
+			return
+		}
+		delete(p.patches, name)
+		for i, n := range p.names {
+			if n == name {
+				p.names = append(p.names[:i:i], p.names[i+1:]...)
+				break
+			}
+		}
+		return
+	}
+
+	if _, exists := p.patches[name]; !exists {
+		p.names = append(p.names, name)
+	}
+	p.patches[name] = patch
+}
+
+func (p *patchSet) apply(config map[string]interface{}) error {
+	for _, name := range p.names {
+		if err := p.patches[name](config); err != nil {
+			return fmt.Errorf("failed to apply %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (p *patchSet) clone() patchSet {
+	c := patchSet{
+		names:   append([]string(nil), p.names...),
+		patches: make(map[string]configPatch, len(p.patches)),
+	}
+	for name, patch := range p.patches {
+		c.patches[name] = patch
+	}
+	return c
+}
+
+// configSection returns config[key] as a map, creating it when absent.
+func configSection(config map[string]interface{}, key string) map[string]interface{} {
+	if section, ok := config[key].(map[string]interface{}); ok {
+		return section
+	}
+	section := make(map[string]interface{})
+	config[key] = section
+	return section
+}
+
+// configMaps returns the map elements of the list stored at config[key].
+func configMaps(config map[string]interface{}, key string) []map[string]interface{} {
+	list, _ := config[key].([]interface{})
+	maps := make([]map[string]interface{}, 0, len(list))
+	for _, item := range list {
+		if m, ok := item.(map[string]interface{}); ok {
+			maps = append(maps, m)
+		}
+	}
+	return maps
+}
+
+// xrayOutbounds returns the outbounds of an Xray config.
+func xrayOutbounds(config map[string]interface{}) []map[string]interface{} {
+	return configMaps(config, "outbounds")
+}
+
+// mihomoProxies returns the proxies of a Mihomo config.
+func mihomoProxies(config map[string]interface{}) []map[string]interface{} {
+	return configMaps(config, "proxies")
+}
@@ -0,0 +1,71 @@
+package libunifiedcore
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Bounds for SetConfigReadRetries, so a missing config cannot stall a start
+// for long. maxConfigReadWait caps the total time spent waiting.
+const (
+	maxConfigReadRetries = 10
+	maxConfigReadDelay   = 2 * time.Second
+	maxConfigReadWait    = 5 * time.Second
+)
+
+// SetConfigReadRetries makes RunConfig, ApplyConfig and SoftRestart retry
+// reading a config file that is missing or empty up to n more times, waiting
+// delay before the first retry and one more delay before each further one,
+// but no more than maxConfigReadWait in total. This covers a config the app
+// has not finished writing yet. n of 0 turns retries off.
+func (u *UnifiedCoreManager) SetConfigReadRetries(n int, delay time.Duration) error {
+	if n < 0 || n > maxConfigReadRetries {
+		return fmt.Errorf("invalid config read retries: %d, must be between 0 and %d", n, maxConfigReadRetries)
+	}
+	if delay < 0 || delay > maxConfigReadDelay {
+		return fmt.Errorf("invalid config read delay: %v, must be between 0 and %v", delay, maxConfigReadDelay)
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.configReadRetries = n
+	u.configReadDelay = delay
+	log.Printf("Config read retries set to %d, delay %v", n, delay)
+	return nil
+}
+
+// configReadPolicy returns the SetConfigReadRetries settings.
+func (u *UnifiedCoreManager) configReadPolicy() (int, time.Duration) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.configReadRetries, u.configReadDelay
+}
+
+// readConfigFile reads a config file, retrying while it is missing or empty.
+// It must not be called with u.mu held.
+func readConfigFile(path string, retries int, delay time.Duration) ([]byte, error) {
+	deadline := time.Now().Add(maxConfigReadWait)
+	for attempt := 0; ; attempt++ {
+		data, err := os.ReadFile(path)
+		if err == nil && len(data) > 0 {
+			return data, nil
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if attempt >= retries || !time.Now().Before(deadline) {
+			if err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("config file is empty: %s", path)
+		}
+		wait := delay * time.Duration(attempt+1)
+		if remaining := time.Until(deadline); wait > remaining {
+			wait = remaining
+		}
+		log.Printf("Config file %s not ready, retrying (%d/%d)", path, attempt+1, retries)
+		time.Sleep(wait)
+	}
+}
@@ -0,0 +1,55 @@
+package libunifiedcore
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// SetConfigAtomic writes a config file so that readers see either the old
+// or the new content, never a partial write: data goes to a temp file in
+// the same directory, which is synced and then renamed over path. This is
+// the recommended way to write a config that a running core or a watcher
+// may read at the same time. data must be valid JSON.
+func SetConfigAtomic(data []byte, path string) error {
+	if !json.Valid(data) {
+		return fmt.Errorf("config is not valid JSON")
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	log.Printf("Config written to %s", path)
+	return nil
+}
+
+// writeFileAtomic replaces path with data through a temp file and rename.
+func writeFileAtomic(path string, data []byte) error {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+base+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,133 @@
+package libunifiedcore
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	C "github.com/metacubex/mihomo/constant"
+	"github.com/metacubex/mihomo/tunnel"
+	"github.com/xtls/xray-core/features/outbound"
+)
+
+// ConnectivityReport is the result of a ValidateConnectivity check.
+type ConnectivityReport struct {
+	CoreType  string `json:"coreType"`
+	Proxy     string `json:"proxy"` // default outbound tag / proxy group probed
+	Success   bool   `json:"success"`
+	LatencyMs int    `json:"latencyMs"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ValidateConnectivity starts the config, sends a single probe through the
+// default outbound (Xray) or the group the MATCH rule routes to (Mihomo), and
+// stops the core again. Probe failures are reported in the returned report;
+// an error is only returned when the core cannot be started. With
+// SetPingCacheTTL a recent successful report for the same config is
+// returned instead.
+func (u *UnifiedCoreManager) ValidateConnectivity(configPath string, timeout time.Duration) (*ConnectivityReport, error) {
+	if timeout <= 0 {
+		return nil, fmt.Errorf("invalid timeout: %v", timeout)
+	}
+	cacheKey := pingCacheKey(configPath, "", u.connectivityProbeURL())
+	if report, cached := pingCache.report(cacheKey); cached {
+		log.Printf("Connectivity check for %s served from ping cache", configPath)
+		return report, nil
+	}
+	if u.IsRunning() {
+		return nil, fmt.Errorf("core is already running, stop it before validating connectivity")
+	}
+
+	if err := u.RunConfig(configPath); err != nil {
+		return nil, err
+	}
+	defer u.Stop()
+
+	probeURL := u.connectivityProbeURL()
+	deadline := time.Now().Add(timeout)
+	u.waitStartupDone(timeout)
+
+	u.mu.RLock()
+	coreType := u.coreType
+	v2rayManager := u.v2rayManager
+	u.mu.RUnlock()
+
+	report := &ConnectivityReport{CoreType: coreType.String()}
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		report.Error = "timed out waiting for core to start"
+		return report, nil
+	}
+
+	var latency int
+	var err error
+	switch coreType {
+	case CoreTypeV2Ray, CoreTypeXray:
+		report.Proxy, latency, err = probeXrayDefault(v2rayManager, probeURL, remaining)
+	case CoreTypeMihomo:
+		report.Proxy, latency, err = probeMihomoDefault(probeURL, remaining)
+	default:
+		err = fmt.Errorf("unsupported core type: %v", coreType)
+	}
+
+	if err != nil {
+		report.Error = err.Error()
+		log.Printf("Connectivity check failed for %s: %v", configPath, err)
+	} else {
+		report.Success = true
+		report.LatencyMs = latency
+		log.Printf("Connectivity check passed for %s via %s: %dms", configPath, report.Proxy, latency)
+		pingCache.put(cacheKey, report)
+	}
+	return report, nil
+}
+
+// probeXrayDefault probes through the running instance's routing and reports
+// the default outbound's tag.
+func probeXrayDefault(v *V2RayCoreManager, probeURL string, timeout time.Duration) (string, int, error) {
+	if v == nil {
+		return "", 0, fmt.Errorf("V2Ray core is not running")
+	}
+	v.mu.RLock()
+	instance := v.instance
+	v.mu.RUnlock()
+	if instance == nil {
+		return "", 0, fmt.Errorf("V2Ray core is not running")
+	}
+
+	var tag string
+	if manager, ok := instance.GetFeature(outbound.ManagerType()).(outbound.Manager); ok {
+		if handler := manager.GetDefaultHandler(); handler != nil {
+			tag = handler.Tag()
+		}
+	}
+
+	latency, err := probeHTTP(context.Background(), xrayHTTPClient(instance, timeout), probeURL)
+	return tag, latency, err
+}
+
+// probeMihomoDefault URL-tests the proxy the MATCH rule routes to, falling
+// back to GLOBAL when the config has no MATCH rule.
+func probeMihomoDefault(probeURL string, timeout time.Duration) (string, int, error) {
+	name := "GLOBAL"
+	for _, rule := range tunnel.Rules() {
+		if rule.RuleType() == C.MATCH {
+			name = rule.Adapter()
+			break
+		}
+	}
+
+	proxy, exists := tunnel.Proxies()[name]
+	if !exists {
+		return name, 0, fmt.Errorf("proxy not found: %s", name)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	delay, err := proxy.URLTest(ctx, probeURL, nil)
+	if err != nil {
+		return name, 0, err
+	}
+	return name, int(delay), nil
+}
@@ -0,0 +1,378 @@
+package libunifiedcore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/metacubex/mihomo/adapter"
+)
+
+// compareTimeout bounds each core's probe in CompareCores.
+const compareTimeout = 10 * time.Second
+
+// CoreProbeResult is one core's outcome in a ComparisonResult.
+type CoreProbeResult struct {
+	Success   bool   `json:"success"`
+	LatencyMs int    `json:"latencyMs"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ComparisonResult reports how Xray and Mihomo handled the same server.
+type ComparisonResult struct {
+	SourceCore string          `json:"sourceCore"`
+	Proxy      string          `json:"proxy"` // outbound tag or proxy name that was compared
+	Xray       CoreProbeResult `json:"xray"`
+	Mihomo     CoreProbeResult `json:"mihomo"`
+	Warnings   []string        `json:"warnings"` // translation losses
+}
+
+// CompareCores probes the main server of a config through Xray and through
+// Mihomo, one after the other, and reports success and latency for each. The
+// server is the first proxy outbound (Xray) or the first proxy (Mihomo);
+// it is translated to the other core through the share link model, which is
+// best-effort: settings that do not carry over are listed in Warnings, and a
+// server that cannot be translated at all is reported as that core's error.
+// Neither probe opens a listening port, so this can run next to a live core.
+func CompareCores(configBytes []byte, testURL string) (*ComparisonResult, error) {
+	if testURL == "" {
+		testURL = defaultProbeURL
+	}
+
+	var config map[string]interface{}
+	if err := json.Unmarshal(configBytes, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config JSON: %w", err)
+	}
+	coreTypeStr, _ := config["coreType"].(string)
+	coreType, err := ParseCoreType(coreTypeStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid coreType in config: %s - %w", coreTypeStr, err)
+	}
+	config = unwrapCoreConfig(config)
+
+	result := &ComparisonResult{SourceCore: coreType.String()}
+	var xrayOutbound, mihomoProxy map[string]interface{}
+
+	switch coreType {
+	case CoreTypeV2Ray, CoreTypeXray:
+		for _, outbound := range xrayOutbounds(config) {
+			if protocol, _ := outbound["protocol"].(string); shareLinkProtocols[protocol] {
+				xrayOutbound = outbound
+				break
+			}
+		}
+		if xrayOutbound == nil {
+			return nil, fmt.Errorf("no vless, vmess, trojan or shadowsocks outbound to compare")
+		}
+		result.Proxy, _ = xrayOutbound["tag"].(string)
+
+		link, warnings, err := shareLinkFromXrayOutbound(xrayOutbound)
+		result.Warnings = warnings
+		if err == nil {
+			mihomoProxy, err = link.mihomoProxy()
+		}
+		if err != nil {
+			result.Mihomo.Error = fmt.Sprintf("translation failed: %v", err)
+		}
+	case CoreTypeMihomo:
+		proxies := mihomoProxies(config)
+		if len(proxies) == 0 {
+			return nil, fmt.Errorf("no proxies to compare")
+		}
+		mihomoProxy = proxies[0]
+		result.Proxy, _ = mihomoProxy["name"].(string)
+
+		link, warnings, err := shareLinkFromMihomoProxy(mihomoProxy)
+		result.Warnings = warnings
+		if err == nil {
+			xrayOutbound = link.xrayOutbound("compare")
+		} else {
+			result.Xray.Error = fmt.Sprintf("translation failed: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported core type: %v", coreType)
+	}
+
+	if coreType != CoreTypeMihomo && result.Proxy != "" {
+		// Probe the original config so chained outbounds keep working
+		innerBytes, err := json.Marshal(config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal config: %w", err)
+		}
+		result.Xray = coreProbeResult(TestOutbound(innerBytes, result.Proxy, testURL, compareTimeout))
+	} else if xrayOutbound != nil {
+		result.Xray = probeXrayOutbound(xrayOutbound, testURL)
+	}
+	if mihomoProxy != nil {
+		result.Mihomo = probeMihomoProxy(mihomoProxy, result.Proxy, testURL)
+	}
+
+	log.Printf("Core comparison for %s - Xray: %+v, Mihomo: %+v, %d warnings", result.Proxy, result.Xray, result.Mihomo, len(result.Warnings))
+	return result, nil
+}
+
+func probeXrayOutbound(outbound map[string]interface{}, testURL string) CoreProbeResult {
+	tag, _ := outbound["tag"].(string)
+	if tag == "" {
+		tag = "compare"
+		outbound["tag"] = tag
+	}
+	configBytes, err := json.Marshal(map[string]interface{}{"outbounds": []interface{}{outbound}})
+	if err != nil {
+		return CoreProbeResult{Error: err.Error()}
+	}
+	return coreProbeResult(TestOutbound(configBytes, tag, testURL, compareTimeout))
+}
+
+func coreProbeResult(latency int, err error) CoreProbeResult {
+	if err != nil {
+		return CoreProbeResult{Error: err.Error()}
+	}
+	return CoreProbeResult{Success: true, LatencyMs: latency}
+}
+
+func probeMihomoProxy(mapping map[string]interface{}, name, testURL string) CoreProbeResult {
+	mapping = copyConfigMap(mapping)
+	if _, exists := mapping["name"]; !exists {
+		mapping["name"] = firstNonEmpty(name, "compare")
+	}
+	proxy, err := adapter.ParseProxy(mapping)
+	if err != nil {
+		return CoreProbeResult{Error: fmt.Sprintf("invalid Mihomo proxy: %v", err)}
+	}
+	defer proxy.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), compareTimeout)
+	defer cancel()
+	delay, err := proxy.URLTest(ctx, testURL, nil)
+	return coreProbeResult(int(delay), err)
+}
+
+func copyConfigMap(m map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		c[key] = value
+	}
+	return c
+}
+
+// shareLinkProtocols are the Xray protocols the share link model covers.
+var shareLinkProtocols = map[string]bool{"vless": true, "vmess": true, "trojan": true, "shadowsocks": true}
+
+// shareLinkFromXrayOutbound is the reverse of shareLink.xrayOutbound. The
+// warnings name settings the share link model cannot carry.
+func shareLinkFromXrayOutbound(outbound map[string]interface{}) (*shareLink, []string, error) {
+	var warnings []string
+	protocol, _ := outbound["protocol"].(string)
+	if !shareLinkProtocols[protocol] {
+		return nil, nil, fmt.Errorf("protocol %s cannot be translated", protocol)
+	}
+	tag, _ := outbound["tag"].(string)
+	link := &shareLink{Protocol: protocol, Name: tag}
+
+	settings, _ := outbound["settings"].(map[string]interface{})
+	var server map[string]interface{}
+	if vnext := configMaps(settings, "vnext"); len(vnext) > 0 {
+		server = vnext[0]
+		if users := configMaps(server, "users"); len(users) > 0 {
+			user := users[0]
+			link.UUID, _ = user["id"].(string)
+			link.Flow, _ = user["flow"].(string)
+			link.AlterID = configPort(user["alterId"])
+			link.Cipher = firstNonEmpty(stringValue(user["security"]), "auto")
+		}
+		if len(vnext) > 1 {
+			warnings = append(warnings, "only the first of several vnext servers is compared")
+		}
+	} else if servers := configMaps(settings, "servers"); len(servers) > 0 {
+		server = servers[0]
+		link.Password, _ = server["password"].(string)
+		link.Cipher, _ = server["method"].(string)
+		if len(servers) > 1 {
+			warnings = append(warnings, "only the first of several servers is compared")
+		}
+	} else {
+		return nil, warnings, fmt.Errorf("outbound has no server")
+	}
+	link.Server, _ = server["address"].(string)
+	link.Port = configPort(server["port"])
+
+	stream, _ := outbound["streamSettings"].(map[string]interface{})
+	link.Network = firstNonEmpty(stringValue(stream["network"]), "tcp")
+	link.Security = firstNonEmpty(stringValue(stream["security"]), "none")
+	switch link.Network {
+	case "ws":
+		ws, _ := stream["wsSettings"].(map[string]interface{})
+		link.Path, _ = ws["path"].(string)
+		headers, _ := ws["headers"].(map[string]interface{})
+		link.Host = firstNonEmpty(stringValue(ws["host"]), stringValue(headers["Host"]))
+	case "grpc":
+		grpc, _ := stream["grpcSettings"].(map[string]interface{})
+		link.ServiceName, _ = grpc["serviceName"].(string)
+	case "http", "h2":
+		h2, _ := stream["httpSettings"].(map[string]interface{})
+		link.Path, _ = h2["path"].(string)
+		link.Host = strings.Join(stringList(h2["host"]), ",")
+	case "httpupgrade", "xhttp":
+		opts, _ := stream[link.Network+"Settings"].(map[string]interface{})
+		link.Path, _ = opts["path"].(string)
+		link.Host, _ = opts["host"].(string)
+	case "tcp", "raw":
+		link.Network = "tcp"
+		tcp, _ := stream["tcpSettings"].(map[string]interface{})
+		header, _ := tcp["header"].(map[string]interface{})
+		if link.HeaderType, _ = header["type"].(string); link.HeaderType == "http" {
+			request, _ := header["request"].(map[string]interface{})
+			link.Path = firstNonEmpty(stringList(request["path"])...)
+			headers, _ := request["headers"].(map[string]interface{})
+			link.Host = strings.Join(stringList(headers["Host"]), ",")
+		}
+	}
+
+	switch link.Security {
+	case "tls":
+		tls, _ := stream["tlsSettings"].(map[string]interface{})
+		link.SNI, _ = tls["serverName"].(string)
+		link.ALPN = stringList(tls["alpn"])
+		link.Fingerprint, _ = tls["fingerprint"].(string)
+		link.Insecure, _ = tls["allowInsecure"].(bool)
+	case "reality":
+		reality, _ := stream["realitySettings"].(map[string]interface{})
+		link.SNI, _ = reality["serverName"].(string)
+		link.Fingerprint, _ = reality["fingerprint"].(string)
+		link.PublicKey, _ = reality["publicKey"].(string)
+		link.ShortID, _ = reality["shortId"].(string)
+		link.SpiderX, _ = reality["spiderX"].(string)
+	}
+
+	for _, key := range []string{"mux", "proxySettings"} {
+		if _, exists := outbound[key]; exists {
+			warnings = append(warnings, fmt.Sprintf("%s is not translated", key))
+		}
+	}
+	if _, exists := stream["sockopt"]; exists {
+		warnings = append(warnings, "streamSettings.sockopt is not translated")
+	}
+	return link, warnings, nil
+}
+
+// mihomoTranslatedKeys are the Mihomo proxy fields shareLinkFromMihomoProxy
+// understands; anything else is reported as a translation warning.
+var mihomoTranslatedKeys = map[string]bool{
+	"name": true, "type": true, "server": true, "port": true, "udp": true,
+	"uuid": true, "flow": true, "alterId": true, "cipher": true, "password": true,
+	"network": true, "ws-opts": true, "grpc-opts": true, "h2-opts": true, "http-opts": true,
+	"tls": true, "servername": true, "sni": true, "client-fingerprint": true,
+	"alpn": true, "skip-cert-verify": true, "reality-opts": true,
+}
+
+// shareLinkFromMihomoProxy is the reverse of shareLink.mihomoProxy.
+func shareLinkFromMihomoProxy(proxy map[string]interface{}) (*shareLink, []string, error) {
+	proxyType, _ := proxy["type"].(string)
+	protocol := proxyType
+	if proxyType == "ss" {
+		protocol = "shadowsocks"
+	}
+	if !shareLinkProtocols[protocol] {
+		return nil, nil, fmt.Errorf("proxy type %s has no Xray equivalent", proxyType)
+	}
+
+	var warnings []string
+	var unknown []string
+	for key := range proxy {
+		if !mihomoTranslatedKeys[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		warnings = append(warnings, fmt.Sprintf("%s is not translated", key))
+	}
+
+	name, _ := proxy["name"].(string)
+	link := &shareLink{
+		Protocol: protocol,
+		Name:     name,
+		Server:   stringValue(proxy["server"]),
+		Port:     configPort(proxy["port"]),
+		UUID:     stringValue(proxy["uuid"]),
+		Flow:     stringValue(proxy["flow"]),
+		AlterID:  configPort(proxy["alterId"]),
+		Cipher:   stringValue(proxy["cipher"]),
+		Password: stringValue(proxy["password"]),
+		Network:  firstNonEmpty(stringValue(proxy["network"]), "tcp"),
+		Security: "none",
+	}
+	if link.Server == "" || link.Port == 0 {
+		return nil, warnings, fmt.Errorf("proxy has no server or port")
+	}
+
+	switch link.Network {
+	case "ws":
+		opts, _ := proxy["ws-opts"].(map[string]interface{})
+		link.Path, _ = opts["path"].(string)
+		headers, _ := opts["headers"].(map[string]interface{})
+		link.Host = stringValue(headers["Host"])
+		if upgrade, _ := opts["v2ray-http-upgrade"].(bool); upgrade {
+			link.Network = "httpupgrade"
+		}
+	case "grpc":
+		opts, _ := proxy["grpc-opts"].(map[string]interface{})
+		link.ServiceName, _ = opts["grpc-service-name"].(string)
+	case "h2":
+		opts, _ := proxy["h2-opts"].(map[string]interface{})
+		link.Network = "http"
+		link.Path, _ = opts["path"].(string)
+		link.Host = strings.Join(stringList(opts["host"]), ",")
+	case "http":
+		opts, _ := proxy["http-opts"].(map[string]interface{})
+		link.Network = "tcp"
+		link.HeaderType = "http"
+		link.Path = firstNonEmpty(stringList(opts["path"])...)
+		headers, _ := opts["headers"].(map[string]interface{})
+		link.Host = strings.Join(stringList(headers["Host"]), ",")
+	}
+
+	tls, _ := proxy["tls"].(bool)
+	if tls || protocol == "trojan" {
+		link.Security = "tls"
+		link.SNI = firstNonEmpty(stringValue(proxy["servername"]), stringValue(proxy["sni"]))
+		link.Fingerprint = stringValue(proxy["client-fingerprint"])
+		link.ALPN = stringList(proxy["alpn"])
+		link.Insecure, _ = proxy["skip-cert-verify"].(bool)
+	}
+	if reality, ok := proxy["reality-opts"].(map[string]interface{}); ok {
+		link.Security = "reality"
+		link.PublicKey = stringValue(reality["public-key"])
+		link.ShortID = stringValue(reality["short-id"])
+	}
+	return link, warnings, nil
+}
+
+func stringValue(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+// stringList accepts a JSON string or list of strings.
+func stringList(v interface{}) []string {
+	switch list := v.(type) {
+	case string:
+		return []string{list}
+	case []interface{}:
+		var values []string
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	case []string:
+		return list
+	}
+	return nil
+}
@@ -0,0 +1,331 @@
+package libunifiedcore
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/metacubex/mihomo/adapter"
+	C "github.com/metacubex/mihomo/constant"
+	core "github.com/xtls/xray-core/core"
+	serial "github.com/xtls/xray-core/infra/conf/serial"
+)
+
+// diagnoseStageTimeout bounds each stage of DiagnoseConnection.
+const diagnoseStageTimeout = 10 * time.Second
+
+// Stages of DiagnoseConnection, in the order they run.
+const (
+	DiagnosisStageDNS       = "dns"
+	DiagnosisStageTCP       = "tcp"
+	DiagnosisStageHandshake = "handshake"
+	DiagnosisStageHTTP      = "http"
+)
+
+// udpProxyTypes are the Mihomo proxy types and Xray protocols and
+// transports that reach their server over UDP only, so there is no TCP
+// connection to test.
+var udpProxyTypes = map[string]bool{
+	"hysteria": true, "hysteria2": true, "tuic": true, "wireguard": true,
+	"kcp": true, "mkcp": true, "quic": true,
+}
+
+// proxyDialFunc opens a TCP connection to addr through a proxy.
+type proxyDialFunc func(ctx context.Context, addr string) (net.Conn, error)
+
+// DiagnosisStage is the outcome of one stage of DiagnoseConnection.
+type DiagnosisStage struct {
+	Name       string `json:"name"`
+	Success    bool   `json:"success"`
+	Skipped    bool   `json:"skipped,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+	Detail     string `json:"detail,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// DiagnosisReport is the result of DiagnoseConnection. Stages holds the
+// stages that ran; FailedStage names the one that stopped the diagnosis.
+type DiagnosisReport struct {
+	CoreType    string           `json:"coreType"`
+	Proxy       string           `json:"proxy"` // outbound tag or proxy name that was diagnosed
+	Server      string           `json:"server"`
+	Port        int              `json:"port"`
+	TestURL     string           `json:"testUrl"`
+	Stages      []DiagnosisStage `json:"stages"`
+	FailedStage string           `json:"failedStage,omitempty"`
+	Success     bool             `json:"success"`
+}
+
+// DiagnoseConnection checks the main server of a config stage by stage:
+// resolving the server hostname, connecting to it over TCP, completing the
+// proxy handshake by opening a connection through it (and a TLS handshake
+// with the test host), and fetching the test URL through it. The diagnosis
+// stops at the first failing stage. The server is the first proxy outbound
+// (Xray) or the first proxy (Mihomo); it is loaded into an ephemeral core
+// that opens no listening port, so this can run next to a live core. The
+// TCP stage is skipped for servers reached over UDP. The error is only set
+// when the config cannot be diagnosed at all.
+func DiagnoseConnection(configPath string) (*DiagnosisReport, error) {
+	configBytes, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(configBytes, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config JSON: %w", err)
+	}
+	coreTypeStr, _ := config["coreType"].(string)
+	coreType, err := ParseCoreType(coreTypeStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid coreType in config: %s - %w", coreTypeStr, err)
+	}
+	config = unwrapCoreConfig(config)
+
+	report := &DiagnosisReport{CoreType: coreType.String(), TestURL: defaultProbeURL}
+	var udpOnly bool
+	var newDialer func() (proxyDialFunc, func(), error)
+
+	switch coreType {
+	case CoreTypeV2Ray, CoreTypeXray:
+		var outbound map[string]interface{}
+		for _, o := range xrayOutbounds(config) {
+			if protocol, _ := o["protocol"].(string); !builtinOutboundProtocols[protocol] {
+				outbound = o
+				break
+			}
+		}
+		if outbound == nil {
+			return nil, fmt.Errorf("no proxy outbound to diagnose")
+		}
+		if tag, _ := outbound["tag"].(string); tag == "" {
+			outbound["tag"] = "diagnose"
+		}
+		report.Proxy, _ = outbound["tag"].(string)
+		report.Server, report.Port = xrayOutboundServer(outbound)
+		stream, _ := outbound["streamSettings"].(map[string]interface{})
+		udpOnly = udpProxyTypes[stringValue(outbound["protocol"])] || udpProxyTypes[stringValue(stream["network"])]
+		newDialer = func() (proxyDialFunc, func(), error) {
+			return diagnosisXrayDialer(config, report.Proxy)
+		}
+	case CoreTypeMihomo:
+		var proxy map[string]interface{}
+		for _, p := range mihomoProxies(config) {
+			if stringValue(p["server"]) != "" {
+				proxy = p
+				break
+			}
+		}
+		if proxy == nil {
+			return nil, fmt.Errorf("no proxy to diagnose")
+		}
+		report.Proxy = stringValue(proxy["name"])
+		report.Server, report.Port = stringValue(proxy["server"]), configPort(proxy["port"])
+		udpOnly = udpProxyTypes[stringValue(proxy["type"])]
+		newDialer = func() (proxyDialFunc, func(), error) {
+			return diagnosisMihomoDialer(proxy)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported core type: %v", coreType)
+	}
+	if report.Server == "" || report.Port == 0 {
+		return nil, fmt.Errorf("%s has no server address", report.Proxy)
+	}
+
+	// run records a stage and reports whether the diagnosis goes on
+	run := func(name string, stage func(ctx context.Context) (string, error)) bool {
+		ctx, cancel := context.WithTimeout(context.Background(), diagnoseStageTimeout)
+		defer cancel()
+		start := time.Now()
+		detail, err := stage(ctx)
+		result := DiagnosisStage{Name: name, Success: err == nil, DurationMs: time.Since(start).Milliseconds(), Detail: detail}
+		if err != nil {
+			result.Error = err.Error()
+			report.FailedStage = name
+		}
+		report.Stages = append(report.Stages, result)
+		return err == nil
+	}
+	serverAddr := net.JoinHostPort(report.Server, strconv.Itoa(report.Port))
+
+	ok := run(DiagnosisStageDNS, func(ctx context.Context) (string, error) {
+		if _, err := netip.ParseAddr(report.Server); err == nil {
+			return "server is an IP address", nil
+		}
+		addrs, err := net.DefaultResolver.LookupHost(ctx, report.Server)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve %s: %w", report.Server, err)
+		}
+		return strings.Join(addrs, ", "), nil
+	})
+
+	if ok && udpOnly {
+		report.Stages = append(report.Stages, DiagnosisStage{
+			Name:    DiagnosisStageTCP,
+			Success: true,
+			Skipped: true,
+			Detail:  "server is reached over UDP",
+		})
+	} else if ok {
+		ok = run(DiagnosisStageTCP, func(ctx context.Context) (string, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", serverAddr)
+			if err != nil {
+				return "", fmt.Errorf("failed to connect to %s: %w", serverAddr, err)
+			}
+			defer conn.Close()
+			return "connected to " + conn.RemoteAddr().String(), nil
+		})
+	}
+
+	// The ephemeral core is kept from the handshake to the HTTP stage
+	var dial proxyDialFunc
+	var closeCore func()
+	if ok {
+		ok = run(DiagnosisStageHandshake, func(ctx context.Context) (string, error) {
+			var err error
+			if dial, closeCore, err = newDialer(); err != nil {
+				return "", err
+			}
+			return diagnosisHandshake(ctx, dial, report.TestURL)
+		})
+	}
+	if closeCore != nil {
+		defer closeCore()
+	}
+
+	if ok {
+		ok = run(DiagnosisStageHTTP, func(ctx context.Context) (string, error) {
+			client := &http.Client{
+				Transport: &http.Transport{
+					DisableKeepAlives: true,
+					DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+						return dial(ctx, addr)
+					},
+				},
+				Timeout: diagnoseStageTimeout,
+			}
+			latency, err := probeHTTP(ctx, client, report.TestURL)
+			if err != nil {
+				return "", fmt.Errorf("request to %s failed: %w", report.TestURL, err)
+			}
+			return fmt.Sprintf("latency %dms", latency), nil
+		})
+	}
+	report.Success = ok
+
+	if ok {
+		log.Printf("Connection diagnosis for %s passed", report.Proxy)
+	} else {
+		log.Printf("Connection diagnosis for %s failed at %s stage", report.Proxy, report.FailedStage)
+	}
+	return report, nil
+}
+
+// diagnosisXrayDialer starts an ephemeral Xray instance with the outbound
+// tagged tag, and the outbounds it chains through, and no inbounds.
+func diagnosisXrayDialer(config map[string]interface{}, tag string) (proxyDialFunc, func(), error) {
+	configBytes, err := json.Marshal(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	probeConfig, err := buildOutboundProbeConfig(configBytes, tag)
+	if err != nil {
+		return nil, nil, err
+	}
+	xrayConfig, err := serial.LoadJSONConfig(bytes.NewReader(probeConfig))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid outbound %q: %w", tag, err)
+	}
+	instance, err := core.New(xrayConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create instance: %w", err)
+	}
+	if err := instance.Start(); err != nil {
+		instance.Close()
+		return nil, nil, fmt.Errorf("failed to start instance: %w", err)
+	}
+	dial := func(ctx context.Context, addr string) (net.Conn, error) {
+		return xrayDial(ctx, instance, addr)
+	}
+	return dial, func() { instance.Close() }, nil
+}
+
+// diagnosisMihomoDialer creates the Mihomo proxy on its own, without
+// applying a config.
+func diagnosisMihomoDialer(mapping map[string]interface{}) (proxyDialFunc, func(), error) {
+	proxy, err := adapter.ParseProxy(copyConfigMap(mapping))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid Mihomo proxy: %w", err)
+	}
+	dial := func(ctx context.Context, addr string) (net.Conn, error) {
+		metadata := &C.Metadata{NetWork: C.TCP}
+		if err := metadata.SetRemoteAddress(addr); err != nil {
+			return nil, err
+		}
+		return proxy.DialContext(ctx, metadata)
+	}
+	return dial, func() { proxy.Close() }, nil
+}
+
+// diagnosisHandshake opens a connection to the test host through the proxy.
+// Some protocols only talk to the server once data is sent, so for an
+// https URL a TLS handshake with the test host is completed as well.
+func diagnosisHandshake(ctx context.Context, dial proxyDialFunc, testURL string) (string, error) {
+	u, err := url.Parse(testURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid test URL: %w", err)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	addr := net.JoinHostPort(u.Hostname(), port)
+
+	conn, err := dial(ctx, addr)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to %s through the proxy: %w", addr, err)
+	}
+	defer conn.Close()
+	if u.Scheme != "https" {
+		return "connected to " + addr, nil
+	}
+
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return "", fmt.Errorf("TLS handshake with %s through the proxy failed: %w", addr, err)
+	}
+	return "connected to " + addr + " and completed TLS", nil
+}
+
+// xrayOutboundServer returns the first server address and port of an Xray
+// proxy outbound.
+func xrayOutboundServer(outbound map[string]interface{}) (string, int) {
+	settings, _ := outbound["settings"].(map[string]interface{})
+	if vnext := configMaps(settings, "vnext"); len(vnext) > 0 {
+		return stringValue(vnext[0]["address"]), configPort(vnext[0]["port"])
+	}
+	if servers := configMaps(settings, "servers"); len(servers) > 0 {
+		return stringValue(servers[0]["address"]), configPort(servers[0]["port"])
+	}
+	if peers := configMaps(settings, "peers"); len(peers) > 0 {
+		host, port, err := net.SplitHostPort(stringValue(peers[0]["endpoint"]))
+		if err != nil {
+			return "", 0
+		}
+		return host, configPort(port)
+	}
+	return stringValue(settings["address"]), configPort(settings["port"])
+}
@@ -0,0 +1,209 @@
+package libunifiedcore
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// redactedValue replaces secrets in exported configs.
+const redactedValue = "REDACTED"
+
+// secretConfigKeys are config keys (Xray and Mihomo spellings) whose values
+// are credentials.
+var secretConfigKeys = map[string]bool{
+	"password":        true,
+	"passwd":          true,
+	"pass":            true,
+	"user":            true,
+	"username":        true,
+	"uuid":            true,
+	"id":              true,
+	"psk":             true,
+	"auth":            true,
+	"auth-str":        true,
+	"auth_str":        true,
+	"token":           true,
+	"secret":          true,
+	"privatekey":      true,
+	"private-key":     true,
+	"pre-shared-key":  true,
+	"presharedkey":    true,
+	"shortid":         true,
+	"short-id":        true,
+	"obfs-password":   true,
+	"seed":            true,
+	"authorization":   true,
+	"x-authorization": true,
+}
+
+// ExportDiagnostics writes a zip bundle for bug reports to destPath with the
+// recent logs, the effective config with credentials redacted, runtime info
+// and the manager stats. Logs are only available while SetLogCapture is
+// enabled; URLs in them have their credentials and query redacted.
+func (u *UnifiedCoreManager) ExportDiagnostics(destPath string) error {
+	lines := recentLogs.snapshot()
+	for i, line := range lines {
+		lines[i] = redactLogLine(line)
+	}
+	if len(lines) == 0 && !logCaptureEnabled() {
+		lines = []string{"log capture is disabled, see SetLogCapture"}
+	}
+	files := map[string][]byte{
+		"logs.txt": []byte(strings.Join(lines, "\n") + "\n"),
+	}
+
+	configBytes, err := u.redactedEffectiveConfig()
+	if err != nil {
+		configBytes = []byte(fmt.Sprintf("config unavailable: %v\n", err))
+	}
+	files["config.json"] = configBytes
+
+	files["runtime.json"] = []byte(GetRuntimeInfoJSON())
+
+	statsBytes, err := json.MarshalIndent(u.GetStats(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal stats: %w", err)
+	}
+	files["stats.json"] = statsBytes
+
+	out, err := os.Create(destPath)
+	if err != nil {
+		return fmt.Errorf("failed to create diagnostics bundle: %w", err)
+	}
+	defer out.Close()
+
+	zw := zip.NewWriter(out)
+	for _, name := range []string{"logs.txt", "config.json", "runtime.json", "stats.json"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			return fmt.Errorf("failed to add %s to bundle: %w", name, err)
+		}
+		if _, err := w.Write(files[name]); err != nil {
+			return fmt.Errorf("failed to write %s to bundle: %w", name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to finalize diagnostics bundle: %w", err)
+	}
+
+	log.Printf("Diagnostics bundle exported to: %s", destPath)
+	return nil
+}
+
+// redactedEffectiveConfig returns the last run config with the manager's
+// patches applied and credentials redacted.
+func (u *UnifiedCoreManager) redactedEffectiveConfig() ([]byte, error) {
+	u.mu.RLock()
+	configPath := u.configPath
+	coreType := u.coreType
+	patches := u.mihomoPatches.clone()
+	if coreType == CoreTypeV2Ray || coreType == CoreTypeXray {
+		patches = u.v2rayPatches.clone()
+	}
+	u.mu.RUnlock()
+
+	if configPath == "" {
+		return nil, fmt.Errorf("no config has been run")
+	}
+
+	raw, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(raw, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config JSON: %w", err)
+	}
+	if coreConfig, ok := config["coreConfig"].(map[string]interface{}); ok {
+		config = coreConfig
+	}
+	if err := patches.apply(config); err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(redactConfig(config), "", "  ")
+}
+
+// redactConfig replaces credential values and the credentials/query of URLs
+// (subscription links usually carry a token) throughout a decoded config.
+// Proxy provider URLs also have their path redacted, since subscription
+// services often put the token there.
+func redactConfig(node interface{}) interface{} {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		if providers, ok := v["proxy-providers"].(map[string]interface{}); ok {
+			for _, provider := range providers {
+				if provider, ok := provider.(map[string]interface{}); ok {
+					if link, ok := provider["url"].(string); ok {
+						provider["url"] = redactURLPath(link)
+					}
+				}
+			}
+		}
+		for key, value := range v {
+			if secretConfigKeys[strings.ToLower(key)] {
+				if _, isString := value.(string); isString {
+					v[key] = redactedValue
+					continue
+				}
+			}
+			v[key] = redactConfig(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redactConfig(value)
+		}
+	case string:
+		return redactURL(v)
+	}
+	return node
+}
+
+// redactLogLine redacts the URLs in a log line, e.g. share or subscription
+// links that were logged.
+func redactLogLine(line string) string {
+	if !strings.Contains(line, "://") {
+		return line
+	}
+	fields := strings.Fields(line)
+	for i, field := range fields {
+		fields[i] = redactURL(field)
+	}
+	return strings.Join(fields, " ")
+}
+
+func redactURL(s string) string {
+	if !strings.Contains(s, "://") {
+		return s
+	}
+	parsed, err := url.Parse(s)
+	if err != nil || (parsed.User == nil && parsed.RawQuery == "") {
+		return s
+	}
+	if parsed.User != nil {
+		parsed.User = url.User(redactedValue)
+	}
+	if parsed.RawQuery != "" {
+		parsed.RawQuery = redactedValue
+	}
+	return parsed.String()
+}
+
+// redactURLPath redacts the path of a URL along with what redactURL redacts.
+// A URL that cannot be parsed is redacted as a whole.
+func redactURLPath(s string) string {
+	parsed, err := url.Parse(s)
+	if err != nil || parsed.Host == "" {
+		return redactedValue
+	}
+	if parsed.Path != "" && parsed.Path != "/" {
+		parsed.Path = "/" + redactedValue
+		parsed.RawPath = ""
+	}
+	return redactURL(parsed.String())
+}
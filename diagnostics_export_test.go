@@ -0,0 +1,76 @@
+package libunifiedcore
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRedactConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{
+			name:   "Xray socks outbound users",
+			config: `{"outbounds":[{"protocol":"socks","settings":{"servers":[{"address":"example.com","users":[{"user":"alice","pass":"hunter2"}]}]}}]}`,
+			want:   `{"outbounds":[{"protocol":"socks","settings":{"servers":[{"address":"example.com","users":[{"pass":"REDACTED","user":"REDACTED"}]}]}}]}`,
+		},
+		{
+			name:   "Xray vless id",
+			config: `{"outbounds":[{"settings":{"vnext":[{"address":"example.com","users":[{"id":"b831381d-6324-4d53-ad4f-8cda48b30811","flow":"xtls-rprx-vision"}]}]}}]}`,
+			want:   `{"outbounds":[{"settings":{"vnext":[{"address":"example.com","users":[{"flow":"xtls-rprx-vision","id":"REDACTED"}]}]}}]}`,
+		},
+		{
+			name:   "Mihomo proxy credentials",
+			config: `{"proxies":[{"name":"p","type":"http","server":"example.com","username":"alice","password":"hunter2"}]}`,
+			want:   `{"proxies":[{"name":"p","password":"REDACTED","server":"example.com","type":"http","username":"REDACTED"}]}`,
+		},
+		{
+			name:   "Mihomo external controller secret",
+			config: `{"external-controller":"127.0.0.1:9090","secret":"abc"}`,
+			want:   `{"external-controller":"127.0.0.1:9090","secret":"REDACTED"}`,
+		},
+		{
+			name:   "proxy provider token in path",
+			config: `{"proxy-providers":{"sub":{"type":"http","url":"https://sub.example.com/api/v1/client/abcdef123456"}}}`,
+			want:   `{"proxy-providers":{"sub":{"type":"http","url":"https://sub.example.com/REDACTED"}}}`,
+		},
+		{
+			name:   "proxy provider token in query",
+			config: `{"proxy-providers":{"sub":{"type":"http","url":"https://sub.example.com/link?token=abcdef"}}}`,
+			want:   `{"proxy-providers":{"sub":{"type":"http","url":"https://sub.example.com/REDACTED?REDACTED"}}}`,
+		},
+		{
+			name:   "other URL keeps its path",
+			config: `{"rule-providers":{"ads":{"type":"http","url":"https://rules.example.com/ads.yaml"}}}`,
+			want:   `{"rule-providers":{"ads":{"type":"http","url":"https://rules.example.com/ads.yaml"}}}`,
+		},
+		{
+			name:   "URL credentials",
+			config: `{"dns":{"servers":["https://user:pw@dns.example.com/dns-query"]}}`,
+			want:   `{"dns":{"servers":["https://REDACTED@dns.example.com/dns-query"]}}`,
+		},
+		{
+			name:   "non-string secret left alone",
+			config: `{"inbounds":[{"port":1080,"settings":{"auth":{"mode":"noauth"}}}]}`,
+			want:   `{"inbounds":[{"port":1080,"settings":{"auth":{"mode":"noauth"}}}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config interface{}
+			if err := json.Unmarshal([]byte(tt.config), &config); err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.Marshal(redactConfig(config))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("redactConfig(%s)\n got %s\nwant %s", tt.config, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package libunifiedcore
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+)
+
+// SetEphemeralMode keeps the state a core writes while running out of the
+// home directory. Each start gets a fresh temp dir that is removed when the
+// core stops: Xray access/error logs and the Mihomo log file are redirected
+// there, Mihomo's cache.db is opened there and storing selections and fake-ip
+// mappings is turned off. The config file itself is never modified. Takes
+// effect on the next start.
+func (u *UnifiedCoreManager) SetEphemeralMode(enabled bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.ephemeral = enabled
+	if !enabled {
+		u.v2rayPatches.set("ephemeral", nil)
+		u.mihomoPatches.set("ephemeral", nil)
+	}
+	log.Printf("Ephemeral mode: %v", enabled)
+}
+
+// prepareEphemeralLocked creates the state dir for the next start and points
+// both cores' state at it. It returns "" when ephemeral mode is off. Callers
+// must hold u.mu.
+func (u *UnifiedCoreManager) prepareEphemeralLocked() (string, error) {
+	u.ephemeralDir = ""
+	if !u.ephemeral {
+		return "", nil
+	}
+
+	dir, err := globalTempDirs.MkdirTemp("unifiedcore-ephemeral-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create ephemeral state dir: %w", err)
+	}
+	redirect := func(path string) string {
+		if path == "" || path == "none" {
+			return path
+		}
+		return filepath.Join(dir, filepath.Base(path))
+	}
+
+	u.v2rayPatches.set("ephemeral", func(config map[string]interface{}) error {
+		logSection, ok := config["log"].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for _, key := range []string{"access", "error"} {
+			if path, ok := logSection[key].(string); ok {
+				logSection[key] = redirect(path)
+			}
+		}
+		return nil
+	})
+	u.mihomoPatches.set("ephemeral", func(config map[string]interface{}) error {
+		if path, ok := config["log-file"].(string); ok {
+			config["log-file"] = redirect(path)
+		}
+		profile := configSection(config, "profile")
+		profile["store-selected"] = false
+		profile["store-fake-ip"] = false
+		return nil
+	})
+
+	u.ephemeralDir = dir
+	log.Printf("Ephemeral state dir: %s", dir)
+	return dir, nil
+}
+
+// adoptEphemeralDirLocked hands the state dir to the started core's manager,
+// which removes it on Stop. Callers must hold u.mu.
+func (u *UnifiedCoreManager) adoptEphemeralDirLocked(dir string) {
+	switch u.coreType {
+	case CoreTypeV2Ray, CoreTypeXray:
+		if u.v2rayManager != nil {
+			u.v2rayManager.RegisterTempDir(dir)
+			return
+		}
+	case CoreTypeMihomo:
+		if u.mihomoManager != nil {
+			u.mihomoManager.RegisterTempDir(dir)
+			return
+		}
+	}
+	if err := globalTempDirs.Remove(dir); err != nil {
+		log.Printf("Failed to remove ephemeral state dir %s: %v", dir, err)
+	}
+}
@@ -0,0 +1,153 @@
+package libunifiedcore
+
+import (
+	"log"
+	"time"
+
+	"github.com/metacubex/mihomo/hub/executor"
+	"github.com/metacubex/mihomo/tunnel/statistic"
+)
+
+// forceStopTimeout is how long ForceStop waits for the graceful stop before
+// abandoning the core.
+const forceStopTimeout = 2 * time.Second
+
+// stopTimeout bounds a graceful core stop made under u.mu; a core that takes
+// longer is abandoned so that it does not wedge the manager with it. It is a
+// variable so tests can shorten it.
+var stopTimeout = 10 * time.Second
+
+// ForceStop stops the core even when the graceful path hangs, so that a
+// following RunConfig can start fresh. It gives the cores forceStopTimeout to
+// stop, then closes Mihomo's listeners and connections, cancels contexts
+// and drops the core managers; a new manager is created on the next start.
+// A Stop already stuck on the core holds the manager for at most stopTimeout.
+//
+// A wedged Xray instance is closed in the background and abandoned; if it
+// still holds its ports, the next start on the same ports fails.
+func (u *UnifiedCoreManager) ForceStop() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	log.Printf("Force stop requested for %s core", u.coreType.DisplayName())
+	u.flushTrafficStatsLocked()
+
+	v2rayManager, mihomoManager := u.v2rayManager, u.mihomoManager
+	stopped, _ := stopWithin(func() error {
+		if v2rayManager != nil {
+			v2rayManager.Stop()
+		}
+		if mihomoManager != nil {
+			mihomoManager.Stop()
+		}
+		return nil
+	}, forceStopTimeout)
+	if !stopped {
+		log.Printf("Graceful stop did not finish within %v, abandoning core", forceStopTimeout)
+	}
+
+	if v2rayManager != nil {
+		u.abandonV2RayLocked()
+	}
+	if mihomoManager != nil || u.coreType == CoreTypeMihomo {
+		u.abandonMihomoLocked()
+	}
+
+	if u.cancel != nil {
+		u.cancel()
+		u.cancel = nil
+	}
+	u.releaseKillSwitchLocked()
+	u.closeSOCKSFrontLocked()
+	u.running = false
+	u.configPath = ""
+
+	log.Printf("%s core force-stopped", u.coreType.DisplayName())
+	return nil
+}
+
+// stopWithin runs stop in the background and waits up to timeout for it. It
+// reports false, leaving stop running, when the timeout passes first.
+func stopWithin(stop func() error, timeout time.Duration) (bool, error) {
+	result := make(chan error, 1)
+	go func() {
+		result <- stop()
+	}()
+
+	select {
+	case err := <-result:
+		return true, err
+	case <-time.After(timeout):
+		return false, nil
+	}
+}
+
+// abandonV2RayLocked drops the V2Ray manager without waiting on it; a new
+// manager is created on the next start.
+func (u *UnifiedCoreManager) abandonV2RayLocked() {
+	if u.v2rayManager == nil {
+		return
+	}
+	u.v2rayManager.forceStop()
+	if globalV2RayManager == u.v2rayManager {
+		globalV2RayManager = nil
+	}
+	u.v2rayManager = nil
+}
+
+// abandonMihomoLocked is the Mihomo counterpart of abandonV2RayLocked.
+func (u *UnifiedCoreManager) abandonMihomoLocked() {
+	if u.mihomoManager != nil {
+		u.mihomoManager.forceStop()
+	}
+	if globalMihomoManager == u.mihomoManager {
+		globalMihomoManager = nil
+	}
+	u.mihomoManager = nil
+
+	// Mihomo's Stop leaves listeners and connections to the next config;
+	// tear them down so nothing is left bound.
+	executor.Shutdown()
+	statistic.DefaultManager.Range(func(t statistic.Tracker) bool {
+		t.Close()
+		return true
+	})
+}
+
+// forceStop resets the manager without waiting on a lock held by a stuck
+// operation; in that case the manager is left as is for the caller to drop.
+func (m *MihomoCoreManager) forceStop() {
+	if !m.mu.TryLock() {
+		log.Println("Mihomo manager is locked by a stuck operation, dropping it")
+		return
+	}
+	defer m.mu.Unlock()
+
+	if m.cancel != nil {
+		m.cancel()
+		m.cancel = nil
+	}
+	m.stopLogSubscription()
+	m.removeTempDirsLocked()
+	m.isRunning = false
+}
+
+// forceStop is the V2Ray counterpart of MihomoCoreManager.forceStop. The
+// instance is closed in the background since Close itself may hang.
+func (v *V2RayCoreManager) forceStop() {
+	if !v.mu.TryLock() {
+		log.Println("V2Ray manager is locked by a stuck operation, dropping it")
+		return
+	}
+	defer v.mu.Unlock()
+
+	if v.cancel != nil {
+		v.cancel()
+	}
+	if instance := v.instance; instance != nil {
+		v.instance = nil
+		go instance.Close()
+	}
+	v.removeTempDirsLocked()
+	v.isRunning = false
+}
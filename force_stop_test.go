@@ -0,0 +1,72 @@
+package libunifiedcore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestForceStopBehindWedgedStop(t *testing.T) {
+	saved := stopTimeout
+	stopTimeout = 500 * time.Millisecond
+	t.Cleanup(func() { stopTimeout = saved })
+
+	dir := t.TempDir()
+	u := NewUnifiedCoreManager()
+	if err := u.RunConfig(writeXrayConfig(t, dir, "config.json", freePort(t))); err != nil {
+		t.Fatalf("RunConfig: %v", err)
+	}
+	t.Cleanup(func() { u.Stop() })
+
+	// Holding the V2Ray manager makes its Stop hang like a wedged Close
+	u.mu.RLock()
+	wedged := u.v2rayManager
+	u.mu.RUnlock()
+	wedged.mu.Lock()
+	t.Cleanup(wedged.mu.Unlock)
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- u.Stop() }()
+	stopHoldsManager := func() bool {
+		if u.mu.TryRLock() {
+			u.mu.RUnlock()
+			return false
+		}
+		return true
+	}
+	if !waitFor(5*time.Second, stopHoldsManager) {
+		t.Fatal("Stop did not start")
+	}
+
+	forced := make(chan error, 1)
+	go func() { forced <- u.ForceStop() }()
+	select {
+	case err := <-forced:
+		if err != nil {
+			t.Fatalf("ForceStop: %v", err)
+		}
+	case <-time.After(stopTimeout + forceStopTimeout + 5*time.Second):
+		t.Fatal("ForceStop blocked behind the wedged Stop")
+	}
+	select {
+	case err := <-stopped:
+		if err == nil {
+			t.Error("Stop of a wedged core reported success")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not return after abandoning the core")
+	}
+	if u.IsRunning() {
+		t.Fatal("core still reported running after ForceStop")
+	}
+
+	// The wedged instance may still hold its port; start fresh on another
+	if err := u.RunConfig(writeXrayConfig(t, dir, "next.json", freePort(t))); err != nil {
+		t.Fatalf("RunConfig after ForceStop: %v", err)
+	}
+	u.mu.RLock()
+	fresh := u.v2rayManager
+	u.mu.RUnlock()
+	if fresh == wedged {
+		t.Error("RunConfig reused the abandoned manager")
+	}
+}
@@ -0,0 +1,132 @@
+package libunifiedcore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// geoDBFiles are the geo databases either core loads from the asset
+// directory, lower-cased.
+var geoDBFiles = map[string]bool{
+	"geoip.dat":    true,
+	"geosite.dat":  true,
+	"country.mmdb": true,
+	"geoip.metadb": true,
+	"asn.mmdb":     true,
+}
+
+// mmdbMetadataMarker precedes the metadata section at the end of a MaxMind
+// database.
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// GeoDBFile describes one geo database in the asset directory.
+type GeoDBFile struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Valid   bool      `json:"valid"`
+	Error   string    `json:"error,omitempty"` // why the file is not valid
+}
+
+// GeoDBInfo lists the geo databases found in the asset directory.
+type GeoDBInfo struct {
+	AssetPath string      `json:"assetPath"`
+	Files     []GeoDBFile `json:"files"`
+}
+
+// GetGeoDBInfo reports the geoip/geosite/ASN databases in the asset
+// directory with their size, modification time and a quick validity check
+// of the file header, so corrupt files are caught before they show up as
+// routing failures.
+func (u *UnifiedCoreManager) GetGeoDBInfo() (*GeoDBInfo, error) {
+	u.mu.RLock()
+	assetPath := u.assetPath
+	u.mu.RUnlock()
+
+	if assetPath == "" {
+		assetPath, _ = os.Getwd()
+	}
+	entries, err := os.ReadDir(assetPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read asset directory: %w", err)
+	}
+
+	info := &GeoDBInfo{AssetPath: assetPath, Files: []GeoDBFile{}}
+	for _, entry := range entries {
+		if entry.IsDir() || !geoDBFiles[strings.ToLower(entry.Name())] {
+			continue
+		}
+		path := filepath.Join(assetPath, entry.Name())
+		file := GeoDBFile{Name: entry.Name(), Path: path}
+		if stat, err := entry.Info(); err == nil {
+			file.Size = stat.Size()
+			file.ModTime = stat.ModTime()
+		}
+		if err := checkGeoDBFile(path); err != nil {
+			file.Error = err.Error()
+		} else {
+			file.Valid = true
+		}
+		info.Files = append(info.Files, file)
+	}
+	sort.Slice(info.Files, func(i, j int) bool { return info.Files[i].Name < info.Files[j].Name })
+	return info, nil
+}
+
+// checkGeoDBFile does a cheap format check: .dat files must start with a
+// complete protobuf list entry, .mmdb/.metadb files must carry the MaxMind
+// metadata marker near their end.
+func checkGeoDBFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if stat.Size() == 0 {
+		return fmt.Errorf("file is empty")
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".dat") {
+		header := make([]byte, 11)
+		n, err := io.ReadFull(f, header)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		// Field 1, wire type 2: the first GeoIP/GeoSite entry of the list
+		if header[0] != 0x0a {
+			return fmt.Errorf("not a geo data file")
+		}
+		length, size := binary.Uvarint(header[1:n])
+		if size <= 0 || int64(length) > stat.Size()-int64(1+size) {
+			return fmt.Errorf("truncated geo data file")
+		}
+		return nil
+	}
+
+	// The metadata section is at most 128 KiB from the end of the file
+	tail := stat.Size()
+	if tail > 128<<10 {
+		tail = 128 << 10
+	}
+	buf := make([]byte, tail)
+	if _, err := f.ReadAt(buf, stat.Size()-tail); err != nil && err != io.EOF {
+		return err
+	}
+	if !bytes.Contains(buf, mmdbMetadataMarker) {
+		return fmt.Errorf("MaxMind metadata not found")
+	}
+	return nil
+}
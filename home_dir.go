@@ -0,0 +1,97 @@
+package libunifiedcore
+
+import (
+	"log"
+	"os"
+	"sync"
+)
+
+// Asset location is process-global in both cores: Xray resolves geo files
+// through the xray.location.asset / v2ray.location.asset environment
+// variables and Mihomo through constant.Path. The package-level SetHomeDir
+// and SetEnv change these for every manager immediately. The per-manager
+// variants below only record the directory on the manager and apply it for
+// the duration of that manager's own startup.
+//
+// Limitations: for Xray the env vars are swapped in and restored around
+// config loading, so two managers starting at the same time are serialized
+// rather than isolated. Mihomo keeps the home dir for its whole run, so only
+// one Mihomo home dir can be active per process.
+
+// assetEnvMu serializes windows in which a manager points the Xray asset env
+// vars at its own directory.
+var assetEnvMu sync.Mutex
+
+var assetEnvKeys = []string{"v2ray.location.asset", "xray.location.asset"}
+
+// withAssetEnv runs fn with the Xray asset env vars set to dir and restores
+// their previous values afterwards.
+func withAssetEnv(dir string, fn func()) {
+	assetEnvMu.Lock()
+	defer assetEnvMu.Unlock()
+
+	type saved struct {
+		value  string
+		exists bool
+	}
+	previous := make(map[string]saved, len(assetEnvKeys))
+	for _, key := range assetEnvKeys {
+		value, exists := os.LookupEnv(key)
+		previous[key] = saved{value, exists}
+		os.Setenv(key, dir)
+	}
+
+	defer func() {
+		for key, p := range previous {
+			if p.exists {
+				os.Setenv(key, p.value)
+			} else {
+				os.Unsetenv(key)
+			}
+		}
+	}()
+
+	fn()
+}
+
+// SetHomeDirForManager sets the asset directory used by this manager only,
+// without changing the process environment outside of its own startup.
+func (v *V2RayCoreManager) SetHomeDirForManager(homeDir string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.assetPath = homeDir
+	v.scopedHomeDir = true
+	log.Printf("V2Ray manager home dir set to: %s (scoped)", homeDir)
+}
+
+// loadWithAssetEnv runs fn with this manager's asset directory visible to
+// Xray, scoped when set through SetHomeDirForManager.
+func (v *V2RayCoreManager) loadWithAssetEnv(fn func()) {
+	v.mu.RLock()
+	dir, scoped := v.assetPath, v.scopedHomeDir
+	v.mu.RUnlock()
+
+	if !scoped || dir == "" {
+		fn()
+		return
+	}
+	withAssetEnv(dir, fn)
+}
+
+// SetHomeDirForManager sets the home directory used by this manager only.
+// Unlike the package-level SetHomeDir it does not touch environment variables;
+// the directory is handed to Mihomo when this manager starts.
+func (m *MihomoCoreManager) SetHomeDirForManager(homeDir string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.assetPath = homeDir
+}
+
+// SetHomeDirForManager sets the asset/home directory for the cores started by
+// this manager without the process-wide side effects of SetHomeDir.
+func (u *UnifiedCoreManager) SetHomeDirForManager(homeDir string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.assetPath = homeDir
+	u.scopedHomeDir = true
+}
@@ -0,0 +1,282 @@
+package libunifiedcore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/metacubex/mihomo/listener"
+)
+
+const (
+	// killSwitchInterval is how often the kill switch checks that the core
+	// is still up.
+	killSwitchInterval = 500 * time.Millisecond
+
+	// killSwitchProbeTimeout bounds one liveness probe of the SOCKS port.
+	killSwitchProbeTimeout = time.Second
+
+	// killSwitchProbeFailures is how many probes in a row must fail before
+	// the core is considered down, so one slow answer does not engage it.
+	killSwitchProbeFailures = 3
+)
+
+// EnableKillSwitch makes the manager block traffic when the core stops
+// serving without Stop being called, so apps using the proxy fail closed
+// instead of reaching a stale or foreign listener. The core is considered
+// down when its goroutine has exited or its SOCKS port stops answering a
+// SOCKS handshake. The SOCKS port is then held by a listener that rejects
+// every connection, and in TUN mode the packets of the tun device set with
+// SetTunFD are read and dropped. Planned restarts (Restart, UpdateDNS) do
+// not engage it. The switch is released when RunConfig starts a new core and
+// by Stop, since a user-initiated stop must not block traffic. Disabling it
+// releases an engaged switch immediately.
+func (u *UnifiedCoreManager) EnableKillSwitch(enabled bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.killSwitchEnabled = enabled
+	if enabled {
+		u.startKillSwitchLocked()
+		log.Println("Kill switch enabled")
+		return
+	}
+	if u.killSwitchCancel != nil {
+		u.killSwitchCancel()
+		u.killSwitchCancel = nil
+	}
+	u.releaseKillSwitchLocked()
+	log.Println("Kill switch disabled")
+}
+
+// IsKillSwitchEngaged reports whether the core went down and connections on
+// the SOCKS port are being rejected.
+func (u *UnifiedCoreManager) IsKillSwitchEngaged() bool {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.killSwitchEngaged
+}
+
+// startKillSwitchLocked (re)starts the core watcher for the current run.
+// Callers must hold u.mu.
+func (u *UnifiedCoreManager) startKillSwitchLocked() {
+	if u.killSwitchCancel != nil {
+		u.killSwitchCancel()
+		u.killSwitchCancel = nil
+	}
+	if !u.killSwitchEnabled || !u.running || u.ctx == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(u.ctx)
+	u.killSwitchCancel = cancel
+	go u.watchCoreExit(ctx)
+}
+
+func (u *UnifiedCoreManager) watchCoreExit(ctx context.Context) {
+	ticker := time.NewTicker(killSwitchInterval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if u.coreAlive() {
+			failures = 0
+			continue
+		}
+		failures++
+		if failures >= killSwitchProbeFailures && u.engageKillSwitch(ctx) {
+			return
+		}
+	}
+}
+
+// coreExited reports whether the core the manager started is no longer
+// running.
+func (u *UnifiedCoreManager) coreExited() bool {
+	u.mu.RLock()
+	coreType := u.coreType
+	v2rayManager := u.v2rayManager
+	mihomoManager := u.mihomoManager
+	u.mu.RUnlock()
+
+	switch coreType {
+	case CoreTypeV2Ray, CoreTypeXray:
+		return v2rayManager == nil || v2rayManager.exited()
+	case CoreTypeMihomo:
+		return mihomoManager == nil || mihomoManager.exited()
+	default:
+		return false
+	}
+}
+
+// coreAlive reports whether the core is still serving: it has not exited
+// and its SOCKS port completes a handshake.
+func (u *UnifiedCoreManager) coreAlive() bool {
+	if u.coreExited() {
+		return false
+	}
+
+	u.mu.RLock()
+	coreType := u.coreType
+	socksPort := u.socksPort
+	v2rayManager := u.v2rayManager
+	u.mu.RUnlock()
+
+	if socksPort == 0 {
+		return true
+	}
+	// An http inbound does not speak SOCKS, accepting is all it shows
+	handshake := true
+	if (coreType == CoreTypeV2Ray || coreType == CoreTypeXray) && v2rayManager != nil {
+		handshake = v2rayManager.socksInboundProtocol() != "http"
+	}
+	return probeSOCKS(socksPort, handshake, killSwitchProbeTimeout) == nil
+}
+
+// probeSOCKS connects to the local SOCKS port and, with handshake set, sends
+// a SOCKS5 greeting and waits for the method selection reply. An answer of
+// any method, including "no acceptable methods", shows the core is serving.
+func probeSOCKS(port int, handshake bool, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if !handshake {
+		return nil
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write([]byte{0x05, 0x01, 0x00}); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 0x05 {
+		return fmt.Errorf("unexpected SOCKS reply version %d", reply[0])
+	}
+	return nil
+}
+
+// engageKillSwitch reports false when the core is down for a planned
+// restart, so the watcher keeps checking.
+func (u *UnifiedCoreManager) engageKillSwitch(ctx context.Context) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.killSwitchSuspended > 0 {
+		return false
+	}
+	// Stop cancels ctx under u.mu, so a user-initiated stop never gets here
+	if ctx.Err() != nil || u.killSwitchEngaged {
+		return true
+	}
+	u.killSwitchEngaged = true
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(u.socksPort))
+	if u.socksFront != nil {
+		// A soft restart forwarder owns the port, make it reject instead
+		u.socksFront.setBackend(0)
+	} else if l, err := net.Listen("tcp", addr); err != nil {
+		log.Printf("Core stopped unexpectedly, kill switch could not bind %s: %v", addr, err)
+	} else {
+		u.killSwitchListener = l
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				conn.Close()
+			}
+		}()
+	}
+
+	if u.tunFD > 0 {
+		stop := make(chan struct{})
+		if err := blackholeTun(u.tunFD, stop); err != nil {
+			log.Printf("Core stopped unexpectedly, kill switch could not blackhole the tun device: %v", err)
+		} else {
+			u.killSwitchTunStop = stop
+		}
+	}
+	log.Printf("Core stopped unexpectedly, kill switch engaged on %s", addr)
+	return true
+}
+
+// suspendKillSwitch keeps the kill switch from engaging while the core is
+// down for a planned restart, until the returned func is called.
+func (u *UnifiedCoreManager) suspendKillSwitch() (resume func()) {
+	u.mu.Lock()
+	u.killSwitchSuspended++
+	u.mu.Unlock()
+
+	return func() {
+		u.mu.Lock()
+		u.killSwitchSuspended--
+		u.mu.Unlock()
+	}
+}
+
+// releaseKillSwitchLocked frees the SOCKS port and the tun device held by an
+// engaged kill switch. Callers must hold u.mu.
+func (u *UnifiedCoreManager) releaseKillSwitchLocked() {
+	if !u.killSwitchEngaged {
+		return
+	}
+	if u.killSwitchListener != nil {
+		u.killSwitchListener.Close()
+		u.killSwitchListener = nil
+	}
+	if u.killSwitchTunStop != nil {
+		close(u.killSwitchTunStop)
+		u.killSwitchTunStop = nil
+	}
+	u.killSwitchEngaged = false
+	log.Println("Kill switch released")
+}
+
+// exited reports whether the core goroutine has returned.
+func (v *V2RayCoreManager) exited() bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return !v.isRunning
+}
+
+// socksInboundProtocol returns the protocol of the inbound GetBoundSOCKSPort
+// reports, "" if the config has none.
+func (v *V2RayCoreManager) socksInboundProtocol() string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.socksInbound.protocol
+}
+
+// exited reports whether the core has come up and lost all its listeners.
+// Mihomo keeps running in-process once applied, so this mostly catches a
+// config whose listeners failed to start.
+func (m *MihomoCoreManager) exited() bool {
+	m.mu.RLock()
+	running, done := m.isRunning, m.timings.Done
+	m.mu.RUnlock()
+
+	if !running {
+		return true
+	}
+	if !done {
+		return false
+	}
+	ports := listener.GetPorts()
+	return ports.MixedPort == 0 && ports.SocksPort == 0 && ports.Port == 0 && !listener.LastTunConf.Enable
+}
@@ -0,0 +1,52 @@
+//go:build unix
+
+package libunifiedcore
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// tunBlackholePollMs is how often the blackhole checks whether it was
+// released while no packets arrive.
+const tunBlackholePollMs = 100
+
+// blackholeTun reads and drops the packets of the tun device fd until stop
+// is closed, so traffic routed into the tunnel fails instead of queueing
+// for a core that is down. It reads from a duplicate of fd, which leaves
+// the platform's descriptor and its flags untouched.
+func blackholeTun(fd int, stop <-chan struct{}) error {
+	dup, err := syscall.Dup(fd)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer syscall.Close(dup)
+
+		packet := make([]byte, 65535)
+		fds := []unix.PollFd{{Fd: int32(dup), Events: unix.POLLIN}}
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			n, err := unix.Poll(fds, tunBlackholePollMs)
+			if err == unix.EINTR {
+				continue
+			}
+			if err != nil {
+				return
+			}
+			if n == 0 {
+				continue
+			}
+			if _, err := syscall.Read(dup, packet); err != nil && err != syscall.EAGAIN && err != syscall.EINTR {
+				return
+			}
+		}
+	}()
+	return nil
+}
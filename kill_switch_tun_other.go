@@ -0,0 +1,11 @@
+//go:build !unix
+
+package libunifiedcore
+
+import "fmt"
+
+// blackholeTun is not supported here; tun file descriptors only come from
+// the Android and iOS VPN services.
+func blackholeTun(fd int, stop <-chan struct{}) error {
+	return fmt.Errorf("tun blackhole is not supported on this platform")
+}
@@ -0,0 +1,108 @@
+package libunifiedcore
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/metacubex/mihomo/common/observable"
+	mihomolog "github.com/metacubex/mihomo/log"
+)
+
+// logBufferSize is the number of recent log lines kept in memory for
+// diagnostics bundles.
+const logBufferSize = 1000
+
+// logRing keeps the last lines written to it.
+type logRing struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}
+
+func newLogRing(size int) *logRing {
+	return &logRing{lines: make([]string, size)}
+}
+
+// recentLogs collects the standard logger's output and Mihomo's log events
+// while log capture is enabled, see SetLogCapture.
+var recentLogs = newLogRing(logBufferSize)
+
+// logCapture is the state of SetLogCapture.
+var logCapture struct {
+	mu         sync.Mutex
+	prevOutput io.Writer
+	subscriber observable.Subscription[mihomolog.Event]
+}
+
+// SetLogCapture starts or stops keeping the last log lines in memory for
+// ExportDiagnostics. While enabled, the standard logger also writes to the
+// buffer and Mihomo's log events are collected; disabling restores the
+// previous log output. Capture is off by default, so importing the package
+// leaves the host app's logger alone.
+func SetLogCapture(enabled bool) {
+	logCapture.mu.Lock()
+	defer logCapture.mu.Unlock()
+
+	if enabled == (logCapture.prevOutput != nil) {
+		return
+	}
+	if !enabled {
+		log.SetOutput(logCapture.prevOutput)
+		logCapture.prevOutput = nil
+		mihomolog.UnSubscribe(logCapture.subscriber)
+		logCapture.subscriber = nil
+		return
+	}
+
+	logCapture.prevOutput = log.Writer()
+	log.SetOutput(io.MultiWriter(logCapture.prevOutput, recentLogs))
+	subscriber := mihomolog.Subscribe()
+	logCapture.subscriber = subscriber
+	go func() {
+		// Ends when the subscription is closed by UnSubscribe
+		for event := range subscriber {
+			recentLogs.add(fmt.Sprintf("%s [mihomo] %s: %s",
+				time.Now().Format("2006/01/02 15:04:05"), event.Type(), event.Payload))
+		}
+	}()
+}
+
+// logCaptureEnabled reports whether SetLogCapture is on.
+func logCaptureEnabled() bool {
+	logCapture.mu.Lock()
+	defer logCapture.mu.Unlock()
+	return logCapture.prevOutput != nil
+}
+
+// Write implements io.Writer so the ring can be used as a log output.
+func (r *logRing) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		r.add(line)
+	}
+	return len(p), nil
+}
+
+func (r *logRing) add(line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % len(r.lines)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// snapshot returns the buffered lines, oldest first.
+func (r *logRing) snapshot() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]string(nil), r.lines[:r.next]...)
+	}
+	return append(append([]string(nil), r.lines[r.next:]...), r.lines[:r.next]...)
+}
@@ -0,0 +1,48 @@
+package libunifiedcore
+
+import (
+	"encoding/json"
+	"fmt"
+
+	mihomolog "github.com/metacubex/mihomo/log"
+)
+
+// GetEffectiveLogLevel returns the log level the running core applied, which
+// comes from the config and can differ from the one passed to SetLogLevel.
+func (u *UnifiedCoreManager) GetEffectiveLogLevel() (string, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	if !u.running {
+		return "", fmt.Errorf("no core running")
+	}
+	switch u.coreType {
+	case CoreTypeV2Ray, CoreTypeXray:
+		if u.v2rayManager == nil {
+			return "", fmt.Errorf("V2Ray core is not running")
+		}
+		u.v2rayManager.mu.RLock()
+		defer u.v2rayManager.mu.RUnlock()
+		if u.v2rayManager.appliedLogLevel == "" {
+			return "", fmt.Errorf("V2Ray core has not loaded its config yet")
+		}
+		return u.v2rayManager.appliedLogLevel, nil
+	case CoreTypeMihomo:
+		return mihomolog.Level().String(), nil
+	}
+	return "", fmt.Errorf("unsupported core type: %v", u.coreType)
+}
+
+// xrayLogLevel returns log.loglevel of an Xray config, or Xray's default
+// when it is not set.
+func xrayLogLevel(configBytes []byte) string {
+	var config struct {
+		Log struct {
+			LogLevel string `json:"loglevel"`
+		} `json:"log"`
+	}
+	if err := json.Unmarshal(configBytes, &config); err != nil || config.Log.LogLevel == "" {
+		return "warning"
+	}
+	return config.Log.LogLevel
+}
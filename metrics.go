@@ -0,0 +1,108 @@
+package libunifiedcore
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/metacubex/mihomo/tunnel/statistic"
+)
+
+// StartMetricsServer serves Prometheus text-format metrics for the global
+// manager on addr (e.g. "127.0.0.1:9100") at /metrics. The returned stop
+// function shuts the server down.
+//
+// Xray only reports traffic when outbound stats are enabled (SetTrafficAlert
+// turns them on); connection counts are only available for Mihomo.
+func StartMetricsServer(addr string) (stop func(), err error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write([]byte(renderMetrics(GetGlobalManager())))
+	})
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("Metrics server stopped: %v", err)
+		}
+	}()
+	log.Printf("Metrics server listening on %s", listener.Addr())
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+		log.Println("Metrics server stopped")
+	}, nil
+}
+
+func renderMetrics(u *UnifiedCoreManager) string {
+	var b strings.Builder
+	metric := func(name, help, kind string, value interface{}, labels string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n%s%s %v\n", name, help, name, kind, name, labels, value)
+	}
+
+	stats := u.GetStats()
+	up := 0
+	if running, _ := stats["running"].(bool); running {
+		up = 1
+	}
+	metric("unifiedcore_core_up", "Whether a core is running.", "gauge", up,
+		fmt.Sprintf("{core=%q}", stats["core_type"]))
+
+	if upload, download, err := u.trafficTotals(); err == nil {
+		metric("unifiedcore_upload_bytes_total", "Bytes sent through the core.", "counter", upload, "")
+		metric("unifiedcore_download_bytes_total", "Bytes received through the core.", "counter", download, "")
+	}
+	if count, ok := u.connectionCount(); ok {
+		metric("unifiedcore_connections", "Currently tracked connections.", "gauge", count, "")
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	metric("unifiedcore_goroutines", "Number of goroutines.", "gauge", runtime.NumGoroutine(), "")
+	metric("unifiedcore_heap_alloc_bytes", "Allocated heap bytes.", "gauge", mem.HeapAlloc, "")
+	metric("unifiedcore_heap_sys_bytes", "Heap bytes obtained from the OS.", "gauge", mem.HeapSys, "")
+	return b.String()
+}
+
+// trafficTotals returns the running core's cumulative upload/download bytes.
+func (u *UnifiedCoreManager) trafficTotals() (int64, int64, error) {
+	u.mu.RLock()
+	running := u.running
+	source := u.trafficSourceLocked()
+	u.mu.RUnlock()
+
+	if !running {
+		return 0, 0, fmt.Errorf("no core running")
+	}
+	return source()
+}
+
+// connectionCount returns the number of open connections, when the running
+// core tracks them.
+func (u *UnifiedCoreManager) connectionCount() (int, bool) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	if !u.running || u.coreType != CoreTypeMihomo {
+		return 0, false
+	}
+	count := 0
+	statistic.DefaultManager.Range(func(statistic.Tracker) bool {
+		count++
+		return true
+	})
+	return count, true
+}
@@ -0,0 +1,299 @@
+package libunifiedcore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	mihomolog "github.com/metacubex/mihomo/log"
+	"github.com/metacubex/mihomo/tunnel/statistic"
+)
+
+const (
+	// connectionWatchInterval is how often the tracker list is scanned for
+	// new connections.
+	connectionWatchInterval = 250 * time.Millisecond
+
+	// connectionEventBuffer is how many connection events may queue up for
+	// a slow hook before new ones are dropped.
+	connectionEventBuffer = 256
+)
+
+// ConnectionInfo describes a connection tracked by Mihomo.
+type ConnectionInfo struct {
+	ID          string    `json:"id"`
+	Network     string    `json:"network"`
+	Type        string    `json:"type"`
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	Host        string    `json:"host"`
+	Process     string    `json:"process"`
+	Chain       []string  `json:"chain"`
+	Rule        string    `json:"rule"`
+	RulePayload string    `json:"rulePayload"`
+	Start       time.Time `json:"start"`
+}
+
+// SetOnConnection registers a hook called for every new connection tracked
+// by the running core, e.g. for an audit trail. Mihomo has no tracker
+// events, so connections are picked up by polling and ones that close
+// within connectionWatchInterval can be missed. The hook runs on its own
+// goroutine; if it falls behind, events past connectionEventBuffer are
+// dropped rather than slowing the core down. Pass nil to remove the hook.
+func (m *MihomoCoreManager) SetOnConnection(onConnection func(info ConnectionInfo)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.onConnection = onConnection
+	if m.isRunning {
+		m.startConnectionWatchLocked()
+	}
+}
+
+// startConnectionWatchLocked (re)starts the connection watcher when a hook
+// is set. Callers must hold m.mu.
+func (m *MihomoCoreManager) startConnectionWatchLocked() {
+	if m.connectionWatchCancel != nil {
+		m.connectionWatchCancel()
+		m.connectionWatchCancel = nil
+	}
+	if m.onConnection == nil || m.ctx == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.connectionWatchCancel = cancel
+
+	events := make(chan ConnectionInfo, connectionEventBuffer)
+	go dispatchConnections(ctx, events, m.onConnection)
+	go watchConnections(ctx, events)
+}
+
+func dispatchConnections(ctx context.Context, events <-chan ConnectionInfo, onConnection func(info ConnectionInfo)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case info := <-events:
+			onConnection(info)
+		}
+	}
+}
+
+func watchConnections(ctx context.Context, events chan<- ConnectionInfo) {
+	ticker := time.NewTicker(connectionWatchInterval)
+	defer ticker.Stop()
+
+	seen := make(map[string]bool)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		current := make(map[string]bool, len(seen))
+		dropped := 0
+		statistic.DefaultManager.Range(func(t statistic.Tracker) bool {
+			id := t.ID()
+			current[id] = true
+			if seen[id] {
+				return true
+			}
+			select {
+			case events <- connectionInfo(t):
+			default:
+				dropped++
+			}
+			return true
+		})
+		seen = current
+
+		if dropped > 0 {
+			mihomolog.Warnln("Connection hook is falling behind, dropped %d events", dropped)
+		}
+	}
+}
+
+func connectionInfo(t statistic.Tracker) ConnectionInfo {
+	info := t.Info()
+	connection := ConnectionInfo{
+		ID:          t.ID(),
+		Chain:       append([]string(nil), info.Chain...),
+		Rule:        info.Rule,
+		RulePayload: info.RulePayload,
+		Start:       info.Start,
+	}
+	if metadata := info.Metadata; metadata != nil {
+		connection.Network = metadata.NetWork.String()
+		connection.Type = metadata.Type.String()
+		connection.Source = metadata.SourceAddress()
+		connection.Destination = metadata.RemoteAddress()
+		connection.Host = metadata.Host
+		connection.Process = metadata.Process
+	}
+	return connection
+}
+
+// GetConnectionChain returns the proxies a tracked connection went through,
+// starting with the target of the matched rule (usually a group) and ending
+// with the proxy that dialed the destination, e.g. [Proxy, relay, exit].
+// Mihomo records the chain innermost first; it is reversed here.
+func (m *MihomoCoreManager) GetConnectionChain(id string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.isRunning {
+		return nil, fmt.Errorf("mihomo core is not running")
+	}
+	tracker := statistic.DefaultManager.Get(id)
+	if tracker == nil {
+		return nil, fmt.Errorf("connection not found: %s", id)
+	}
+
+	chain := tracker.Info().Chain
+	path := make([]string, len(chain))
+	for i, name := range chain {
+		path[len(chain)-1-i] = name
+	}
+	return path, nil
+}
+
+// SniffRecord is a domain the sniffer read from a connection's TLS SNI,
+// HTTP Host or QUIC header.
+type SniffRecord struct {
+	Domain       string    `json:"domain"`
+	ConnectionID string    `json:"connectionId"`
+	Network      string    `json:"network"`
+	Destination  string    `json:"destination"`
+	Process      string    `json:"process"`
+	Rule         string    `json:"rule"`
+	Start        time.Time `json:"start"`
+}
+
+// GetSniffedDomains returns the sniffed domains of the connections the core
+// tracks, newest first, at most limit of them (0 for all). Mihomo keeps no
+// history, so connections that already closed are not included. Sniffing
+// must be enabled in the config.
+func (m *MihomoCoreManager) GetSniffedDomains(limit int) ([]SniffRecord, error) {
+	if limit < 0 {
+		return nil, fmt.Errorf("invalid limit: %d", limit)
+	}
+	if !m.IsRunning() {
+		return nil, fmt.Errorf("mihomo core is not running")
+	}
+
+	var records []SniffRecord
+	statistic.DefaultManager.Range(func(t statistic.Tracker) bool {
+		info := t.Info()
+		if info.Metadata == nil || info.Metadata.SniffHost == "" {
+			return true
+		}
+		records = append(records, SniffRecord{
+			Domain:       info.Metadata.SniffHost,
+			ConnectionID: t.ID(),
+			Network:      info.Metadata.NetWork.String(),
+			Destination:  info.Metadata.RemoteAddress(),
+			Process:      info.Metadata.Process,
+			Rule:         info.Rule,
+			Start:        info.Start,
+		})
+		return true
+	})
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Start.After(records[j].Start)
+	})
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	return records, nil
+}
+
+// RateSnapshot is the connection activity of one RateStream interval.
+type RateSnapshot struct {
+	Opened int `json:"opened"`
+	Closed int `json:"closed"`
+	Active int `json:"active"`
+}
+
+// RateStream emits how many TCP connections the core opened and closed
+// during each interval, e.g. to spot an app opening connections in a loop.
+// Connections are counted as they are dialed and closed, so ones that open
+// and close within one interval are included. Active is the number of open
+// connections at the end of the interval. The channel is closed when ctx
+// is canceled or the core stops; it is closed right away if the core is
+// not running. Ticks are skipped while the reader is behind, and the next
+// snapshot covers the whole time since the last delivered one. An interval
+// of 0 or less means one second.
+func (m *MihomoCoreManager) RateStream(ctx context.Context, interval time.Duration) <-chan RateSnapshot {
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	out := make(chan RateSnapshot, 1)
+	m.mu.Lock()
+	coreCtx, running := m.ctx, m.isRunning
+	if !running || coreCtx == nil {
+		m.mu.Unlock()
+		close(out)
+		return out
+	}
+	// Count dials through the proxy wrapper while any stream runs
+	if m.rateStreams.Add(1) == 1 {
+		m.connCounters.counting.Store(true)
+		m.installProxyWrapperLocked()
+	}
+	m.mu.Unlock()
+
+	go func() {
+		defer close(out)
+		defer m.stopRateStream()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		lastOpened, lastClosed := m.connCounters.opened.Load(), m.connCounters.closed.Load()
+		var pending RateSnapshot
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-coreCtx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			opened, closed := m.connCounters.opened.Load(), m.connCounters.closed.Load()
+			pending.Opened += int(opened - lastOpened)
+			pending.Closed += int(closed - lastClosed)
+			lastOpened, lastClosed = opened, closed
+			pending.Active = 0
+			statistic.DefaultManager.Range(func(statistic.Tracker) bool {
+				pending.Active++
+				return true
+			})
+
+			select {
+			case out <- pending:
+				pending = RateSnapshot{}
+			default:
+			}
+		}
+	}()
+	return out
+}
+
+// stopRateStream unwraps the proxies again when the last RateStream ends
+// and nothing else needs the wrapper.
+func (m *MihomoCoreManager) stopRateStream() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.rateStreams.Add(-1) > 0 {
+		return
+	}
+	m.connCounters.counting.Store(false)
+	if m.isRunning {
+		m.installProxyWrapperLocked()
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/metacubex/mihomo/common/observable"
@@ -14,10 +17,16 @@ import (
 	C "github.com/metacubex/mihomo/constant"
 	"github.com/metacubex/mihomo/hub"
 	"github.com/metacubex/mihomo/hub/executor"
+	"github.com/metacubex/mihomo/listener"
 	mihomolog "github.com/metacubex/mihomo/log"
+	"github.com/metacubex/mihomo/tunnel"
 	"gopkg.in/yaml.v3"
 )
 
+// mihomoStopTimeout bounds how long Stop waits for the core goroutine to
+// exit.
+const mihomoStopTimeout = 5 * time.Second
+
 type MihomoCoreManager struct {
 	mu        sync.RWMutex
 	isRunning bool
@@ -29,13 +38,86 @@ type MihomoCoreManager struct {
 	configPath string
 	configDir  string
 	assetPath  string
+	cacheDir   string
 	logLevel   string
 
 	logSubscriber observable.Subscription[mihomolog.Event]
 	logFilePath   string
-	
+	logMaxSize    atomic.Int64              // 0: unlimited, see SetLogMaxSize
+	logPaused     atomic.Bool               // see PauseLogging
+	logFilter     atomic.Pointer[logFilter] // see SetLogFilter
+
 	// Add run lock to prevent race conditions like FlClash does
-	runLock       sync.Mutex
+	runLock sync.Mutex
+
+	preserveSelection bool
+	savedSelections   map[string]string
+
+	// Rules from the applied config and the dynamic layers installed in
+	// front of them, see mihomo_rules.go
+	baseRules          []C.Rule
+	baseSubRules       map[string][]C.Rule
+	ruleLayers         map[string][]string
+	ruleLayerOrder     []string
+	connectionPolicies map[string]string
+
+	// DNS section of the applied config, see mihomo_fakeip.go
+	dnsConfig *config.DNS
+
+	// Controller section of the applied config, see TestProxyDelayViaAPI
+	controller *config.Controller
+
+	// rule-providers section of the applied config, see GetRuleProviderConfig
+	ruleProviderSections map[string]map[string]interface{}
+
+	timings startupTimings
+
+	// Receives the outcome of the current start, see waitStarted
+	started chan error
+
+	// Closed when runCoreAsync of the current start has returned
+	done chan struct{}
+
+	// Connection cap, see mihomo_limits.go
+	maxConnections  int
+	connLimitCancel context.CancelFunc
+
+	// Selection change callback, see mihomo_groups.go
+	onProxySelected      func(group, proxy string)
+	selectionWatchCancel context.CancelFunc
+	lastSelections       map[string]string
+
+	// Per-connection rate limit in bytes/s and dial timeout in ns, see
+	// mihomo_proxy_wrapper.go
+	connRateLimit  atomic.Int64
+	connectTimeout atomic.Int64
+
+	// Open/close counts for RateStream and the number of running streams,
+	// see mihomo_connections.go
+	connCounters connCounters
+	rateStreams  atomic.Int32
+
+	// Traffic held back after a warm start, see setForwardingPaused
+	forwardingPaused bool
+
+	// App resolver hook, see mihomo_dns_hook.go
+	dnsHook func(host string) ([]net.IP, bool)
+
+	// Connection hook, see mihomo_connections.go
+	onConnection          func(info ConnectionInfo)
+	connectionWatchCancel context.CancelFunc
+
+	// patches are set on this manager directly, sharedPatches are pushed
+	// down by the unified manager before each start.
+	patches       patchSet
+	sharedPatches patchSet
+
+	// Protocol allowlist pushed down by the unified manager, checked by
+	// AddProxy, see allowed_protocols.go
+	allowedProtocols map[string]bool
+
+	// Temp dirs removed on Stop, see temp_dirs.go
+	tempDirs []string
 }
 
 func NewMihomoCoreManager(socksPort, apiPort int) *MihomoCoreManager {
@@ -52,12 +134,99 @@ func (m *MihomoCoreManager) SetAssetPath(assetPath string) {
 	m.assetPath = assetPath
 }
 
+// setPorts updates the ports reported by this manager.
+func (m *MihomoCoreManager) setPorts(socksPort, apiPort int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.socksPort = socksPort
+	m.apiPort = apiPort
+}
+
 func (m *MihomoCoreManager) SetLogLevel(logLevel string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.logLevel = logLevel
 }
 
+// SetLogMaxSize limits the log file to maxBytes. When a write takes it past
+// the limit the file is renamed to <log-file>.1, replacing the previous one,
+// and a fresh file is started, so at most about twice the limit is kept on
+// disk. 0 removes the limit. Applies to a running core immediately.
+func (m *MihomoCoreManager) SetLogMaxSize(maxBytes int64) error {
+	if maxBytes < 0 {
+		return fmt.Errorf("invalid log max size: %d", maxBytes)
+	}
+	m.logMaxSize.Store(maxBytes)
+	mihomolog.Infoln("Log max size set to %d bytes", maxBytes)
+	return nil
+}
+
+// PauseLogging stops writing core log events to the log file without
+// touching the subscription or the connections, e.g. to save IO during heavy
+// traffic. Events logged while paused are dropped. Stays in effect across
+// restarts until ResumeLogging.
+func (m *MihomoCoreManager) PauseLogging() {
+	m.logPaused.Store(true)
+	mihomolog.Infoln("Log file writing paused")
+}
+
+// ResumeLogging restarts log file writing after PauseLogging.
+func (m *MihomoCoreManager) ResumeLogging() {
+	m.logPaused.Store(false)
+	mihomolog.Infoln("Log file writing resumed")
+}
+
+// SetLogFilter limits which core log events are written to the log file,
+// e.g. exclude ["[DNS]"] to mute DNS while debugging routing. Entries match
+// anywhere in the message, ignoring case. With include set, only messages
+// matching one of its entries are written; messages matching an exclude
+// entry are never written. Mihomo's own log level still applies first.
+// Applies to a running core immediately; empty lists remove the filter.
+func (m *MihomoCoreManager) SetLogFilter(include []string, exclude []string) {
+	filter := &logFilter{include: lowerNonEmpty(include), exclude: lowerNonEmpty(exclude)}
+	if len(filter.include) == 0 && len(filter.exclude) == 0 {
+		m.logFilter.Store(nil)
+		mihomolog.Infoln("Log filter removed")
+		return
+	}
+	m.logFilter.Store(filter)
+	mihomolog.Infoln("Log filter set - include: %v, exclude: %v", filter.include, filter.exclude)
+}
+
+// logFilter holds lower-cased SetLogFilter entries.
+type logFilter struct {
+	include []string
+	exclude []string
+}
+
+func (f *logFilter) allows(payload string) bool {
+	payload = strings.ToLower(payload)
+	for _, entry := range f.exclude {
+		if strings.Contains(payload, entry) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, entry := range f.include {
+		if strings.Contains(payload, entry) {
+			return true
+		}
+	}
+	return false
+}
+
+func lowerNonEmpty(values []string) []string {
+	var lowered []string
+	for _, value := range values {
+		if value != "" {
+			lowered = append(lowered, strings.ToLower(value))
+		}
+	}
+	return lowered
+}
+
 func (m *MihomoCoreManager) SetConfigDir(configDir string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -73,7 +242,7 @@ func (m *MihomoCoreManager) GetConfigDir() string {
 func (m *MihomoCoreManager) RunConfig(configPath string) error {
 	m.runLock.Lock()
 	defer m.runLock.Unlock()
-	
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -81,25 +250,41 @@ func (m *MihomoCoreManager) RunConfig(configPath string) error {
 		return fmt.Errorf("mihomo core is already running")
 	}
 
+	absPath, absErr := filepath.Abs(configPath)
+	if absErr != nil {
+		return fmt.Errorf("failed to resolve config path: %w", absErr)
+	}
+	configPath = absPath
 	m.configPath = configPath
+	m.timings = startupTimings{}
 
 	if err := m.setupEnvironment(); err != nil {
 		return fmt.Errorf("failed to setup environment: %w", err)
 	}
 
-	configBytes, err := m.prepareConfigBytes(configPath)
+	prepareStart := time.Now()
+	mihomoGlobalsMu.Lock()
+	configBytes, logFilePath, err := m.prepareConfigBytes(configPath, m.patchesLocked())
+	mihomoGlobalsMu.Unlock()
 	if err != nil {
 		return fmt.Errorf("failed to prepare config: %w", err)
 	}
+	m.logFilePath = logFilePath
+	m.timings.Convert = time.Since(prepareStart)
 
 	m.ctx, m.cancel = context.WithCancel(context.Background())
+	m.started = make(chan error, 1)
+	m.done = make(chan struct{})
 
-	go m.runCoreAsync(configBytes)
+	go m.runCoreAsync(m.ctx, configBytes, m.started, m.done)
 
 	// Wait a brief moment for core startup - Flutter already provides available ports
 	time.Sleep(100 * time.Millisecond)
 
 	m.isRunning = true
+	m.startConnectionLimitLocked()
+	m.startSelectionWatchLocked()
+	m.startConnectionWatchLocked()
 	mihomolog.Infoln("Mihomo core started successfully on Mixed port %d, API port %d", m.socksPort, m.apiPort)
 	return nil
 }
@@ -120,7 +305,10 @@ func (m *MihomoCoreManager) setupEnvironment() error {
 		return fmt.Errorf("failed to create home directory: %w", err)
 	}
 
+	mihomoGlobalsMu.Lock()
 	C.SetHomeDir(homeDir)
+	openCacheIn(firstNonEmpty(m.cacheDir, homeDir), homeDir)
+	mihomoGlobalsMu.Unlock()
 
 	configFileName := "config.yaml"
 	if m.configPath != "" {
@@ -140,31 +328,45 @@ func (m *MihomoCoreManager) setupEnvironment() error {
 	return nil
 }
 
-func (m *MihomoCoreManager) prepareConfigBytes(configPath string) ([]byte, error) {
+// prepareConfigBytes converts the JSON config to YAML after applying
+// patches. It also returns the config's log-file path.
+func (m *MihomoCoreManager) prepareConfigBytes(configPath string, patches patchSet) ([]byte, string, error) {
 	jsonBytes, err := os.ReadFile(configPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, "", fmt.Errorf("failed to read config file: %w", err)
 	}
 
 	// The config from Flutter is JSON. We need to convert it to YAML for mihomo.
 	// We unmarshal to a generic interface{} to preserve data structures.
 	var configData interface{}
 	if err := json.Unmarshal(jsonBytes, &configData); err != nil {
-		return nil, fmt.Errorf("failed to parse config JSON: %w", err)
+		return nil, "", fmt.Errorf("failed to parse config JSON: %w", err)
+	}
+
+	configMap, isMap := configData.(map[string]interface{})
+	if isMap {
+		stripInjectedFields(configMap)
+		if err := patches.apply(configMap); err != nil {
+			return nil, "", err
+		}
+		if err := checkMihomoProviderFiles(configMap, C.Path.HomeDir()); err != nil {
+			return nil, "", err
+		}
 	}
 
 	// Marshal the Go data structure to YAML bytes.
 	yamlBytes, err := yaml.Marshal(configData)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal config to YAML: %w", err)
+		return nil, "", fmt.Errorf("failed to marshal config to YAML: %w", err)
 	}
 
 	// For log subscription, we can peek into the map.
-	if configMap, ok := configData.(map[string]interface{}); ok {
+	var logFilePath string
+	if isMap {
 		if logFile, exists := configMap["log-file"]; exists {
 			if logPath, ok := logFile.(string); ok {
-				m.logFilePath = logPath
-				mihomolog.Infoln("Extracted log file path from config: %s", m.logFilePath)
+				logFilePath = logPath
+				mihomolog.Infoln("Extracted log file path from config: %s", logFilePath)
 			} else {
 				mihomolog.Warnln("log-file exists but is not a string: %v", logFile)
 			}
@@ -175,58 +377,197 @@ func (m *MihomoCoreManager) prepareConfigBytes(configPath string) ([]byte, error
 
 	mihomolog.Infoln("Using pre-injected Mihomo config from Flutter ConfigInjectorUnified")
 
-	return yamlBytes, nil
+	return yamlBytes, logFilePath, nil
+}
+
+func (m *MihomoCoreManager) startupTimings() startupTimings {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.timings
 }
 
-func (m *MihomoCoreManager) runCoreAsync(configBytes []byte) {
+// setSharedPatches replaces the patches owned by the unified manager.
+func (m *MihomoCoreManager) setSharedPatches(patches patchSet) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sharedPatches = patches
+}
+
+// setAllowedProtocols replaces the allowlist owned by the unified manager.
+func (m *MihomoCoreManager) setAllowedProtocols(allowed map[string]bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.allowedProtocols = allowed
+}
+
+// patchesLocked returns shared patches followed by manager patches.
+// Callers must hold m.mu.
+func (m *MihomoCoreManager) patchesLocked() patchSet {
+	all := m.sharedPatches.clone()
+	for _, name := range m.patches.names {
+		all.set(name, m.patches.patches[name])
+	}
+	return all
+}
+
+func (m *MihomoCoreManager) runCoreAsync(ctx context.Context, configBytes []byte, started chan<- error, done chan<- struct{}) {
+	defer close(done)
 	defer func() {
 		if r := recover(); r != nil {
 			mihomolog.Errorln("Mihomo core panicked: %v", r)
+			select {
+			case started <- fmt.Errorf("mihomo core panicked: %v", r):
+			default:
+			}
 		}
 	}()
 
+	parseStart := time.Now()
+
 	rawConfig, err := config.UnmarshalRawConfig(configBytes)
 	if err != nil {
 		mihomolog.Errorln("Failed to unmarshal Mihomo config: %v", err)
+		started <- fmt.Errorf("failed to unmarshal Mihomo config: %w", err)
 		return
 	}
 
+	mihomoGlobalsMu.Lock()
 	parsedConfig, err := config.ParseRawConfig(rawConfig)
+	mihomoGlobalsMu.Unlock()
 	if err != nil {
 		mihomolog.Errorln("Failed to parse Mihomo config: %v", err)
+		started <- fmt.Errorf("failed to parse Mihomo config: %w", err)
 		return
 	}
+	parseDuration := time.Since(parseStart)
 
 	// Start log subscription BEFORE applying config to catch startup logs
+	m.mu.Lock()
 	mihomolog.Infoln("About to call startLogSubscription with path: %s", m.logFilePath)
-	m.startLogSubscription()
+	logSubscriber := m.startLogSubscription()
+	m.mu.Unlock()
 	mihomolog.Infoln("startLogSubscription call completed")
 
 	// Apply config with proper error handling
 	mihomolog.Infoln("Applying Mihomo configuration...")
+	applyStart := time.Now()
 	hub.ApplyConfig(parsedConfig)
+	applyDuration := time.Since(applyStart)
 
 	mihomolog.SetLevel(parsedConfig.General.LogLevel)
 	mihomolog.Infoln("Mihomo: Log level set to: %s", parsedConfig.General.LogLevel.String())
 
+	m.mu.Lock()
+	m.timings.Convert += parseDuration
+	m.timings.Apply = applyDuration
+	m.timings.Done = true
+	m.baseRules = parsedConfig.Rules
+	m.baseSubRules = parsedConfig.SubRules
+	m.dnsConfig = parsedConfig.DNS
+	m.controller = parsedConfig.Controller
+	m.ruleProviderSections = ruleProviderSections(configBytes)
+	if m.dnsHook != nil {
+		m.installDNSHookLocked()
+	}
+	if m.proxyWrapperNeeded() {
+		m.installProxyWrapperLocked()
+	}
+	if m.forwardingPaused {
+		tunnel.OnSuspend()
+	}
+	if len(m.ruleLayerOrder) > 0 {
+		if err := m.installRulesLocked(); err != nil {
+			mihomolog.Warnln("Failed to re-install dynamic rules: %v", err)
+		}
+	}
+	selections := m.savedSelections
+	m.savedSelections = nil
+	m.mu.Unlock()
+	if len(selections) > 0 {
+		restoreSelections(selections)
+	}
+
 	mihomolog.Infoln("Mihomo core started successfully via hub.ApplyConfig")
+	started <- nil
 
 	// Wait for shutdown signal
-	<-m.ctx.Done()
+	<-ctx.Done()
 
 	// Clean shutdown - just stop log subscription, don't apply empty config
-	// as it causes race conditions during rapid start/stop cycles
-	m.stopLogSubscription()
+	// as it causes race conditions during rapid start/stop cycles. Leave it
+	// alone if a newer run has already replaced it.
+	m.mu.Lock()
+	if logSubscriber != nil && m.logSubscriber == logSubscriber {
+		m.stopLogSubscription()
+	}
+	m.mu.Unlock()
 
 	mihomolog.Infoln("Mihomo core instance context cancelled.")
 }
 
+// waitStarted waits up to timeout for the core goroutine to parse and apply
+// the config and returns its error. A start still in progress after timeout,
+// e.g. while providers download, is not an error.
+func (m *MihomoCoreManager) waitStarted(timeout time.Duration) error {
+	m.mu.RLock()
+	started := m.started
+	m.mu.RUnlock()
+	if started == nil {
+		return nil
+	}
+
+	select {
+	case err := <-started:
+		// Keep the result for later callers
+		started <- err
+		return err
+	case <-time.After(timeout):
+		mihomolog.Warnln("Mihomo core still starting after %v", timeout)
+		return nil
+	}
+}
+
+// Stop stops the core, see StopWithTimeout. The core is stopped even when
+// an error is returned; the error reports that its goroutine has not exited
+// yet.
 func (m *MihomoCoreManager) Stop() error {
+	if err := m.StopWithTimeout(mihomoStopTimeout); err != nil {
+		mihomolog.Warnln("%v", err)
+		return err
+	}
+	return nil
+}
+
+// StopWithTimeout stops the core and waits up to timeout for its goroutine
+// to exit, so a following RunConfig starts after the old run released its
+// log subscription. The goroutine cannot be interrupted while it is still
+// applying the config; an error is returned if it has not exited by then.
+func (m *MihomoCoreManager) StopWithTimeout(timeout time.Duration) error {
 	m.runLock.Lock()
 	defer m.runLock.Unlock()
-	
+
+	done := m.requestStop()
+	if done == nil {
+		return nil
+	}
+	select {
+	case <-done:
+		mihomolog.Infoln("Mihomo core instance stopped.")
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("mihomo core did not exit within %v", timeout)
+	}
+}
+
+// requestStop cancels the running core and returns the channel closed when
+// its goroutine exits, or nil when the core is not running.
+func (m *MihomoCoreManager) requestStop() <-chan struct{} {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	defer m.removeTempDirsLocked()
+
+	// Selections are only carried over restarts, see selectionsForRestart
+	m.savedSelections = nil
 
 	if !m.isRunning {
 		return nil
@@ -242,7 +583,7 @@ func (m *MihomoCoreManager) Stop() error {
 
 	m.isRunning = false
 	mihomolog.Infoln("Mihomo core instance stop requested.")
-	return nil
+	return m.done
 }
 
 func (m *MihomoCoreManager) IsRunning() bool {
@@ -257,7 +598,26 @@ func (m *MihomoCoreManager) TestConfig(configPath string) error {
 		return fmt.Errorf("failed to setup environment: %w", err)
 	}
 
-	configBytes, err := m.prepareConfigBytes(configPath)
+	return m.validateConfig(configPath)
+}
+
+// mihomoGlobalsMu serializes the code that uses Mihomo's process-wide state:
+// the home dir in C.Path, and the geodata mode, loader and URLs that config
+// parsing switches while it runs and restores afterwards.
+var mihomoGlobalsMu sync.Mutex
+
+// validateConfig parses a config without setting Mihomo's home dir. Parsing
+// is serialized with every other Mihomo parse, including a running core's,
+// so concurrent calls are safe but do not run in parallel.
+func (m *MihomoCoreManager) validateConfig(configPath string) error {
+	m.mu.RLock()
+	patches := m.patchesLocked()
+	m.mu.RUnlock()
+
+	mihomoGlobalsMu.Lock()
+	defer mihomoGlobalsMu.Unlock()
+
+	configBytes, _, err := m.prepareConfigBytes(configPath, patches)
 	if err != nil {
 		return fmt.Errorf("failed to prepare config: %w", err)
 	}
@@ -270,43 +630,97 @@ func (m *MihomoCoreManager) TestConfig(configPath string) error {
 	return nil
 }
 
-func (m *MihomoCoreManager) startLogSubscription() {
+// startLogSubscription returns the new subscription, or nil when there is no
+// log file. Callers must hold m.mu.
+func (m *MihomoCoreManager) startLogSubscription() observable.Subscription[mihomolog.Event] {
 	m.stopLogSubscription()
 
 	mihomolog.Infoln("Attempting to start log subscription with path: '%s'", m.logFilePath)
 
 	if m.logFilePath == "" {
 		mihomolog.Warnln("No log file path available for manual log subscription")
-		return
+		return nil
 	}
 
-	m.logSubscriber = mihomolog.Subscribe()
-	mihomolog.Infoln("Started log subscription for file: %s", m.logFilePath)
+	subscriber := mihomolog.Subscribe()
+	logFilePath := m.logFilePath
+	m.logSubscriber = subscriber
+	mihomolog.Infoln("Started log subscription for file: %s", logFilePath)
 
 	go func() {
-		logFile, err := os.OpenFile(m.logFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		logFile, err := os.OpenFile(logFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 		if err != nil {
 			mihomolog.Errorln("Failed to open log file for writing: %v", err)
 			return
 		}
-		defer logFile.Close()
+		defer func() { logFile.Close() }()
 
-		logFile.WriteString(fmt.Sprintf("[%s] Mihomo core log subscription started\n", time.Now().Format("2006-01-02 15:04:05")))
+		var size int64
+		if info, err := logFile.Stat(); err == nil {
+			size = info.Size()
+		}
+
+		n, _ := logFile.WriteString(fmt.Sprintf("[%s] Mihomo core log subscription started\n", time.Now().Format("2006-01-02 15:04:05")))
+		size += int64(n)
+
+		for logData := range subscriber {
+			// Keep draining while paused so the subscription does not back up
+			if m.logPaused.Load() {
+				continue
+			}
+			if filter := m.logFilter.Load(); filter != nil && !filter.allows(logData.Payload) {
+				continue
+			}
 
-		for logData := range m.logSubscriber {
 			// Log ALL messages regardless of level to ensure we don't miss anything
 			logEntry := fmt.Sprintf("[%s] [%s] %s\n",
 				time.Now().Format("2006-01-02 15:04:05"),
 				logData.LogLevel.String(),
 				logData.Payload)
 
-			if _, err := logFile.WriteString(logEntry); err != nil {
+			n, err := logFile.WriteString(logEntry)
+			if err != nil {
 				mihomolog.Errorln("Failed to write log entry: %v", err)
-			} else {
-				logFile.Sync()
+				continue
+			}
+			logFile.Sync()
+			size += int64(n)
+
+			if maxSize := m.logMaxSize.Load(); maxSize > 0 && size >= maxSize {
+				rotated, err := rotateLogFile(logFile, logFilePath)
+				if err != nil {
+					// Errors here would be logged back into this loop, so
+					// report them on stderr only.
+					fmt.Fprintf(os.Stderr, "Failed to rotate Mihomo log file: %v\n", err)
+					if rotated == nil {
+						return
+					}
+				}
+				logFile, size = rotated, 0
 			}
 		}
 	}()
+	return subscriber
+}
+
+// rotateLogFile closes logFile, moves it to path.1 and opens a fresh file at
+// path. If the rename fails the old file is truncated instead.
+func rotateLogFile(logFile *os.File, path string) (*os.File, error) {
+	logFile.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	renameErr := os.Rename(path, path+".1")
+	if renameErr != nil {
+		flags |= os.O_TRUNC
+	}
+	rotated, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reopen log file: %w", err)
+	}
+	if renameErr != nil {
+		return rotated, fmt.Errorf("failed to rename log file, truncated it instead: %w", renameErr)
+	}
+	return rotated, nil
 }
 
 func (m *MihomoCoreManager) stopLogSubscription() {
@@ -333,6 +747,18 @@ func (m *MihomoCoreManager) GetStats() map[string]interface{} {
 	}
 }
 
+// Restart reloads the core with the config it is currently running.
+func (m *MihomoCoreManager) Restart() error {
+	m.mu.RLock()
+	configPath := m.configPath
+	m.mu.RUnlock()
+
+	if configPath == "" {
+		return fmt.Errorf("no configuration path set")
+	}
+	return m.UpdateConfig(configPath)
+}
+
 func (m *MihomoCoreManager) UpdateConfig(configPath string) error {
 	if !m.isRunning {
 		return fmt.Errorf("mihomo core is not running")
@@ -340,9 +766,11 @@ func (m *MihomoCoreManager) UpdateConfig(configPath string) error {
 
 	mihomolog.Infoln("Restarting Mihomo core with new configuration...")
 
+	selections := m.selectionsForRestart()
 	if err := m.Stop(); err != nil {
 		return fmt.Errorf("failed to stop core: %w", err)
 	}
+	m.restoreSelectionsOnStart(selections)
 
 	time.Sleep(200 * time.Millisecond)
 
@@ -353,3 +781,87 @@ func (m *MihomoCoreManager) UpdateConfig(configPath string) error {
 	mihomolog.Infoln("Mihomo configuration updated successfully: %s", configPath)
 	return nil
 }
+
+// ReloadConfig applies a new config to the running core in place, without
+// stopping it. Listeners, tun and DNS whose settings did not change are kept.
+func (m *MihomoCoreManager) ReloadConfig(configPath string) error {
+	return m.reloadConfig(configPath, false)
+}
+
+// ReloadConfigKeepTun applies a new config like ReloadConfig but keeps the
+// running tun device (and its Android fd) attached, ignoring the tun section
+// of the new config. Used for seamless server switches in system VPN mode.
+func (m *MihomoCoreManager) ReloadConfigKeepTun(configPath string) error {
+	return m.reloadConfig(configPath, true)
+}
+
+func (m *MihomoCoreManager) reloadConfig(configPath string, keepTun bool) error {
+	m.runLock.Lock()
+	defer m.runLock.Unlock()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.isRunning {
+		return fmt.Errorf("mihomo core is not running")
+	}
+
+	absPath, absErr := filepath.Abs(configPath)
+	if absErr != nil {
+		return fmt.Errorf("failed to resolve config path: %w", absErr)
+	}
+
+	mihomoGlobalsMu.Lock()
+	configBytes, logFilePath, err := m.prepareConfigBytes(absPath, m.patchesLocked())
+	if err != nil {
+		mihomoGlobalsMu.Unlock()
+		return fmt.Errorf("failed to prepare config: %w", err)
+	}
+	m.logFilePath = logFilePath
+	parsedConfig, err := executor.ParseWithBytes(configBytes)
+	mihomoGlobalsMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("invalid Mihomo configuration: %w", err)
+	}
+
+	if keepTun {
+		// Mihomo only recreates the tun listener when its config differs
+		// from the last one applied
+		parsedConfig.General.Tun = listener.LastTunConf
+	}
+
+	var selections map[string]string
+	if m.preserveSelection {
+		selections = currentSelections()
+	}
+
+	hub.ApplyConfig(parsedConfig)
+	mihomolog.SetLevel(parsedConfig.General.LogLevel)
+
+	m.configPath = absPath
+	m.baseRules = parsedConfig.Rules
+	m.baseSubRules = parsedConfig.SubRules
+	m.dnsConfig = parsedConfig.DNS
+	m.controller = parsedConfig.Controller
+	m.ruleProviderSections = ruleProviderSections(configBytes)
+	if m.dnsHook != nil {
+		m.installDNSHookLocked()
+	}
+	if m.proxyWrapperNeeded() {
+		m.installProxyWrapperLocked()
+	}
+	if m.forwardingPaused {
+		tunnel.OnSuspend()
+	}
+	if len(m.ruleLayerOrder) > 0 {
+		if err := m.installRulesLocked(); err != nil {
+			mihomolog.Warnln("Failed to re-install dynamic rules: %v", err)
+		}
+	}
+	if len(selections) > 0 {
+		restoreSelections(selections)
+	}
+
+	mihomolog.Infoln("Mihomo configuration reloaded in place: %s", absPath)
+	return nil
+}
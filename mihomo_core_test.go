@@ -0,0 +1,77 @@
+package libunifiedcore
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// writeMihomoConfigs writes n injected Mihomo configs to dir, each with a
+// shadowsocks proxy to 127.0.0.1:port as the only proxy, and returns their
+// paths.
+func writeMihomoConfigs(t *testing.T, dir string, port, n int) []string {
+	t.Helper()
+
+	paths := make([]string, n)
+	for i := range paths {
+		config := map[string]interface{}{
+			"coreType": "mihomo",
+			"mode":     "rule",
+			"proxies": []interface{}{
+				map[string]interface{}{
+					"name":     "proxy",
+					"type":     "ss",
+					"server":   "127.0.0.1",
+					"port":     port,
+					"cipher":   "aes-128-gcm",
+					"password": fmt.Sprintf("password-%d", i),
+				},
+			},
+			"rules": []interface{}{"MATCH,proxy"},
+		}
+		data, err := json.Marshal(config)
+		if err != nil {
+			t.Fatalf("marshal config: %v", err)
+		}
+		paths[i] = filepath.Join(dir, fmt.Sprintf("mihomo-%d.json", i))
+		if err := os.WriteFile(paths[i], data, 0o600); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+	}
+	return paths
+}
+
+// Run with -race: Mihomo's parser switches process-wide settings, so
+// concurrent validation must not race on them.
+func TestMihomoValidateConcurrently(t *testing.T) {
+	// The Mihomo home dir defaults to the working directory
+	t.Chdir(t.TempDir())
+	paths := writeMihomoConfigs(t, t.TempDir(), 8388, 32)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path, err := range TestConfigs(paths, "mihomo") {
+				if err != nil {
+					t.Errorf("TestConfigs(%s): %v", path, err)
+				}
+			}
+		}()
+	}
+	for _, path := range paths[:8] {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			m := NewMihomoCoreManager(0, 0)
+			if err := m.TestConfig(path); err != nil {
+				t.Errorf("TestConfig(%s): %v", path, err)
+			}
+		}(path)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,133 @@
+package libunifiedcore
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/metacubex/mihomo/component/resolver"
+	mihomolog "github.com/metacubex/mihomo/log"
+	"github.com/miekg/dns"
+)
+
+// SetDNSResolverHook lets the app resolve host names itself, e.g. through
+// the platform resolver of a VpnService, instead of Go's resolver. hook is
+// asked first for every lookup the core makes to dial proxy servers and
+// direct connections; returning handled=false falls back to the configured
+// DNS. Returning handled=true with no IPs fails the lookup. Queries served by
+// Mihomo's own DNS listener are not affected. The hook survives config
+// reloads; pass nil to remove it.
+func (m *MihomoCoreManager) SetDNSResolverHook(hook func(host string) ([]net.IP, bool)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.dnsHook = hook
+	if m.isRunning {
+		m.installDNSHookLocked()
+	}
+	if hook == nil {
+		mihomolog.Infoln("DNS resolver hook removed")
+	} else {
+		mihomolog.Infoln("DNS resolver hook set")
+	}
+}
+
+// installDNSHookLocked wraps Mihomo's resolvers with the hook, or unwraps
+// them when there is none. Mihomo replaces the resolvers on every config
+// apply, so this runs after each one. Callers must hold m.mu.
+func (m *MihomoCoreManager) installDNSHookLocked() {
+	wrap := func(r resolver.Resolver) resolver.Resolver {
+		if hooked, ok := r.(*hookedResolver); ok {
+			r = hooked.inner
+		}
+		if m.dnsHook == nil {
+			return r
+		}
+		return &hookedResolver{inner: r, hook: m.dnsHook}
+	}
+	resolver.DefaultResolver = wrap(resolver.DefaultResolver)
+	resolver.ProxyServerHostResolver = wrap(resolver.ProxyServerHostResolver)
+	resolver.DirectHostResolver = wrap(resolver.DirectHostResolver)
+}
+
+// hookedResolver asks the app's hook before the resolver it wraps. inner is
+// nil when DNS is disabled in the config; the system resolver is used then,
+// as Mihomo does.
+type hookedResolver struct {
+	inner resolver.Resolver
+	hook  func(host string) ([]net.IP, bool)
+}
+
+func (r *hookedResolver) next() resolver.Resolver {
+	if r.inner != nil {
+		return r.inner
+	}
+	return resolver.SystemResolver
+}
+
+// lookup returns the hook's answer filtered by keep, and whether the hook
+// handled host.
+func (r *hookedResolver) lookup(host string, keep func(netip.Addr) bool) ([]netip.Addr, bool, error) {
+	ips, handled := r.hook(host)
+	if !handled {
+		return nil, false, nil
+	}
+	addrs := make([]netip.Addr, 0, len(ips))
+	for _, ip := range ips {
+		if addr, ok := netip.AddrFromSlice(ip); ok && keep(addr.Unmap()) {
+			addrs = append(addrs, addr.Unmap())
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, true, fmt.Errorf("%w: %s", resolver.ErrIPNotFound, host)
+	}
+	return addrs, true, nil
+}
+
+func (r *hookedResolver) LookupIP(ctx context.Context, host string) ([]netip.Addr, error) {
+	if addrs, handled, err := r.lookup(host, func(netip.Addr) bool { return true }); handled {
+		return addrs, err
+	}
+	return r.next().LookupIP(ctx, host)
+}
+
+func (r *hookedResolver) LookupIPv4(ctx context.Context, host string) ([]netip.Addr, error) {
+	if addrs, handled, err := r.lookup(host, netip.Addr.Is4); handled {
+		return addrs, err
+	}
+	return r.next().LookupIPv4(ctx, host)
+}
+
+func (r *hookedResolver) LookupIPv6(ctx context.Context, host string) ([]netip.Addr, error) {
+	if addrs, handled, err := r.lookup(host, netip.Addr.Is6); handled {
+		return addrs, err
+	}
+	return r.next().LookupIPv6(ctx, host)
+}
+
+func (r *hookedResolver) ResolveECH(ctx context.Context, host string) ([]byte, error) {
+	return r.next().ResolveECH(ctx, host)
+}
+
+func (r *hookedResolver) ExchangeContext(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	return r.next().ExchangeContext(ctx, msg)
+}
+
+// Invalid reports true so Mihomo uses this resolver even when DNS is
+// disabled in the config.
+func (r *hookedResolver) Invalid() bool {
+	return true
+}
+
+func (r *hookedResolver) ClearCache() {
+	if r.inner != nil {
+		r.inner.ClearCache()
+	}
+}
+
+func (r *hookedResolver) ResetConnection() {
+	if r.inner != nil {
+		r.inner.ResetConnection()
+	}
+}
@@ -0,0 +1,64 @@
+package libunifiedcore
+
+import (
+	"fmt"
+
+	C "github.com/metacubex/mihomo/constant"
+)
+
+// maxFakeIPScan bounds how many addresses GetFakeIPStatus checks to count
+// the pool usage.
+const maxFakeIPScan = 1 << 20
+
+// FakeIPStatus describes the fake-ip pool of the running Mihomo core.
+type FakeIPStatus struct {
+	Enabled bool   `json:"enabled"`
+	Range   string `json:"range"`
+	// Size is the number of addresses the pool hands out, or -1 for ranges
+	// too large to fit an int.
+	Size int `json:"size"`
+	// Used is the number of addresses currently mapped to a host, or -1 when
+	// the range is too large to count.
+	Used int `json:"used"`
+}
+
+// GetFakeIPStatus reports whether the running core answers DNS with fake
+// IPs, the range they come from and how much of the pool is in use. The
+// pool does not expose its usage, so Used is counted by checking every
+// address of the range.
+func (m *MihomoCoreManager) GetFakeIPStatus() (*FakeIPStatus, error) {
+	m.mu.RLock()
+	running, dnsConfig := m.isRunning, m.dnsConfig
+	m.mu.RUnlock()
+	if !running {
+		return nil, fmt.Errorf("mihomo core is not running")
+	}
+
+	status := &FakeIPStatus{}
+	if dnsConfig == nil || dnsConfig.FakeIPRange == nil {
+		return status, nil
+	}
+	pool := dnsConfig.FakeIPRange
+	prefix := pool.IPNet()
+	status.Enabled = dnsConfig.Enable && dnsConfig.EnhancedMode == C.DNSFakeIP
+	status.Range = prefix.String()
+
+	// The network address, the gateway, the two addresses after it and the
+	// last address are never handed out
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	if hostBits >= 31 {
+		status.Size, status.Used = -1, -1
+		return status, nil
+	}
+	status.Size = max(1<<hostBits-5, 0)
+	if status.Size > maxFakeIPScan {
+		status.Used = -1
+		return status, nil
+	}
+	for ip := pool.Gateway().Next().Next().Next(); ip.Less(pool.Broadcast()); ip = ip.Next() {
+		if pool.Exist(ip) {
+			status.Used++
+		}
+	}
+	return status, nil
+}
@@ -0,0 +1,85 @@
+package libunifiedcore
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/metacubex/mihomo/hub/executor"
+	mihomolog "github.com/metacubex/mihomo/log"
+	"github.com/metacubex/mihomo/tunnel"
+)
+
+// GeneralInfo is the effective General section of the running Mihomo
+// config, after Mihomo applied its defaults.
+type GeneralInfo struct {
+	Mode          string `json:"mode"`
+	LogLevel      string `json:"logLevel"`
+	Port          int    `json:"port"`
+	SocksPort     int    `json:"socksPort"`
+	MixedPort     int    `json:"mixedPort"`
+	RedirPort     int    `json:"redirPort"`
+	TProxyPort    int    `json:"tproxyPort"`
+	AllowLan      bool   `json:"allowLan"`
+	BindAddress   string `json:"bindAddress"`
+	IPv6          bool   `json:"ipv6"`
+	Interface     string `json:"interfaceName"`
+	Sniffing      bool   `json:"sniffing"`
+	TCPConcurrent bool   `json:"tcpConcurrent"`
+	TunEnabled    bool   `json:"tunEnabled"`
+	TunStack      string `json:"tunStack"`
+	TunDevice     string `json:"tunDevice"`
+}
+
+// GetGeneralConfig reads the General section from the running core rather
+// than from the config that was sent, so defaults and runtime changes (mode
+// switches, ports) are reflected.
+func (m *MihomoCoreManager) GetGeneralConfig() (*GeneralInfo, error) {
+	if !m.IsRunning() {
+		return nil, fmt.Errorf("mihomo core is not running")
+	}
+
+	general := executor.GetGeneral()
+	return &GeneralInfo{
+		Mode:          general.Mode.String(),
+		LogLevel:      general.LogLevel.String(),
+		Port:          general.Port,
+		SocksPort:     general.SocksPort,
+		MixedPort:     general.MixedPort,
+		RedirPort:     general.RedirPort,
+		TProxyPort:    general.TProxyPort,
+		AllowLan:      general.AllowLan,
+		BindAddress:   general.BindAddress,
+		IPv6:          general.IPv6,
+		Interface:     general.Interface,
+		Sniffing:      general.Sniffing,
+		TCPConcurrent: general.TCPConcurrent,
+		TunEnabled:    general.Tun.Enable,
+		TunStack:      general.Tun.Stack.String(),
+		TunDevice:     general.Tun.Device,
+	}, nil
+}
+
+// GetMode returns the routing mode of the running core: rule, global or
+// direct.
+func (m *MihomoCoreManager) GetMode() (string, error) {
+	if !m.IsRunning() {
+		return "", fmt.Errorf("mihomo core is not running")
+	}
+	return tunnel.Mode().String(), nil
+}
+
+// SetMode switches the routing mode of the running core to rule, global or
+// direct. Like a mode switch from the dashboard, it lasts until the next
+// config apply, which takes the mode from the config again.
+func (m *MihomoCoreManager) SetMode(mode string) error {
+	parsed, ok := tunnel.ModeMapping[strings.ToLower(mode)]
+	if !ok {
+		return fmt.Errorf("invalid mode: %s", mode)
+	}
+	if !m.IsRunning() {
+		return fmt.Errorf("mihomo core is not running")
+	}
+	tunnel.SetMode(parsed)
+	mihomolog.Infoln("Mode set to: %s", parsed.String())
+	return nil
+}
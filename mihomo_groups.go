@@ -0,0 +1,292 @@
+package libunifiedcore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/metacubex/mihomo/adapter/outboundgroup"
+	C "github.com/metacubex/mihomo/constant"
+	mihomolog "github.com/metacubex/mihomo/log"
+	"github.com/metacubex/mihomo/tunnel"
+)
+
+type groupNow interface {
+	Now() string
+}
+
+// SelectProxy selects proxy in the select group named group on the running
+// core.
+func (m *MihomoCoreManager) SelectProxy(group, proxy string) error {
+	if !m.IsRunning() {
+		return fmt.Errorf("mihomo core is not running")
+	}
+
+	target, exists := tunnel.Proxies()[group]
+	if !exists {
+		return fmt.Errorf("proxy group not found: %s", group)
+	}
+	selector, ok := target.Adapter().(outboundgroup.SelectAble)
+	if !ok || target.Type() != C.Selector {
+		return fmt.Errorf("proxy group %s is not a select group", group)
+	}
+	if err := selector.Set(proxy); err != nil {
+		return fmt.Errorf("failed to select %s in %s: %w", proxy, group, err)
+	}
+
+	mihomolog.Infoln("Selected %s -> %s", group, proxy)
+	m.notifySelectionChanges()
+	return nil
+}
+
+// SelectProxies applies several group -> proxy selections together. Every
+// group and proxy is checked before anything changes, so an invalid entry
+// leaves all selections as they were; if a selection still fails part way,
+// the ones already made are reverted.
+func (m *MihomoCoreManager) SelectProxies(selections map[string]string) error {
+	if !m.IsRunning() {
+		return fmt.Errorf("mihomo core is not running")
+	}
+
+	proxies := tunnel.Proxies()
+	selectors := make(map[string]outboundgroup.SelectAble, len(selections))
+	previous := make(map[string]string, len(selections))
+	groups := make([]string, 0, len(selections))
+	for group, proxy := range selections {
+		target, exists := proxies[group]
+		if !exists {
+			return fmt.Errorf("proxy group not found: %s", group)
+		}
+		selector, ok := target.Adapter().(outboundgroup.SelectAble)
+		if !ok || target.Type() != C.Selector {
+			return fmt.Errorf("proxy group %s is not a select group", group)
+		}
+		if !groupHasProxy(target, proxy) {
+			return fmt.Errorf("proxy %s is not in group %s", proxy, group)
+		}
+		selectors[group] = selector
+		if now, ok := target.Adapter().(groupNow); ok {
+			previous[group] = now.Now()
+		}
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	for i, group := range groups {
+		if err := selectors[group].Set(selections[group]); err != nil {
+			for _, done := range groups[:i] {
+				selectors[done].Set(previous[done])
+			}
+			return fmt.Errorf("failed to select %s in %s, selections reverted: %w", selections[group], group, err)
+		}
+	}
+
+	mihomolog.Infoln("Selected %d groups: %v", len(groups), selections)
+	m.notifySelectionChanges()
+	return nil
+}
+
+// groupHasProxy reports whether proxy is a member of group.
+func groupHasProxy(group C.Proxy, proxy string) bool {
+	members, ok := group.Adapter().(interface{ GetProxies(touch bool) []C.Proxy })
+	if !ok {
+		return false
+	}
+	for _, member := range members.GetProxies(false) {
+		if member.Name() == proxy {
+			return true
+		}
+	}
+	return false
+}
+
+// SetOnProxySelected registers a callback invoked with (group, proxy) whenever
+// the proxy used by a select, url-test or fallback group changes, including
+// automatic switches by the core. Automatic switches only follow health
+// check results and provider updates, so groups are compared when the core
+// reports one of those. Pass nil to remove the callback.
+func (m *MihomoCoreManager) SetOnProxySelected(onSelected func(group, proxy string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.onProxySelected = onSelected
+	if m.isRunning {
+		m.startSelectionWatchLocked()
+	}
+}
+
+// startSelectionWatchLocked (re)starts the selection watcher when a callback
+// is set. Callers must hold m.mu.
+func (m *MihomoCoreManager) startSelectionWatchLocked() {
+	if m.selectionWatchCancel != nil {
+		m.selectionWatchCancel()
+		m.selectionWatchCancel = nil
+	}
+	m.lastSelections = nil
+	if m.onProxySelected == nil || m.ctx == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.selectionWatchCancel = cancel
+	go m.watchSelections(ctx)
+}
+
+// watchSelections compares group selections whenever the core reports an
+// event that can move a url-test or fallback group to another proxy. The
+// events are read from the core's log stream, which carries debug events
+// whatever the log level; they are only coalesced here so a slow callback
+// never holds up the core's logging.
+func (m *MihomoCoreManager) watchSelections(ctx context.Context) {
+	subscriber := mihomolog.Subscribe()
+	defer mihomolog.UnSubscribe(subscriber)
+
+	changed := make(chan struct{}, 1)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-changed:
+				m.notifySelectionChanges()
+			}
+		}
+	}()
+
+	m.notifySelectionChanges()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-subscriber:
+			if !ok {
+				return
+			}
+			if !isSelectionEvent(event.Payload) {
+				continue
+			}
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// isSelectionEvent reports whether a core log event follows new delay
+// results or new provider proxies, the only inputs url-test and fallback
+// groups pick their proxy from.
+func isSelectionEvent(payload string) bool {
+	return strings.HasPrefix(payload, "Health Checked, ") ||
+		strings.HasPrefix(payload, "Finish A Health Checking") ||
+		(strings.HasPrefix(payload, "[Provider] ") && strings.HasSuffix(payload, " update"))
+}
+
+// notifySelectionChanges compares the groups' current proxies to the last
+// seen ones and reports the differences. Groups that were not seen before
+// (first check, new config) are recorded without a callback.
+func (m *MihomoCoreManager) notifySelectionChanges() {
+	current := groupSelections()
+
+	m.mu.Lock()
+	previous := m.lastSelections
+	m.lastSelections = current
+	onSelected := m.onProxySelected
+	m.mu.Unlock()
+
+	if onSelected == nil {
+		return
+	}
+	for group, proxy := range current {
+		if before, seen := previous[group]; seen && before != proxy {
+			onSelected(group, proxy)
+		}
+	}
+}
+
+// groupSelections returns group -> current proxy for every group type that
+// picks a single proxy.
+func groupSelections() map[string]string {
+	selections := make(map[string]string)
+	for name, proxy := range tunnel.Proxies() {
+		switch proxy.Type() {
+		case C.Selector, C.URLTest, C.Fallback:
+		default:
+			continue
+		}
+		if now, ok := proxy.Adapter().(groupNow); ok && now.Now() != "" {
+			selections[name] = now.Now()
+		}
+	}
+	return selections
+}
+
+// PreserveSelectionAcrossRestart makes Restart and UpdateConfig remember the
+// proxy chosen in every select group, and the start that follows re-apply
+// them. Used so config updates and restarts keep the user on the node they
+// picked. A plain Stop forgets the selections.
+func (m *MihomoCoreManager) PreserveSelectionAcrossRestart(preserve bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.preserveSelection = preserve
+	if !preserve {
+		m.savedSelections = nil
+	}
+}
+
+// selectionsForRestart returns the current selections when they are to be
+// preserved across a restart, nil otherwise. Pass them to
+// restoreSelectionsOnStart once the core is stopped.
+func (m *MihomoCoreManager) selectionsForRestart() map[string]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if !m.preserveSelection || !m.isRunning {
+		return nil
+	}
+	return currentSelections()
+}
+
+// restoreSelectionsOnStart makes the next successful start re-apply
+// selections.
+func (m *MihomoCoreManager) restoreSelectionsOnStart(selections map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.savedSelections = selections
+}
+
+// currentSelections returns group -> selected proxy for every select group
+// of the running core.
+func currentSelections() map[string]string {
+	selections := make(map[string]string)
+	for name, proxy := range tunnel.Proxies() {
+		if proxy.Type() != C.Selector {
+			continue
+		}
+		if now, ok := proxy.Adapter().(groupNow); ok && now.Now() != "" {
+			selections[name] = now.Now()
+		}
+	}
+	return selections
+}
+
+// restoreSelections re-applies previously captured selections, skipping
+// groups or proxies that no longer exist in the new config.
+func restoreSelections(selections map[string]string) {
+	proxies := tunnel.Proxies()
+	for group, selected := range selections {
+		proxy, exists := proxies[group]
+		if !exists || proxy.Type() != C.Selector {
+			continue
+		}
+		selector, ok := proxy.Adapter().(outboundgroup.SelectAble)
+		if !ok {
+			continue
+		}
+		if err := selector.Set(selected); err != nil {
+			mihomolog.Warnln("Could not restore selection %s -> %s: %v", group, selected, err)
+			continue
+		}
+		mihomolog.Infoln("Restored selection %s -> %s", group, selected)
+	}
+}
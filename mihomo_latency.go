@@ -0,0 +1,145 @@
+package libunifiedcore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	C "github.com/metacubex/mihomo/constant"
+	"github.com/metacubex/mihomo/tunnel"
+)
+
+// LatencyPoint is one stored URL test result. Delay is 0 when the test
+// failed.
+type LatencyPoint struct {
+	Time  time.Time `json:"time"`
+	Delay int       `json:"delay"`
+}
+
+// GetProxyLatencyHistory returns the URL test history Mihomo keeps for the
+// named proxy, oldest first. Mihomo only keeps the last few results for the
+// proxy's default test URL.
+func (m *MihomoCoreManager) GetProxyLatencyHistory(name string) ([]LatencyPoint, error) {
+	if !m.IsRunning() {
+		return nil, fmt.Errorf("mihomo core is not running")
+	}
+
+	proxy := findProxy(name)
+	if proxy == nil {
+		return nil, fmt.Errorf("proxy not found: %s", name)
+	}
+
+	history := proxy.DelayHistory()
+	points := make([]LatencyPoint, 0, len(history))
+	for _, h := range history {
+		points = append(points, LatencyPoint{Time: h.Time, Delay: int(h.Delay)})
+	}
+	return points, nil
+}
+
+// findProxy looks name up among the configured proxies, then among the
+// proxies loaded from providers.
+func findProxy(name string) C.Proxy {
+	if proxy, exists := tunnel.Proxies()[name]; exists {
+		return proxy
+	}
+	for _, provider := range tunnel.Providers() {
+		for _, proxy := range provider.Proxies() {
+			if proxy.Name() == name {
+				return proxy
+			}
+		}
+	}
+	return nil
+}
+
+// maxAPIDelayTimeout is the longest timeout the delay endpoint accepts; it
+// parses the value as a 16-bit number of milliseconds.
+const maxAPIDelayTimeout = 32767 * time.Millisecond
+
+// TestProxyDelayViaAPI runs a URL test for the named proxy through the
+// external controller's /proxies/{name}/delay endpoint instead of calling
+// the core directly, so it also works for a core this manager does not run.
+// The controller address and secret come from the config this manager last
+// applied; otherwise 127.0.0.1 on the API port is used without a secret.
+// A recent result may come from the ping cache, see SetPingCacheTTL.
+func (m *MihomoCoreManager) TestProxyDelayViaAPI(proxyName, testURL string, timeout time.Duration) (uint16, error) {
+	if timeout <= 0 || timeout > maxAPIDelayTimeout {
+		return 0, fmt.Errorf("invalid timeout: %v", timeout)
+	}
+	if testURL == "" {
+		testURL = defaultProbeURL
+	}
+
+	m.mu.RLock()
+	configPath := m.configPath
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(m.apiPort))
+	var secret string
+	if m.controller != nil {
+		if m.controller.ExternalController != "" {
+			addr = m.controller.ExternalController
+		}
+		secret = m.controller.Secret
+	}
+	m.mu.RUnlock()
+
+	cacheKey := pingCacheKey(configPath, proxyName, testURL)
+	if latency, cached := pingCache.latency(cacheKey); cached {
+		return uint16(latency), nil
+	}
+
+	// A controller listening on all interfaces is reached over loopback
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+			addr = net.JoinHostPort("127.0.0.1", port)
+		}
+	}
+
+	query := url.Values{}
+	query.Set("url", testURL)
+	query.Set("timeout", strconv.FormatInt(timeout.Milliseconds(), 10))
+	endpoint := fmt.Sprintf("http://%s/proxies/%s/delay?%s", addr, url.PathEscape(proxyName), query.Encode())
+
+	// Leave the controller time to answer after its own timeout fires
+	ctx, cancel := context.WithTimeout(context.Background(), timeout+2*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	if secret != "" {
+		req.Header.Set("Authorization", "Bearer "+secret)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reach external controller: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Delay   uint16 `json:"delay"`
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil && resp.StatusCode == http.StatusOK {
+		return 0, fmt.Errorf("failed to decode delay response: %w", err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		pingCache.put(cacheKey, int(body.Delay))
+		return body.Delay, nil
+	case resp.StatusCode == http.StatusNotFound:
+		return 0, fmt.Errorf("proxy not found: %s", proxyName)
+	case resp.StatusCode == http.StatusUnauthorized:
+		return 0, fmt.Errorf("external controller rejected the secret")
+	case body.Message != "":
+		return 0, fmt.Errorf("delay test failed: %s", body.Message)
+	default:
+		return 0, fmt.Errorf("delay test failed with status %d", resp.StatusCode)
+	}
+}
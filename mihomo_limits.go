@@ -0,0 +1,86 @@
+package libunifiedcore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	mihomolog "github.com/metacubex/mihomo/log"
+	"github.com/metacubex/mihomo/tunnel/statistic"
+)
+
+// connectionLimitInterval is how often tracked connections are counted
+// against the limit.
+const connectionLimitInterval = 250 * time.Millisecond
+
+// SetMaxConnections caps the number of concurrent connections tracked by
+// Mihomo. Mihomo has no admission hook, so the cap is enforced by closing
+// the newest connections past the limit shortly after they open. 0 removes
+// the cap.
+func (m *MihomoCoreManager) SetMaxConnections(n int) error {
+	if n < 0 {
+		return fmt.Errorf("invalid connection limit: %d", n)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.maxConnections = n
+	if m.isRunning {
+		m.startConnectionLimitLocked()
+	}
+	if n == 0 {
+		mihomolog.Infoln("Connection limit removed")
+	} else {
+		mihomolog.Infoln("Connection limit set to %d", n)
+	}
+	return nil
+}
+
+// startConnectionLimitLocked (re)starts the enforcer for the current limit.
+// Callers must hold m.mu.
+func (m *MihomoCoreManager) startConnectionLimitLocked() {
+	if m.connLimitCancel != nil {
+		m.connLimitCancel()
+		m.connLimitCancel = nil
+	}
+	if m.maxConnections == 0 || m.ctx == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.connLimitCancel = cancel
+	go enforceConnectionLimit(ctx, m.maxConnections)
+}
+
+func enforceConnectionLimit(ctx context.Context, limit int) {
+	ticker := time.NewTicker(connectionLimitInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var trackers []statistic.Tracker
+		statistic.DefaultManager.Range(func(t statistic.Tracker) bool {
+			trackers = append(trackers, t)
+			return true
+		})
+		if len(trackers) <= limit {
+			continue
+		}
+
+		// Keep the oldest connections, reject the ones past the limit
+		sort.Slice(trackers, func(i, j int) bool {
+			return trackers[i].Info().Start.Before(trackers[j].Info().Start)
+		})
+		for _, t := range trackers[limit:] {
+			t.Close()
+		}
+		mihomolog.Warnln("Connection limit %d reached, closed %d connections", limit, len(trackers)-limit)
+	}
+}
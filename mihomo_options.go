@@ -0,0 +1,225 @@
+package libunifiedcore
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/metacubex/bbolt"
+	"github.com/metacubex/mihomo/component/profile/cachefile"
+	C "github.com/metacubex/mihomo/constant"
+	mihomolog "github.com/metacubex/mihomo/log"
+)
+
+// SetDNSListen overrides dns.listen of the Mihomo config on the next start,
+// e.g. "127.0.0.1:1053". The port must not collide with the mixed/SOCKS or
+// API port. An empty addr removes the override.
+func (m *MihomoCoreManager) SetDNSListen(addr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if addr == "" {
+		m.patches.set("dns-listen", nil)
+		mihomolog.Infoln("DNS listen override removed")
+		return nil
+	}
+
+	port, err := parseListenAddr(addr)
+	if err != nil {
+		return fmt.Errorf("invalid DNS listen address %q: %w", addr, err)
+	}
+	if port == m.socksPort || port == m.apiPort {
+		return fmt.Errorf("DNS listen port %d conflicts with the mixed/API port", port)
+	}
+
+	m.patches.set("dns-listen", func(config map[string]interface{}) error {
+		for _, key := range []string{"mixed-port", "socks-port", "port", "external-controller"} {
+			if configPort(config[key]) == port {
+				return fmt.Errorf("DNS listen port %d conflicts with %s", port, key)
+			}
+		}
+		configSection(config, "dns")["listen"] = addr
+		return nil
+	})
+
+	mihomolog.Infoln("DNS listen address set to: %s", addr)
+	return nil
+}
+
+// parseListenAddr validates a host:port listen address and returns the port.
+func parseListenAddr(addr string) (int, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return 0, err
+	}
+	if host != "" && net.ParseIP(host) == nil {
+		return 0, fmt.Errorf("host must be an IP address")
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q", portStr)
+	}
+	return port, nil
+}
+
+// configPort reads a port from a config value that is either a number or an
+// address like "127.0.0.1:9090".
+func configPort(value interface{}) int {
+	switch v := value.(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	case string:
+		if i := strings.LastIndex(v, ":"); i >= 0 {
+			v = v[i+1:]
+		}
+		port, _ := strconv.Atoi(v)
+		return port
+	}
+	return 0
+}
+
+// SetCacheDir moves Mihomo's cache.db, which holds the stored proxy
+// selections and fake-ip mappings, out of the home directory, e.g. when the
+// asset bundle is read-only. Takes effect on the next start; an empty dir
+// keeps the cache in the home directory.
+func (m *MihomoCoreManager) SetCacheDir(dir string) error {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create cache directory: %w", err)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cacheDir = dir
+	mihomolog.Infoln("Cache directory set to: %s", dir)
+	return nil
+}
+
+// openCacheIn opens Mihomo's cache file in dir. The cache path is derived
+// from the home dir, so it is pointed at dir while the cache is opened and
+// restored to homeDir afterwards. Mihomo opens its cache once per process;
+// when it is already open somewhere else (e.g. in the ephemeral dir of an
+// earlier start, which is gone by now) the file is closed and reopened in
+// dir.
+func openCacheIn(dir, homeDir string) {
+	C.SetHomeDir(dir)
+	cache := cachefile.Cache()
+	want := C.Path.Cache()
+	C.SetHomeDir(homeDir)
+
+	if cache.DB != nil && cache.DB.Path() == want {
+		return
+	}
+	if cache.DB != nil {
+		if err := cache.DB.Close(); err != nil {
+			mihomolog.Warnln("Failed to close cache file %s: %v", cache.DB.Path(), err)
+		}
+	}
+	db, err := bbolt.Open(want, 0o666, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		mihomolog.Warnln("Cache file could not be opened in %s: %v", dir, err)
+		db = nil
+	}
+	cache.DB = db
+}
+
+// SetFallbackOutbound makes sure the Mihomo config ends with a catch-all
+// rule on the next start, so unmatched traffic does not silently go
+// nowhere. mode is "direct", "proxy" (the first proxy group, or the first
+// proxy when there are no groups) or "reject". A config that already has a
+// MATCH rule keeps it; a warning is logged when it sends traffic somewhere
+// else than mode. An empty mode removes the fallback.
+func (m *MihomoCoreManager) SetFallbackOutbound(mode string) error {
+	mode = strings.ToLower(mode)
+	switch mode {
+	case "":
+		m.mu.Lock()
+		m.patches.set("fallback-outbound", nil)
+		m.mu.Unlock()
+		mihomolog.Infoln("Fallback outbound removed")
+		return nil
+	case "direct", "proxy", "reject":
+	default:
+		return fmt.Errorf("invalid fallback outbound mode: %s", mode)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.patches.set("fallback-outbound", func(config map[string]interface{}) error {
+		return ensureFallbackRule(config, mode)
+	})
+	mihomolog.Infoln("Fallback outbound set to: %s", mode)
+	return nil
+}
+
+// ensureFallbackRule appends a MATCH rule for mode unless the config already
+// has one.
+func ensureFallbackRule(config map[string]interface{}, mode string) error {
+	rules, _ := config["rules"].([]interface{})
+	for _, rule := range rules {
+		s, _ := rule.(string)
+		ruleType, target := mihomoRuleTarget(s)
+		if ruleType != "MATCH" {
+			continue
+		}
+		builtin := strings.ToUpper(target)
+		var conflict bool
+		switch mode {
+		case "direct":
+			conflict = builtin != "DIRECT"
+		case "reject":
+			conflict = builtin != "REJECT" && builtin != "REJECT-DROP"
+		case "proxy":
+			conflict = builtin == "DIRECT" || builtin == "REJECT" || builtin == "REJECT-DROP"
+		}
+		if conflict {
+			mihomolog.Warnln("Config already ends with %q, keeping it instead of the %s fallback", s, mode)
+		}
+		return nil
+	}
+
+	target := strings.ToUpper(mode)
+	if mode == "proxy" {
+		target = ""
+		for _, key := range []string{"proxy-groups", "proxies"} {
+			if items := configMaps(config, key); len(items) > 0 {
+				target, _ = items[0]["name"].(string)
+				break
+			}
+		}
+		if target == "" {
+			return fmt.Errorf("proxy fallback requested but the config has no proxies")
+		}
+	}
+
+	config["rules"] = append(rules, "MATCH,"+target)
+	mihomolog.Infoln("Added fallback rule MATCH,%s", target)
+	return nil
+}
+
+// SetConnectTimeout cancels dials through the running core's proxies that
+// take longer than d, see mihomo_proxy_wrapper.go. Mihomo's own dial
+// deadline is 5s, so only shorter values change anything. The timeout
+// survives config reloads; 0 removes it.
+func (m *MihomoCoreManager) SetConnectTimeout(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if time.Duration(m.connectTimeout.Swap(int64(d))) == d {
+		return
+	}
+	if m.isRunning {
+		m.installProxyWrapperLocked()
+	}
+	if d <= 0 {
+		mihomolog.Infoln("Connect timeout removed")
+	} else {
+		mihomolog.Infoln("Connect timeout set to %v", d)
+	}
+}
@@ -0,0 +1,161 @@
+package libunifiedcore
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	P "github.com/metacubex/mihomo/constant/provider"
+	"github.com/metacubex/mihomo/tunnel"
+	"gopkg.in/yaml.v3"
+)
+
+// ProviderStatus describes the state of a single proxy or rule provider
+// loaded by the running Mihomo core.
+type ProviderStatus struct {
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`  // "proxy" or "rule"
+	Type      string    `json:"type"`  // vehicle type: "http", "file", "inline", "compatible"
+	URL       string    `json:"url"`   // empty for non-http vehicles
+	Count     int       `json:"count"` // nodes for proxy providers, rules for rule providers
+	UpdatedAt time.Time `json:"updatedAt"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type providerUpdatedAt interface {
+	UpdatedAt() time.Time
+}
+
+type providerVehicle interface {
+	Vehicle() P.Vehicle
+}
+
+// GetProviderStatus reports every proxy and rule provider of the running core.
+// Compatible providers (the ones Mihomo synthesizes for inline proxies) are skipped.
+func (m *MihomoCoreManager) GetProviderStatus() ([]ProviderStatus, error) {
+	m.mu.RLock()
+	running := m.isRunning
+	m.mu.RUnlock()
+
+	if !running {
+		return nil, fmt.Errorf("mihomo core is not running")
+	}
+
+	var statuses []ProviderStatus
+	for _, p := range tunnel.Providers() {
+		if p.VehicleType() == P.Compatible {
+			continue
+		}
+		statuses = append(statuses, newProviderStatus(p, "proxy", p.Count()))
+	}
+	for _, p := range tunnel.RuleProviders() {
+		statuses = append(statuses, newProviderStatus(p, "rule", p.Count()))
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Kind != statuses[j].Kind {
+			return statuses[i].Kind < statuses[j].Kind
+		}
+		return statuses[i].Name < statuses[j].Name
+	})
+
+	return statuses, nil
+}
+
+func newProviderStatus(p P.Provider, kind string, count int) ProviderStatus {
+	status := ProviderStatus{
+		Name:  p.Name(),
+		Kind:  kind,
+		Type:  strings.ToLower(p.VehicleType().String()),
+		Count: count,
+	}
+
+	if u, ok := p.(providerUpdatedAt); ok {
+		status.UpdatedAt = u.UpdatedAt()
+	}
+	if v, ok := p.(providerVehicle); ok && v.Vehicle() != nil {
+		status.URL = v.Vehicle().Url()
+	}
+
+	// Mihomo does not keep the last fetch error, but an http provider that
+	// was never updated (or resolved to nothing) has clearly failed to fetch.
+	if p.VehicleType() == P.HTTP {
+		if status.UpdatedAt.IsZero() {
+			status.Error = "provider has never been fetched successfully"
+		} else if count == 0 {
+			status.Error = "provider fetched but is empty"
+		}
+	}
+
+	return status
+}
+
+// RuleProviderConfig is a rule provider of the running core as Mihomo
+// parsed it. IntervalSeconds is 0 for providers that are not updated
+// automatically.
+type RuleProviderConfig struct {
+	Name            string `json:"name"`
+	Type            string `json:"type"`     // vehicle type: "http", "file", "inline"
+	Behavior        string `json:"behavior"` // "domain", "ipcidr" or "classical"
+	Format          string `json:"format"`   // "yaml", "text" or "mrs"
+	URL             string `json:"url"`
+	Path            string `json:"path"`
+	Proxy           string `json:"proxy"`
+	IntervalSeconds int    `json:"intervalSeconds"`
+}
+
+// GetRuleProviderConfig reports the URL, update interval, behavior and
+// format of every rule provider of the running core. Mihomo keeps the update
+// interval to itself, so it is taken from the rule-providers section of the
+// applied config.
+func (m *MihomoCoreManager) GetRuleProviderConfig() ([]RuleProviderConfig, error) {
+	m.mu.RLock()
+	running, sections := m.isRunning, m.ruleProviderSections
+	m.mu.RUnlock()
+
+	if !running {
+		return nil, fmt.Errorf("mihomo core is not running")
+	}
+
+	var configs []RuleProviderConfig
+	for name, p := range tunnel.RuleProviders() {
+		config := RuleProviderConfig{
+			Name:     name,
+			Type:     strings.ToLower(p.VehicleType().String()),
+			Behavior: strings.ToLower(p.Behavior().String()),
+		}
+		if v, ok := p.(providerVehicle); ok && v.Vehicle() != nil {
+			config.URL = v.Vehicle().Url()
+			config.Path = v.Vehicle().Path()
+			config.Proxy = v.Vehicle().Proxy()
+		}
+		// The format is only exposed through the API representation
+		var api struct {
+			Format string `json:"format"`
+		}
+		if data, err := json.Marshal(p); err == nil && json.Unmarshal(data, &api) == nil {
+			config.Format = strings.ToLower(api.Format)
+		}
+		config.IntervalSeconds = configPort(sections[name]["interval"])
+		configs = append(configs, config)
+	}
+
+	sort.Slice(configs, func(i, j int) bool {
+		return configs[i].Name < configs[j].Name
+	})
+	return configs, nil
+}
+
+// ruleProviderSections returns the rule-providers section of a Mihomo
+// config in YAML.
+func ruleProviderSections(configBytes []byte) map[string]map[string]interface{} {
+	var raw struct {
+		RuleProviders map[string]map[string]interface{} `yaml:"rule-providers"`
+	}
+	if err := yaml.Unmarshal(configBytes, &raw); err != nil {
+		return nil
+	}
+	return raw.RuleProviders
+}
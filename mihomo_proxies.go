@@ -0,0 +1,119 @@
+package libunifiedcore
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/metacubex/mihomo/adapter"
+	C "github.com/metacubex/mihomo/constant"
+	mihomolog "github.com/metacubex/mihomo/log"
+	"github.com/metacubex/mihomo/tunnel"
+)
+
+// AddProxy adds the proxy described by proxyConfig (a Mihomo proxy entry
+// as JSON) to the running core, and to the select group toGroup when it is
+// set. Without a group the proxy is added to the core in place and can be
+// used by rules and SelectProxy right away. Mihomo builds a group's member
+// list when the config is applied and cannot extend it afterwards, so with
+// a group the config is re-applied in place: listeners, tun and open
+// connections are kept, as are the current selections. The proxy is kept
+// for later reloads and restarts of this manager.
+func (m *MihomoCoreManager) AddProxy(proxyConfig json.RawMessage, toGroup string) error {
+	var mapping map[string]interface{}
+	if err := json.Unmarshal(proxyConfig, &mapping); err != nil {
+		return fmt.Errorf("failed to parse proxy config: %w", err)
+	}
+	name, _ := mapping["name"].(string)
+	if name == "" {
+		return fmt.Errorf("proxy config has no name")
+	}
+	proxy, err := adapter.ParseProxy(mapping)
+	if err != nil {
+		return fmt.Errorf("invalid proxy config: %w", err)
+	}
+
+	m.mu.Lock()
+	if !m.isRunning {
+		m.mu.Unlock()
+		return fmt.Errorf("mihomo core is not running")
+	}
+	if err := checkAllowedProtocols(m.allowedProtocols, CoreTypeMihomo, map[string]interface{}{"proxies": []interface{}{mapping}}); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	proxies := tunnel.Proxies()
+	if _, exists := proxies[name]; exists {
+		m.mu.Unlock()
+		return fmt.Errorf("proxy already exists: %s", name)
+	}
+	if toGroup != "" {
+		group, exists := proxies[toGroup]
+		if !exists {
+			m.mu.Unlock()
+			return fmt.Errorf("proxy group not found: %s", toGroup)
+		}
+		if group.Type() != C.Selector {
+			m.mu.Unlock()
+			return fmt.Errorf("proxy group %s is not a select group", toGroup)
+		}
+	}
+
+	patchName := "add-proxy:" + name
+	m.patches.set(patchName, func(config map[string]interface{}) error {
+		for _, existing := range mihomoProxies(config) {
+			if existing["name"] == name {
+				return nil
+			}
+		}
+		// Each apply gets its own copy, patches may modify the entry
+		var entry map[string]interface{}
+		if err := json.Unmarshal(proxyConfig, &entry); err != nil {
+			return err
+		}
+		list, _ := config["proxies"].([]interface{})
+		config["proxies"] = append(list, entry)
+
+		if toGroup == "" {
+			return nil
+		}
+		for _, group := range configMaps(config, "proxy-groups") {
+			if group["name"] != toGroup {
+				continue
+			}
+			members, _ := group["proxies"].([]interface{})
+			group["proxies"] = append(members, name)
+			return nil
+		}
+		return fmt.Errorf("proxy group not found: %s", toGroup)
+	})
+
+	if toGroup == "" {
+		updated := make(map[string]C.Proxy, len(proxies)+1)
+		for n, p := range proxies {
+			updated[n] = p
+		}
+		updated[name] = proxy
+		tunnel.UpdateProxies(updated, tunnel.Providers())
+		if m.proxyWrapperNeeded() {
+			m.installProxyWrapperLocked()
+		}
+		m.mu.Unlock()
+		mihomolog.Infoln("Added proxy %s", name)
+		return nil
+	}
+
+	configPath := m.configPath
+	m.mu.Unlock()
+
+	selections := currentSelections()
+	if err := m.reloadConfig(configPath, true); err != nil {
+		m.mu.Lock()
+		m.patches.set(patchName, nil)
+		m.mu.Unlock()
+		return fmt.Errorf("failed to add proxy %s to %s: %w", name, toGroup, err)
+	}
+	restoreSelections(selections)
+
+	mihomolog.Infoln("Added proxy %s to group %s", name, toGroup)
+	return nil
+}
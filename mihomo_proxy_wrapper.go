@@ -0,0 +1,95 @@
+package libunifiedcore
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	C "github.com/metacubex/mihomo/constant"
+	"github.com/metacubex/mihomo/tunnel"
+)
+
+// proxyWrapperNeeded reports whether a setting needs the proxies wrapped.
+func (m *MihomoCoreManager) proxyWrapperNeeded() bool {
+	return m.connRateLimit.Load() > 0 || m.connectTimeout.Load() > 0 || m.rateStreams.Load() > 0
+}
+
+// installProxyWrapperLocked wraps the proxies of the tunnel to apply the
+// connection rate limit and connect timeout and to count connections for
+// RateStream, or unwraps them when none of these is needed. Mihomo replaces the proxies on every config apply, so this runs
+// after each one. Callers must hold m.mu.
+func (m *MihomoCoreManager) installProxyWrapperLocked() {
+	needed := m.proxyWrapperNeeded()
+	proxies := tunnel.Proxies()
+	wrapped := make(map[string]C.Proxy, len(proxies))
+	for name, proxy := range proxies {
+		if w, ok := proxy.(*wrappedProxy); ok {
+			proxy = w.Proxy
+		}
+		if needed {
+			proxy = &wrappedProxy{Proxy: proxy, limit: &m.connRateLimit, connectTimeout: &m.connectTimeout, counters: &m.connCounters}
+		}
+		wrapped[name] = proxy
+	}
+	tunnel.UpdateProxies(wrapped, tunnel.Providers())
+}
+
+// wrappedProxy bounds dials of the proxy it wraps by the connect timeout
+// and returns rate-limited connections while a limit is set. While a
+// RateStream runs, opened and closed connections are counted.
+type wrappedProxy struct {
+	C.Proxy
+	limit          *atomic.Int64
+	connectTimeout *atomic.Int64
+	counters       *connCounters
+}
+
+// connCounters counts the connections dialed through wrapped proxies.
+// counting is only set while a RateStream runs, so connections dialed
+// before it are not counted as closed.
+type connCounters struct {
+	counting atomic.Bool
+	opened   atomic.Int64
+	closed   atomic.Int64
+}
+
+func (p *wrappedProxy) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn, error) {
+	if timeout := time.Duration(p.connectTimeout.Load()); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	conn, err := p.Proxy.DialContext(ctx, metadata)
+	if err != nil {
+		return conn, err
+	}
+	if p.limit.Load() > 0 {
+		connCtx, cancel := context.WithCancel(context.Background())
+		conn = &rateLimitedConn{
+			Conn:   conn,
+			ctx:    connCtx,
+			cancel: cancel,
+			read:   &tokenBucket{limit: p.limit},
+			write:  &tokenBucket{limit: p.limit},
+		}
+	}
+	if p.counters.counting.Load() {
+		p.counters.opened.Add(1)
+		conn = &countedConn{Conn: conn, counters: p.counters}
+	}
+	return conn, nil
+}
+
+// countedConn counts its first Close for RateStream.
+type countedConn struct {
+	C.Conn
+	counters *connCounters
+	closed   atomic.Bool
+}
+
+func (c *countedConn) Close() error {
+	if c.closed.CompareAndSwap(false, true) {
+		c.counters.closed.Add(1)
+	}
+	return c.Conn.Close()
+}
@@ -0,0 +1,125 @@
+package libunifiedcore
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/metacubex/mihomo/common/buf"
+	C "github.com/metacubex/mihomo/constant"
+	mihomolog "github.com/metacubex/mihomo/log"
+)
+
+// SetConnectionRateLimit throttles every TCP connection of the running core
+// to bytesPerSec in each direction. Mihomo has no per-connection hook, so the
+// proxies of the config are wrapped to return rate-limited connections, see
+// mihomo_proxy_wrapper.go; a changed limit also applies to connections
+// opened while a limit was set. UDP is not limited. The limit survives
+// config reloads; 0 disables it.
+func (m *MihomoCoreManager) SetConnectionRateLimit(bytesPerSec int64) error {
+	if bytesPerSec < 0 {
+		return fmt.Errorf("invalid connection rate limit: %d", bytesPerSec)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.connRateLimit.Store(bytesPerSec)
+	if m.isRunning {
+		m.installProxyWrapperLocked()
+	}
+	if bytesPerSec == 0 {
+		mihomolog.Infoln("Connection rate limit removed")
+	} else {
+		mihomolog.Infoln("Connection rate limit set to %d bytes/s", bytesPerSec)
+	}
+	return nil
+}
+
+// rateLimitedConn delays reads and writes to stay within the limit. Only
+// the methods of C.Conn are promoted from the wrapped connection, so relays
+// cannot unwrap it and copy around the limiter.
+type rateLimitedConn struct {
+	C.Conn
+	ctx    context.Context
+	cancel context.CancelFunc
+	read   *tokenBucket
+	write  *tokenBucket
+}
+
+func (c *rateLimitedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.read.wait(c.ctx, n)
+	return n, err
+}
+
+func (c *rateLimitedConn) ReadBuffer(buffer *buf.Buffer) error {
+	err := c.Conn.ReadBuffer(buffer)
+	c.read.wait(c.ctx, buffer.Len())
+	return err
+}
+
+func (c *rateLimitedConn) Write(b []byte) (int, error) {
+	if err := c.write.wait(c.ctx, len(b)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *rateLimitedConn) WriteBuffer(buffer *buf.Buffer) error {
+	if err := c.write.wait(c.ctx, buffer.Len()); err != nil {
+		buffer.Release()
+		return err
+	}
+	return c.Conn.WriteBuffer(buffer)
+}
+
+func (c *rateLimitedConn) Close() error {
+	c.cancel()
+	return c.Conn.Close()
+}
+
+// tokenBucket allows limit bytes per second with a burst of one second.
+// Tokens may go negative, so a large read is paid for by later waits.
+type tokenBucket struct {
+	limit *atomic.Int64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// wait blocks until n bytes fit within the current limit, or ctx is done.
+func (b *tokenBucket) wait(ctx context.Context, n int) error {
+	rate := float64(b.limit.Load())
+	if rate <= 0 || n <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	now := time.Now()
+	if b.last.IsZero() {
+		b.tokens = rate
+	} else {
+		b.tokens = math.Min(rate, b.tokens+now.Sub(b.last).Seconds()*rate)
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	delay := time.Duration(-b.tokens / rate * float64(time.Second))
+	b.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
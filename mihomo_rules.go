@@ -0,0 +1,384 @@
+package libunifiedcore
+
+import (
+	"fmt"
+	"net/netip"
+	"runtime"
+	"sort"
+	"strings"
+
+	P "github.com/metacubex/mihomo/component/process"
+	C "github.com/metacubex/mihomo/constant"
+	mihomolog "github.com/metacubex/mihomo/log"
+	R "github.com/metacubex/mihomo/rules"
+	RC "github.com/metacubex/mihomo/rules/common"
+	"github.com/metacubex/mihomo/tunnel"
+)
+
+// Dynamic rules are installed on the running core in front of the rules from
+// the config, grouped in named layers so each API owns and replaces its own
+// set. Layers are kept across restarts and re-installed after each apply.
+
+// setRuleLayerLocked replaces the rule lines of a layer and re-installs the
+// rule table if the core is running. Callers must hold m.mu.
+func (m *MihomoCoreManager) setRuleLayerLocked(name string, lines []string) error {
+	if m.ruleLayers == nil {
+		m.ruleLayers = make(map[string][]string)
+	}
+
+	previous, existed := m.ruleLayers[name]
+	if len(lines) == 0 {
+		delete(m.ruleLayers, name)
+		for i, n := range m.ruleLayerOrder {
+			if n == name {
+				m.ruleLayerOrder = append(m.ruleLayerOrder[:i:i], m.ruleLayerOrder[i+1:]...)
+				break
+			}
+		}
+	} else {
+		if !existed {
+			m.ruleLayerOrder = append(m.ruleLayerOrder, name)
+		}
+		m.ruleLayers[name] = lines
+	}
+
+	if !m.isRunning {
+		return nil
+	}
+
+	if err := m.installRulesLocked(); err != nil {
+		// Roll back so the stored layers always match what is installed.
+		if existed {
+			m.ruleLayers[name] = previous
+		} else {
+			delete(m.ruleLayers, name)
+			m.ruleLayerOrder = m.ruleLayerOrder[:len(m.ruleLayerOrder)-1]
+		}
+		return err
+	}
+	return nil
+}
+
+// installRulesLocked builds dynamic layers + config rules and hands them to
+// the tunnel. Callers must hold m.mu.
+func (m *MihomoCoreManager) installRulesLocked() error {
+	var rules []C.Rule
+	for _, name := range m.ruleLayerOrder {
+		for _, line := range m.ruleLayers[name] {
+			rule, err := parseRuleLine(line, m.baseSubRules)
+			if err != nil {
+				return fmt.Errorf("invalid %s rule %q: %w", name, line, err)
+			}
+			rules = append(rules, rule)
+		}
+	}
+	rules = append(rules, m.baseRules...)
+
+	tunnel.UpdateRules(rules, m.baseSubRules, tunnel.RuleProviders())
+	mihomolog.Infoln("Installed %d rules (%d dynamic)", len(rules), len(rules)-len(m.baseRules))
+	return nil
+}
+
+func parseRuleLine(line string, subRules map[string][]C.Rule) (C.Rule, error) {
+	tp, payload, target, params := RC.ParseRulePayload(line, true)
+	if target == "" {
+		return nil, fmt.Errorf("format invalid")
+	}
+	return R.ParseRule(tp, payload, target, params, subRules)
+}
+
+// hostRuleType picks the rule type matching a host: IP-CIDR for addresses and
+// prefixes, DOMAIN-SUFFIX for "+." / "*." wildcards, DOMAIN otherwise.
+func hostRuleType(host string) (string, string) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if addr.Is6() {
+			return "IP-CIDR6", netip.PrefixFrom(addr, 128).String()
+		}
+		return "IP-CIDR", netip.PrefixFrom(addr, 32).String()
+	}
+	if prefix, err := netip.ParsePrefix(host); err == nil {
+		if prefix.Addr().Is6() {
+			return "IP-CIDR6", prefix.Masked().String()
+		}
+		return "IP-CIDR", prefix.Masked().String()
+	}
+	for _, wildcard := range []string{"+.", "*."} {
+		if strings.HasPrefix(host, wildcard) {
+			return "DOMAIN-SUFFIX", strings.TrimPrefix(host, wildcard)
+		}
+	}
+	return "DOMAIN", host
+}
+
+// SetConnectionPolicy routes host through proxy on the running core, ahead of
+// every rule from the config. host may be a domain, "+.domain" for the
+// domain and its subdomains, an IP or a CIDR. The override is not written to
+// the config and is re-installed if the core restarts.
+func (m *MihomoCoreManager) SetConnectionPolicy(host string, proxy string) error {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if host == "" {
+		return fmt.Errorf("host is required")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.isRunning {
+		return fmt.Errorf("mihomo core is not running")
+	}
+	if _, exists := tunnel.Proxies()[proxy]; !exists {
+		return fmt.Errorf("proxy not found: %s", proxy)
+	}
+
+	policies := make(map[string]string, len(m.connectionPolicies)+1)
+	for h, p := range m.connectionPolicies {
+		policies[h] = p
+	}
+	policies[host] = proxy
+
+	if err := m.setRuleLayerLocked("connection-policy", connectionPolicyRules(policies)); err != nil {
+		return err
+	}
+	m.connectionPolicies = policies
+
+	mihomolog.Infoln("Connection policy set: %s -> %s", host, proxy)
+	return nil
+}
+
+// ClearConnectionPolicy removes the override installed for host.
+func (m *MihomoCoreManager) ClearConnectionPolicy(host string) error {
+	host = strings.ToLower(strings.TrimSpace(host))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.connectionPolicies[host]; !exists {
+		return nil
+	}
+
+	policies := make(map[string]string, len(m.connectionPolicies))
+	for h, p := range m.connectionPolicies {
+		if h != host {
+			policies[h] = p
+		}
+	}
+
+	if err := m.setRuleLayerLocked("connection-policy", connectionPolicyRules(policies)); err != nil {
+		return err
+	}
+	m.connectionPolicies = policies
+
+	mihomolog.Infoln("Connection policy cleared: %s", host)
+	return nil
+}
+
+func connectionPolicyRules(policies map[string]string) []string {
+	hosts := make([]string, 0, len(policies))
+	for host := range policies {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	lines := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		tp, payload := hostRuleType(host)
+		lines = append(lines, fmt.Sprintf("%s,%s,%s", tp, payload, policies[host]))
+	}
+	return lines
+}
+
+// SetDirectDomains makes the given domains bypass the proxy, ahead of every
+// rule from the config. Entries are exact domains or "+.domain" / "*.domain"
+// for the domain and its subdomains. An empty list removes the bypass.
+func (m *MihomoCoreManager) SetDirectDomains(domains []string) error {
+	lines := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if !validDomainPattern(domain) {
+			return fmt.Errorf("invalid domain: %q", domain)
+		}
+		tp, payload := hostRuleType(domain)
+		lines = append(lines, fmt.Sprintf("%s,%s,DIRECT", tp, payload))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.setRuleLayerLocked("direct-domains", lines); err != nil {
+		return err
+	}
+	mihomolog.Infoln("Direct domains set: %d entries", len(lines))
+	return nil
+}
+
+// SetDirectIPs makes the given IPs / CIDRs bypass the proxy, ahead of every
+// rule from the config. An empty list removes the bypass.
+func (m *MihomoCoreManager) SetDirectIPs(cidrs []string) error {
+	lines := make([]string, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		tp, payload := hostRuleType(cidr)
+		if tp != "IP-CIDR" && tp != "IP-CIDR6" {
+			return fmt.Errorf("invalid CIDR: %q", cidr)
+		}
+		// no-resolve: these rules sit in front of everything, so they must
+		// not force a DNS lookup for every domain connection
+		lines = append(lines, fmt.Sprintf("%s,%s,DIRECT,no-resolve", tp, payload))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.setRuleLayerLocked("direct-ips", lines); err != nil {
+		return err
+	}
+	mihomolog.Infoln("Direct IPs set: %d entries", len(lines))
+	return nil
+}
+
+// ProcessRule routes the connections of an app through Proxy. Type is one of
+// PROCESS-NAME (the default), PROCESS-PATH, PROCESS-NAME-REGEX or
+// PROCESS-PATH-REGEX; Match is the process name, path or pattern.
+type ProcessRule struct {
+	Type  string `json:"type"`
+	Match string `json:"match"`
+	Proxy string `json:"proxy"`
+}
+
+// processRuleTypes are the rule types SetProcessRules accepts.
+var processRuleTypes = map[string]bool{
+	"PROCESS-NAME":       true,
+	"PROCESS-PATH":       true,
+	"PROCESS-NAME-REGEX": true,
+	"PROCESS-PATH-REGEX": true,
+}
+
+// SetProcessRules routes connections by the app that opened them, ahead of
+// every rule from the config. Mihomo can only look up the process of a
+// connection on desktop platforms and Android, so other platforms are
+// rejected. The rules are re-installed if the core restarts; an empty list
+// removes them.
+func (m *MihomoCoreManager) SetProcessRules(rules []ProcessRule) error {
+	lines := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		tp := strings.ToUpper(strings.TrimSpace(rule.Type))
+		if tp == "" {
+			tp = "PROCESS-NAME"
+		}
+		if !processRuleTypes[tp] {
+			return fmt.Errorf("invalid process rule type: %q", rule.Type)
+		}
+		if rule.Match == "" || strings.ContainsAny(rule.Match, ",\n") {
+			return fmt.Errorf("invalid process rule match: %q", rule.Match)
+		}
+		if rule.Proxy == "" {
+			return fmt.Errorf("process rule for %s has no proxy", rule.Match)
+		}
+		line := fmt.Sprintf("%s,%s,%s", tp, rule.Match, rule.Proxy)
+		if _, err := parseRuleLine(line, nil); err != nil {
+			return fmt.Errorf("invalid process rule %q: %w", line, err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) > 0 && !processLookupSupported() {
+		return fmt.Errorf("process rules are not supported on %s", runtime.GOOS)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(lines) > 0 {
+		if !m.isRunning {
+			return fmt.Errorf("mihomo core is not running")
+		}
+		proxies := tunnel.Proxies()
+		for _, rule := range rules {
+			if _, exists := proxies[rule.Proxy]; !exists {
+				return fmt.Errorf("proxy not found: %s", rule.Proxy)
+			}
+		}
+		if tunnel.FindProcessMode() == P.FindProcessOff {
+			mihomolog.Warnln("find-process-mode is off, process rules will not match")
+		}
+	}
+
+	if err := m.setRuleLayerLocked("process-rules", lines); err != nil {
+		return err
+	}
+	mihomolog.Infoln("Process rules set: %d entries", len(lines))
+	return nil
+}
+
+// processLookupSupported mirrors the platforms Mihomo's process lookup is
+// built for.
+func processLookupSupported() bool {
+	switch runtime.GOOS {
+	case "darwin", "linux", "android", "windows":
+		return true
+	case "freebsd":
+		return runtime.GOARCH == "amd64"
+	}
+	return false
+}
+
+// validDomainPattern accepts a domain name, optionally prefixed with "+." or
+// "*.".
+func validDomainPattern(domain string) bool {
+	for _, wildcard := range []string{"+.", "*."} {
+		domain = strings.TrimPrefix(domain, wildcard)
+	}
+	if domain == "" || len(domain) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// RulesSummary counts the rules loaded in the running engine, including
+// dynamic layers. RuleSetRules are the RULE-SET rules themselves, while
+// ProviderEntries is the number of payload entries loaded in the providers
+// they reference.
+type RulesSummary struct {
+	Total           int            `json:"total"`
+	ByType          map[string]int `json:"byType"`
+	InlineRules     int            `json:"inlineRules"`
+	RuleSetRules    int            `json:"ruleSetRules"`
+	ProviderEntries int            `json:"providerEntries"`
+}
+
+// GetRulesSummary counts the rules of the running core by type, using the
+// rule type names Mihomo reports (e.g. DomainSuffix, IPCIDR, GeoIP).
+func (m *MihomoCoreManager) GetRulesSummary() (*RulesSummary, error) {
+	if !m.IsRunning() {
+		return nil, fmt.Errorf("mihomo core is not running")
+	}
+
+	rules := tunnel.Rules()
+	providers := tunnel.RuleProviders()
+	summary := &RulesSummary{Total: len(rules), ByType: make(map[string]int)}
+	counted := make(map[string]bool)
+	for _, rule := range rules {
+		summary.ByType[rule.RuleType().String()]++
+		if rule.RuleType() != C.RuleSet {
+			summary.InlineRules++
+			continue
+		}
+
+		summary.RuleSetRules++
+		name := rule.Payload()
+		if provider, exists := providers[name]; exists && !counted[name] {
+			counted[name] = true
+			summary.ProviderEntries += provider.Count()
+		}
+	}
+	return summary, nil
+}
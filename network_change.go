@@ -0,0 +1,70 @@
+package libunifiedcore
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/metacubex/mihomo/component/iface"
+	"github.com/metacubex/mihomo/component/resolver"
+	mihomolog "github.com/metacubex/mihomo/log"
+	"github.com/metacubex/mihomo/tunnel"
+	"github.com/metacubex/mihomo/tunnel/statistic"
+)
+
+// NotifyNetworkChange tells the core that the device switched networks,
+// e.g. from wifi to cellular, so connections bound to the old network do not
+// wedge the tunnel. Call it from the platform connectivity callback.
+//
+// Mihomo is reset in place: open connections are closed so apps reconnect,
+// the interface and DNS caches are flushed, DNS connections are reopened
+// and proxy groups are health-checked again. Xray cannot reset its
+// connections or DNS cache at runtime, so it is restarted with the current
+// config, coalesced with other restarts, see Restart.
+func (u *UnifiedCoreManager) NotifyNetworkChange() error {
+	u.mu.RLock()
+	running, coreType, mihomoManager := u.running, u.coreType, u.mihomoManager
+	u.mu.RUnlock()
+
+	if !running {
+		return fmt.Errorf("no core running")
+	}
+
+	log.Printf("Network change, resetting %s core", coreType.DisplayName())
+	switch coreType {
+	case CoreTypeV2Ray, CoreTypeXray:
+		return u.Restart()
+	case CoreTypeMihomo:
+		if mihomoManager == nil {
+			return fmt.Errorf("mihomo core is not running")
+		}
+		return mihomoManager.resetNetworkState()
+	default:
+		return fmt.Errorf("unsupported core type: %v", coreType)
+	}
+}
+
+// resetNetworkState drops state tied to the previous network without
+// re-applying the config.
+func (m *MihomoCoreManager) resetNetworkState() error {
+	if !m.IsRunning() {
+		return fmt.Errorf("mihomo core is not running")
+	}
+
+	iface.FlushCache()
+	resolver.ClearCache()
+	resolver.ResetConnection()
+
+	closed := 0
+	statistic.DefaultManager.Range(func(t statistic.Tracker) bool {
+		t.Close()
+		closed++
+		return true
+	})
+
+	for _, provider := range tunnel.Providers() {
+		go provider.HealthCheck()
+	}
+
+	mihomolog.Infoln("Network state reset, closed %d connections", closed)
+	return nil
+}
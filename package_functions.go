@@ -1,10 +1,18 @@
 package libunifiedcore
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	C "github.com/metacubex/mihomo/constant"
+	core "github.com/xtls/xray-core/core"
 )
 
 var (
@@ -29,6 +37,7 @@ func NewUnifiedCoreManager() *UnifiedCoreManager {
 		logLevel:     globalLogLevel,
 		assetPath:    globalAssetPath,
 	}
+	manager.setPrewarmPatches()
 
 	log.Printf("Created new UnifiedCoreManager (isolated instance for ping test)")
 	return manager
@@ -69,17 +78,45 @@ func GetVersion() string {
 	return "UnifiedCore v1.0.0"
 }
 
+// GetCoreVersion reports the version the linked core reports about itself.
 func GetCoreVersion(coreType string) string {
 	switch coreType {
 	case "v2ray", "xray":
-		return "Xray-core v1.250608.0"
+		return "Xray-core v" + core.Version()
 	case "mihomo", "clash":
-		return "Mihomo v1.19.12"
+		return "Mihomo v" + strings.TrimPrefix(C.Version, "v")
 	default:
 		return "Unknown core type"
 	}
 }
 
+// coreModulePaths maps a core type to the Go module it is built from.
+var coreModulePaths = map[string]string{
+	"v2ray":  "github.com/xtls/xray-core",
+	"xray":   "github.com/xtls/xray-core",
+	"mihomo": "github.com/metacubex/mihomo",
+	"clash":  "github.com/metacubex/mihomo",
+}
+
+// linkedModuleVersion returns the version of a dependency module as recorded
+// in the binary's build info, honouring replace directives.
+func linkedModuleVersion(modulePath string) string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, dep := range info.Deps {
+		if dep.Path != modulePath {
+			continue
+		}
+		if dep.Replace != nil && dep.Replace.Version != "" {
+			return dep.Replace.Version
+		}
+		return dep.Version
+	}
+	return "unknown"
+}
+
 func TestConfigFile(configPath string, coreType string) bool {
 	manager := NewUnifiedCoreManager()
 
@@ -103,6 +140,98 @@ func TestConfigFile(configPath string, coreType string) bool {
 	return true
 }
 
+// TestConfigs validates many configs of one core type concurrently and
+// returns the result per path (nil when valid). Each worker uses its own
+// core manager, so no manager state is shared; Mihomo's home dir is set up
+// once before the workers start. Mihomo's parser switches process-wide
+// settings while it runs, so Mihomo configs are validated one at a time and
+// never while a running core parses its own config.
+func TestConfigs(paths []string, coreType string) map[string]error {
+	return TestConfigsContext(context.Background(), paths, coreType)
+}
+
+// TestConfigsContext is TestConfigs with a context. Once ctx is done, or
+// CancelBulkOperations is called, no further configs are validated and the
+// remaining paths report the context's error.
+func TestConfigsContext(ctx context.Context, paths []string, coreType string) map[string]error {
+	ctx, done := startBulkOperation(ctx)
+	defer done()
+
+	results := make(map[string]error, len(paths))
+
+	parsedType, err := ParseCoreType(coreType)
+	if err != nil {
+		for _, path := range paths {
+			results[path] = err
+		}
+		return results
+	}
+
+	var validate func(path string) error
+	switch parsedType {
+	case CoreTypeV2Ray, CoreTypeXray:
+		validate = func(path string) error {
+			v := NewV2RayCoreManager(0, 0)
+			v.SetAssetPath(globalAssetPath)
+			return v.TestConfig(path)
+		}
+	case CoreTypeMihomo:
+		env := NewMihomoCoreManager(0, 0)
+		env.SetAssetPath(globalAssetPath)
+		if err := env.setupEnvironment(); err != nil {
+			err = fmt.Errorf("failed to setup environment: %w", err)
+			for _, path := range paths {
+				results[path] = err
+			}
+			return results
+		}
+		validate = func(path string) error {
+			m := NewMihomoCoreManager(0, 0)
+			m.SetAssetPath(globalAssetPath)
+			return m.validateConfig(path)
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	jobs := make(chan string)
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				err := ctx.Err()
+				if err == nil {
+					err = validate(path)
+				}
+				mu.Lock()
+				results[path] = err
+				mu.Unlock()
+			}
+		}()
+	}
+
+	seen := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		select {
+		case jobs <- path:
+		case <-ctx.Done():
+			mu.Lock()
+			results[path] = ctx.Err()
+			mu.Unlock()
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	log.Printf("Tested %d %s configs", len(seen), parsedType.DisplayName())
+	return results
+}
+
 
 
 func SetGlobalPorts(socksPort, apiPort int) bool {
@@ -135,6 +264,24 @@ func ForceGC() {
 	log.Println("Forced garbage collection completed")
 }
 
+// SetMaxProcs caps how many CPUs run Go code at once and returns the previous
+// value. Lower values save battery while tunneling but slow down CPU-bound
+// work such as bulk pings and TLS handshakes; values above the CPU count are
+// clamped since they only add scheduling overhead.
+func SetMaxProcs(n int) (int, error) {
+	if n < 1 {
+		return 0, fmt.Errorf("invalid max procs: %d", n)
+	}
+	if numCPU := runtime.NumCPU(); n > numCPU {
+		log.Printf("Max procs %d exceeds CPU count, using %d", n, numCPU)
+		n = numCPU
+	}
+
+	previous := runtime.GOMAXPROCS(n)
+	log.Printf("GOMAXPROCS set to %d (was %d)", n, previous)
+	return previous, nil
+}
+
 func GetSupportedCoreTypes() []string {
 	return []string{"v2ray", "xray", "mihomo"}
 }
@@ -158,6 +305,50 @@ func GetRuntimeInfo() map[string]interface{} {
 	}
 }
 
+// RuntimeInfo is the stable JSON schema returned by GetRuntimeInfoJSON.
+type RuntimeInfo struct {
+	Version        string            `json:"version"`
+	GoVersion      string            `json:"go_version"`
+	NumCPU         int               `json:"num_cpu"`
+	NumGoroutines  int               `json:"num_goroutines"`
+	OS             string            `json:"os"`
+	Arch           string            `json:"arch"`
+	SupportedCores []string          `json:"supported_cores"`
+	CoreVersions   map[string]string `json:"core_versions"`
+	// Version of the Go module each core is built from, from the build info
+	CoreModules map[string]string `json:"core_modules"`
+}
+
+// GetRuntimeInfoJSON returns runtime and core version information as JSON
+// for callers across the gomobile boundary. Go callers can keep using
+// GetRuntimeInfo.
+func GetRuntimeInfoJSON() string {
+	info := RuntimeInfo{
+		Version:        GetVersion(),
+		GoVersion:      runtime.Version(),
+		NumCPU:         runtime.NumCPU(),
+		NumGoroutines:  runtime.NumGoroutine(),
+		OS:             runtime.GOOS,
+		Arch:           runtime.GOARCH,
+		SupportedCores: GetSupportedCoreTypes(),
+		CoreVersions:   make(map[string]string),
+		CoreModules:    make(map[string]string),
+	}
+	for _, coreType := range info.SupportedCores {
+		info.CoreVersions[coreType] = GetCoreVersion(coreType)
+		if modulePath, ok := coreModulePaths[coreType]; ok {
+			info.CoreModules[coreType] = linkedModuleVersion(modulePath)
+		}
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		log.Printf("Failed to marshal runtime info: %v", err)
+		return "{}"
+	}
+	return string(data)
+}
+
 func InitializeGlobalManager() bool {
 	if globalUnifiedManager != nil {
 		log.Println("Global unified manager already initialized")
@@ -0,0 +1,85 @@
+package libunifiedcore
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"sort"
+)
+
+// Permissions reported by GetRequiredPermissions.
+const (
+	PermissionVPN          = "vpn"           // tun device, e.g. Android VpnService
+	PermissionLocalNetwork = "local-network" // listening for other devices on the LAN
+	PermissionElevated     = "elevated"      // root or CAP_NET_BIND_SERVICE/CAP_NET_ADMIN
+)
+
+// privilegedPortMax is the highest port that needs elevated rights to bind.
+const privilegedPortMax = 1023
+
+// GetRequiredPermissions lists the host permissions a config needs, so the
+// app can ask for exactly those before starting it: PermissionVPN for a tun
+// device, PermissionLocalNetwork for listeners reachable from other devices
+// (allow-lan, inbounds not bound to loopback) and PermissionElevated for
+// ports below 1024, including DNS, and for transparent proxying (redir,
+// tproxy). configBytes is a JSON config as passed to RunConfig, with or
+// without the coreType wrapper. Returns nil for a config that does not
+// parse.
+func GetRequiredPermissions(configBytes []byte, coreType string) []string {
+	ct, err := ParseCoreType(coreType)
+	if err != nil {
+		log.Printf("Cannot check permissions: %v", err)
+		return nil
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(configBytes, &config); err != nil {
+		log.Printf("Cannot check permissions, config is not valid JSON: %v", err)
+		return nil
+	}
+	config = unwrapCoreConfig(config)
+
+	required := make(map[string]bool)
+	for _, lp := range configListenPorts(ct, config) {
+		if lp.port <= privilegedPortMax {
+			required[PermissionElevated] = true
+		}
+		if ip := net.ParseIP(lp.host); ip == nil || !ip.IsLoopback() {
+			required[PermissionLocalNetwork] = true
+		}
+	}
+
+	switch ct {
+	case CoreTypeMihomo:
+		if tun, _ := config["tun"].(map[string]interface{}); tun["enable"] == true {
+			required[PermissionVPN] = true
+		}
+		if configPort(config["redir-port"]) > 0 || configPort(config["tproxy-port"]) > 0 {
+			required[PermissionElevated] = true
+		}
+		if dns, _ := config["dns"].(map[string]interface{}); dns["enable"] == true {
+			if listen, _ := dns["listen"].(string); listen != "" {
+				if port := configPort(listen); port > 0 && port <= privilegedPortMax {
+					required[PermissionElevated] = true
+				}
+			}
+		}
+	case CoreTypeV2Ray, CoreTypeXray:
+		for _, inbound := range configMaps(config, "inbounds") {
+			if protocol, _ := inbound["protocol"].(string); protocol == "tun" {
+				required[PermissionVPN] = true
+			}
+			stream, _ := inbound["streamSettings"].(map[string]interface{})
+			sockopt, _ := stream["sockopt"].(map[string]interface{})
+			if mode, _ := sockopt["tproxy"].(string); mode == "redirect" || mode == "tproxy" {
+				required[PermissionElevated] = true
+			}
+		}
+	}
+
+	permissions := make([]string, 0, len(required))
+	for permission := range required {
+		permissions = append(permissions, permission)
+	}
+	sort.Strings(permissions)
+	return permissions
+}
@@ -0,0 +1,142 @@
+package libunifiedcore
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// pingCache keeps recent successful ping results of ValidateConnectivity,
+// TestOutbound, BulkPing and TestProxyDelayViaAPI, keyed by what was pinged
+// and the probe URL. It is package level because every ping runs on its own
+// manager.
+var pingCache = &latencyCache{entries: make(map[string]latencyCacheEntry)}
+
+type latencyCacheEntry struct {
+	result   interface{} // *ConnectivityReport or a latency in ms
+	storedAt time.Time
+}
+
+type latencyCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]latencyCacheEntry
+}
+
+// SetPingCacheTTL makes ValidateConnectivity, TestOutbound, BulkPing and
+// MihomoCoreManager.TestProxyDelayViaAPI return a successful result from the
+// last ttl for the same server and probe URL instead of probing again, so
+// repeated "test all" runs don't re-probe every server. BulkPing caches
+// Xray and Mihomo configs alike, keyed by config content. Failures are not
+// cached, so a server is retried right after a transient error. 0 disables
+// the cache and drops what it holds.
+func SetPingCacheTTL(ttl time.Duration) error {
+	if ttl < 0 {
+		return fmt.Errorf("invalid ping cache TTL: %v", ttl)
+	}
+
+	pingCache.mu.Lock()
+	defer pingCache.mu.Unlock()
+	pingCache.ttl = ttl
+	if ttl == 0 {
+		pingCache.entries = make(map[string]latencyCacheEntry)
+	}
+	log.Printf("Ping cache TTL set to %v", ttl)
+	return nil
+}
+
+// ClearPingCache drops every cached ping result.
+func ClearPingCache() {
+	pingCache.mu.Lock()
+	defer pingCache.mu.Unlock()
+	pingCache.entries = make(map[string]latencyCacheEntry)
+}
+
+// pingCacheKey identifies a ping by config content, the pinged proxy (""
+// for the config's default) and probe URL. It returns "" when the cache is
+// off or the config cannot be read.
+func pingCacheKey(configPath, proxy, probeURL string) string {
+	if !pingCache.enabled() {
+		return ""
+	}
+	configBytes, err := os.ReadFile(configPath)
+	if err != nil {
+		return ""
+	}
+	return pingCacheKeyBytes(configBytes, proxy, probeURL)
+}
+
+// pingCacheKeyBytes is pingCacheKey for config content.
+func pingCacheKeyBytes(configBytes []byte, proxy, probeURL string) string {
+	if !pingCache.enabled() {
+		return ""
+	}
+	return configChecksum(configBytes) + " " + proxy + " " + probeURL
+}
+
+func (c *latencyCache) enabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ttl > 0
+}
+
+// report returns a cached ValidateConnectivity report.
+func (c *latencyCache) report(key string) (*ConnectivityReport, bool) {
+	report, ok := c.get(key).(*ConnectivityReport)
+	if !ok {
+		return nil, false
+	}
+	copied := *report
+	return &copied, true
+}
+
+// latency returns a cached latency in ms.
+func (c *latencyCache) latency(key string) (int, bool) {
+	latency, ok := c.get(key).(int)
+	return latency, ok
+}
+
+func (c *latencyCache) get(key string) interface{} {
+	if key == "" {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, exists := c.entries[key]
+	if !exists {
+		return nil
+	}
+	if time.Since(entry.storedAt) > c.ttl {
+		delete(c.entries, key)
+		return nil
+	}
+	return entry.result
+}
+
+// put stores a successful result; callers must not pass failures.
+func (c *latencyCache) put(key string, result interface{}) {
+	if key == "" {
+		return
+	}
+	if report, ok := result.(*ConnectivityReport); ok {
+		copied := *report
+		result = &copied
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ttl == 0 {
+		return
+	}
+	// Drop expired entries so configs that are never pinged again don't pile up
+	for k, entry := range c.entries {
+		if time.Since(entry.storedAt) > c.ttl {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = latencyCacheEntry{result: result, storedAt: time.Now()}
+}
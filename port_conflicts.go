@@ -0,0 +1,196 @@
+package libunifiedcore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/metacubex/mihomo/listener"
+	"github.com/xtls/xray-core/features/inbound"
+)
+
+// portProbeTimeout bounds the SOCKS handshake used to identify who holds a
+// port.
+const portProbeTimeout = 500 * time.Millisecond
+
+// PortConflictError is returned by RunConfig when a port the config listens
+// on is already taken. OwnedByCore distinguishes a stale listener of an
+// earlier core in this process from a port held by another application.
+type PortConflictError struct {
+	Port        int
+	Purpose     string // config key or inbound tag the port belongs to
+	OwnedByCore bool
+	Detail      string
+}
+
+func (e *PortConflictError) Error() string {
+	if e.OwnedByCore {
+		return fmt.Sprintf("%s port %d is still held by a previous core in this process (stale core): %s", e.Purpose, e.Port, e.Detail)
+	}
+	return fmt.Sprintf("%s port %d is in use by another application: %s", e.Purpose, e.Port, e.Detail)
+}
+
+// listenPort is a TCP port a config is going to bind.
+type listenPort struct {
+	host    string
+	port    int
+	purpose string
+}
+
+// checkListenPorts tries to bind every TCP port the config listens on and
+// explains the first one that is taken. Ports already held by Mihomo's own
+// listeners are skipped when starting Mihomo, since applying the config
+// takes them over.
+func checkListenPorts(coreType CoreType, config map[string]interface{}) error {
+	mihomoPorts := make(map[int]bool)
+	current := listener.GetPorts()
+	for _, port := range []int{current.Port, current.SocksPort, current.MixedPort, current.RedirPort, current.TProxyPort} {
+		if port != 0 {
+			mihomoPorts[port] = true
+		}
+	}
+	var xrayPorts map[int]bool
+	if globalV2RayManager != nil {
+		xrayPorts = globalV2RayManager.ownedPorts()
+	}
+
+	for _, lp := range configListenPorts(coreType, unwrapCoreConfig(config)) {
+		if coreType == CoreTypeMihomo && mihomoPorts[lp.port] {
+			continue
+		}
+
+		l, err := net.Listen("tcp", net.JoinHostPort(lp.host, strconv.Itoa(lp.port)))
+		if err == nil {
+			l.Close()
+			continue
+		}
+
+		conflict := &PortConflictError{Port: lp.port, Purpose: lp.purpose}
+		if mihomoPorts[lp.port] {
+			conflict.OwnedByCore = true
+			conflict.Detail = "Mihomo listener left over from an earlier run"
+		} else if xrayPorts[lp.port] {
+			conflict.OwnedByCore = true
+			conflict.Detail = "Xray listener left over from an earlier run"
+		} else if probeSOCKS5(lp.port) {
+			conflict.Detail = "the port answers as a SOCKS5 proxy, likely another proxy app or a core in another process"
+		} else {
+			conflict.Detail = err.Error()
+		}
+		return conflict
+	}
+	return nil
+}
+
+// ownedPorts returns the TCP ports this manager's Xray instance listens on
+// or was last configured to listen on, including ports of an instance that
+// was stopped but may not have released them yet.
+func (v *V2RayCoreManager) ownedPorts() map[int]bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	ports := make(map[int]bool)
+	for _, port := range v.inboundPorts {
+		ports[port] = true
+	}
+	if v.socksInbound.port != 0 {
+		ports[v.socksInbound.port] = true
+	}
+	if v.instance != nil {
+		if manager, ok := v.instance.GetFeature(inbound.ManagerType()).(inbound.Manager); ok {
+			for _, handler := range manager.ListHandlers(context.Background()) {
+				for _, port := range xrayListenerPorts(handler) {
+					ports[port] = true
+				}
+			}
+		}
+	}
+	return ports
+}
+
+// xrayInboundPorts lists the TCP ports of the inbounds of an Xray config.
+func xrayInboundPorts(configBytes []byte) []int {
+	var config map[string]interface{}
+	if err := json.Unmarshal(configBytes, &config); err != nil {
+		return nil
+	}
+	var ports []int
+	for _, lp := range configListenPorts(CoreTypeXray, config) {
+		ports = append(ports, lp.port)
+	}
+	return ports
+}
+
+// configListenPorts lists the TCP ports of a Mihomo or Xray config, sorted
+// by port.
+func configListenPorts(coreType CoreType, config map[string]interface{}) []listenPort {
+	var ports []listenPort
+	switch coreType {
+	case CoreTypeMihomo:
+		host := "127.0.0.1"
+		if allowLan, _ := config["allow-lan"].(bool); allowLan {
+			host = ""
+			if bind, _ := config["bind-address"].(string); bind != "" && bind != "*" {
+				host = bind
+			}
+		}
+		for _, key := range []string{"port", "socks-port", "mixed-port", "redir-port", "tproxy-port"} {
+			if port := configPort(config[key]); port > 0 {
+				ports = append(ports, listenPort{host, port, key})
+			}
+		}
+		if controller, _ := config["external-controller"].(string); controller != "" {
+			if h, p, err := net.SplitHostPort(controller); err == nil {
+				if port, _ := strconv.Atoi(p); port > 0 {
+					ports = append(ports, listenPort{h, port, "external-controller"})
+				}
+			}
+		}
+	case CoreTypeV2Ray, CoreTypeXray:
+		for _, inbound := range configMaps(config, "inbounds") {
+			if protocol, _ := inbound["protocol"].(string); protocol == "tun" {
+				continue
+			}
+			// Port ranges and env references are left to the core
+			port, ok := inbound["port"].(float64)
+			if !ok || port <= 0 {
+				continue
+			}
+			host, _ := inbound["listen"].(string)
+			if net.ParseIP(host) == nil {
+				host = ""
+			}
+			purpose, _ := inbound["tag"].(string)
+			if purpose == "" {
+				purpose, _ = inbound["protocol"].(string)
+			}
+			ports = append(ports, listenPort{host, int(port), purpose + " inbound"})
+		}
+	}
+	sort.SliceStable(ports, func(i, j int) bool { return ports[i].port < ports[j].port })
+	return ports
+}
+
+// probeSOCKS5 reports whether something on the local port answers a SOCKS5
+// greeting.
+func probeSOCKS5(port int) bool {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), portProbeTimeout)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(portProbeTimeout))
+	if _, err := conn.Write([]byte{0x05, 0x01, 0x00}); err != nil {
+		return false
+	}
+	reply := make([]byte, 2)
+	if _, err := conn.Read(reply); err != nil {
+		return false
+	}
+	return reply[0] == 0x05
+}
@@ -0,0 +1,81 @@
+package libunifiedcore
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"strconv"
+)
+
+// minPortRangeSize is the smallest range SetPortRange accepts, so the SOCKS
+// and API ports plus the extra ports of a soft restart still fit when some
+// of them are taken.
+const minPortRangeSize = 16
+
+// SetPortRange limits the ports picked when the config does not name a
+// SOCKS or API port, and the temporary ports of SoftRestart, to min..max,
+// e.g. to stay inside a firewall allowance. Without a range the OS picks a
+// free port. Passing 0, 0 removes the range.
+func (u *UnifiedCoreManager) SetPortRange(min, max int) error {
+	if min == 0 && max == 0 {
+		u.mu.Lock()
+		u.portRangeMin, u.portRangeMax = 0, 0
+		u.mu.Unlock()
+		log.Println("Port range removed")
+		return nil
+	}
+	if min <= 0 || max > 65535 || min > max {
+		return fmt.Errorf("invalid port range: %d-%d", min, max)
+	}
+	if max-min+1 < minPortRangeSize {
+		return fmt.Errorf("port range %d-%d is too narrow, need at least %d ports", min, max, minPortRangeSize)
+	}
+
+	u.mu.Lock()
+	u.portRangeMin, u.portRangeMax = min, max
+	u.mu.Unlock()
+	log.Printf("Port range set to %d-%d", min, max)
+	return nil
+}
+
+// allocatePortLocked returns a free local TCP port within the port range,
+// or any free port when no range is set. Ports in exclude are skipped even
+// if free, since they are already promised to another listener. Callers
+// must hold u.mu.
+func (u *UnifiedCoreManager) allocatePortLocked(exclude ...int) (int, error) {
+	if u.portRangeMin == 0 {
+		for {
+			port, err := freeTCPPort()
+			if err != nil || !containsInt(exclude, port) {
+				return port, err
+			}
+		}
+	}
+
+	// Start at a random offset so concurrent allocations rarely race
+	size := u.portRangeMax - u.portRangeMin + 1
+	offset := rand.Intn(size)
+	for i := 0; i < size; i++ {
+		port := u.portRangeMin + (offset+i)%size
+		if containsInt(exclude, port) {
+			continue
+		}
+		l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+		if err != nil {
+			continue
+		}
+		l.Close()
+		return port, nil
+	}
+	return 0, fmt.Errorf("no free port in range %d-%d", u.portRangeMin, u.portRangeMax)
+}
+
+func containsInt(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
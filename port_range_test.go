@@ -0,0 +1,126 @@
+package libunifiedcore
+
+import (
+	"math/rand"
+	"net"
+	"strconv"
+	"testing"
+)
+
+// holdPortRange finds size consecutive free local ports and keeps them
+// bound, returning the first port and the listeners, in port order.
+func holdPortRange(t *testing.T, size int) (int, []net.Listener) {
+	t.Helper()
+
+	for attempt := 0; attempt < 50; attempt++ {
+		min := 20000 + rand.Intn(40000)
+		var held []net.Listener
+		for port := min; port < min+size; port++ {
+			l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+			if err != nil {
+				break
+			}
+			held = append(held, l)
+		}
+		if len(held) == size {
+			t.Cleanup(func() {
+				for _, l := range held {
+					l.Close()
+				}
+			})
+			return min, held
+		}
+		for _, l := range held {
+			l.Close()
+		}
+	}
+	t.Fatalf("no %d consecutive free ports found", size)
+	return 0, nil
+}
+
+func allocatePort(u *UnifiedCoreManager, exclude ...int) (int, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.allocatePortLocked(exclude...)
+}
+
+func TestSetPortRangeValidation(t *testing.T) {
+	tests := []struct {
+		min, max int
+		ok       bool
+	}{
+		{0, 0, true},
+		{20000, 20000 + minPortRangeSize - 1, true},
+		{20000, 20000 + minPortRangeSize - 2, false},
+		{30000, 20000, false},
+		{-1, 20000, false},
+		{60000, 70000, false},
+	}
+	for _, tt := range tests {
+		u := NewUnifiedCoreManager()
+		err := u.SetPortRange(tt.min, tt.max)
+		if (err == nil) != tt.ok {
+			t.Errorf("SetPortRange(%d, %d) error = %v, want ok %v", tt.min, tt.max, err, tt.ok)
+		}
+	}
+}
+
+func TestAllocatePortStaysInRange(t *testing.T) {
+	min, held := holdPortRange(t, minPortRangeSize)
+	max := min + minPortRangeSize - 1
+	for _, l := range held {
+		l.Close()
+	}
+
+	u := NewUnifiedCoreManager()
+	if err := u.SetPortRange(min, max); err != nil {
+		t.Fatalf("SetPortRange: %v", err)
+	}
+
+	var allocated []int
+	for i := 0; i < minPortRangeSize; i++ {
+		port, err := allocatePort(u, allocated...)
+		if err != nil {
+			t.Fatalf("allocation %d: %v", i, err)
+		}
+		if port < min || port > max {
+			t.Fatalf("allocated port %d outside %d-%d", port, min, max)
+		}
+		if containsInt(allocated, port) {
+			t.Fatalf("port %d allocated twice", port)
+		}
+		allocated = append(allocated, port)
+	}
+
+	// Every port of the range is now promised to another listener
+	if port, err := allocatePort(u, allocated...); err == nil {
+		t.Errorf("allocated port %d from an exhausted range", port)
+	}
+}
+
+func TestAllocatePortSkipsBoundPorts(t *testing.T) {
+	min, held := holdPortRange(t, minPortRangeSize)
+	max := min + minPortRangeSize - 1
+
+	u := NewUnifiedCoreManager()
+	if err := u.SetPortRange(min, max); err != nil {
+		t.Fatalf("SetPortRange: %v", err)
+	}
+
+	if port, err := allocatePort(u); err == nil {
+		t.Fatalf("allocated port %d while the whole range is bound", port)
+	}
+
+	// Free a single port; it is the only one that may be returned
+	free := min + minPortRangeSize/2
+	held[free-min].Close()
+	for i := 0; i < 5; i++ {
+		port, err := allocatePort(u)
+		if err != nil {
+			t.Fatalf("allocation with one free port: %v", err)
+		}
+		if port != free {
+			t.Fatalf("allocated port %d, want the only free port %d", port, free)
+		}
+	}
+}
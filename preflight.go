@@ -0,0 +1,272 @@
+package libunifiedcore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/xtls/xray-core/common/platform"
+)
+
+// mihomoGeoRulePattern matches rule payloads that need a geo database, including
+// ones nested inside logic rules such as AND,((GEOSITE,cn),(NETWORK,udp)).
+var mihomoGeoRulePattern = regexp.MustCompile(`(?i)(?:^|[,(])\s*(SRC-GEOIP|GEOIP|GEOSITE|SRC-IP-ASN|IP-ASN)\s*,`)
+
+// checkGeoAssets verifies that every geo database referenced by the rules
+// and DNS settings of the config is present in the asset directory, so a
+// missing file surfaces as a precise error instead of an opaque failure
+// inside the core.
+func checkGeoAssets(coreType CoreType, config map[string]interface{}, assetPath string) error {
+	config = unwrapCoreConfig(config)
+
+	var refs []geoReference
+	switch coreType {
+	case CoreTypeV2Ray, CoreTypeXray:
+		refs = xrayGeoReferences(config)
+	case CoreTypeMihomo:
+		refs = mihomoGeoReferences(config)
+	}
+
+	checked := make(map[string]bool)
+	for _, ref := range refs {
+		if checked[ref.file] {
+			continue
+		}
+		checked[ref.file] = true
+		if !geoAssetExists(coreType, assetPath, ref.file) {
+			return fmt.Errorf("missing %s required by rule %q (asset path: %s)", ref.file, ref.rule, assetPath)
+		}
+	}
+	return nil
+}
+
+// geoReference is a geo database a config needs and the entry needing it.
+type geoReference struct {
+	file string
+	rule string
+}
+
+// xrayGeoReferences lists the geo databases used by the routing rules and
+// the DNS servers and hosts of an Xray config, in config order.
+func xrayGeoReferences(config map[string]interface{}) []geoReference {
+	var refs []geoReference
+	add := func(values interface{}) {
+		for _, value := range stringList(values) {
+			if file := xrayGeoFile(value); file != "" {
+				refs = append(refs, geoReference{file, value})
+			}
+		}
+	}
+
+	routing, _ := config["routing"].(map[string]interface{})
+	for _, rule := range configMaps(routing, "rules") {
+		for _, key := range []string{"domain", "domains", "ip", "source", "sourceIP"} {
+			add(rule[key])
+		}
+	}
+	dns, _ := config["dns"].(map[string]interface{})
+	for _, server := range configMaps(dns, "servers") {
+		for _, key := range []string{"domains", "expectIPs", "expectedIPs", "unexpectedIPs"} {
+			add(server[key])
+		}
+	}
+	hosts, _ := dns["hosts"].(map[string]interface{})
+	add(sortedKeys(hosts))
+	return refs
+}
+
+// mihomoGeoReferences lists the geo databases used by the rules, sub-rules
+// and DNS settings of a Mihomo config, in config order.
+func mihomoGeoReferences(config map[string]interface{}) []geoReference {
+	geodataMode, _ := config["geodata-mode"].(bool)
+	var refs []geoReference
+	add := func(values interface{}) {
+		for _, value := range stringList(values) {
+			for _, file := range mihomoGeoFiles(value, geodataMode) {
+				refs = append(refs, geoReference{file, value})
+			}
+		}
+	}
+
+	add(config["rules"])
+	subRules, _ := config["sub-rules"].(map[string]interface{})
+	for _, name := range sortedKeys(subRules) {
+		add(subRules[name])
+	}
+
+	dns, _ := config["dns"].(map[string]interface{})
+	for _, key := range []string{"nameserver-policy", "proxy-server-nameserver-policy"} {
+		policy, _ := dns[key].(map[string]interface{})
+		add(sortedKeys(policy))
+	}
+	add(dns["fake-ip-filter"])
+	if filter, ok := dns["fallback-filter"].(map[string]interface{}); ok {
+		for _, code := range stringList(filter["geosite"]) {
+			refs = append(refs, geoReference{"GeoSite.dat", "fallback-filter geosite " + code})
+		}
+		if geoip, _ := filter["geoip"].(bool); geoip {
+			file := mihomoGeoFiles("geoip:", geodataMode)[0]
+			refs = append(refs, geoReference{file, "fallback-filter geoip"})
+		}
+	}
+	return refs
+}
+
+// sortedKeys returns the keys of a decoded JSON object, sorted.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// xrayGeoFile returns the asset file an Xray domain/ip matcher depends on.
+func xrayGeoFile(s string) string {
+	switch {
+	case strings.HasPrefix(s, "geosite:"):
+		return "geosite.dat"
+	case strings.HasPrefix(s, "geoip:"):
+		return "geoip.dat"
+	case strings.HasPrefix(s, "ext:"), strings.HasPrefix(s, "ext-domain:"), strings.HasPrefix(s, "ext-ip:"):
+		parts := strings.SplitN(s, ":", 3)
+		if len(parts) == 3 && parts[1] != "" {
+			return parts[1]
+		}
+	}
+	return ""
+}
+
+// mihomoGeoFiles returns the databases a Mihomo rule or DNS policy key depends on.
+func mihomoGeoFiles(s string, geodataMode bool) []string {
+	geoipFile := "Country.mmdb"
+	if geodataMode {
+		geoipFile = "GeoIP.dat"
+	}
+
+	lower := strings.ToLower(s)
+	if strings.HasPrefix(lower, "geosite:") {
+		return []string{"GeoSite.dat"}
+	}
+	if strings.HasPrefix(lower, "geoip:") {
+		return []string{geoipFile}
+	}
+
+	var files []string
+	for _, match := range mihomoGeoRulePattern.FindAllStringSubmatch(s, -1) {
+		switch strings.ToUpper(match[1]) {
+		case "GEOSITE":
+			files = append(files, "GeoSite.dat")
+		case "GEOIP", "SRC-GEOIP":
+			files = append(files, geoipFile)
+		case "IP-ASN", "SRC-IP-ASN":
+			files = append(files, "ASN.mmdb")
+		}
+	}
+	return files
+}
+
+func geoAssetExists(coreType CoreType, assetPath, file string) bool {
+	if coreType == CoreTypeMihomo {
+		if assetPath == "" {
+			// Mihomo falls back to the working directory as its home dir.
+			assetPath, _ = os.Getwd()
+		}
+		// Mihomo matches geo file names case-insensitively and accepts
+		// geoip.metadb in place of Country.mmdb.
+		entries, err := os.ReadDir(assetPath)
+		if err != nil {
+			return false
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if strings.EqualFold(name, file) {
+				return true
+			}
+			if strings.EqualFold(file, "Country.mmdb") && strings.EqualFold(name, "geoip.metadb") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if assetPath != "" {
+		if _, err := os.Stat(filepath.Join(assetPath, file)); err == nil {
+			return true
+		}
+	}
+	_, err := os.Stat(platform.GetAssetLocation(file))
+	return err == nil
+}
+
+// checkMihomoProviderFiles verifies that every file-type proxy or rule
+// provider points at an existing file, resolved against the Mihomo home dir
+// the way the core does. Mihomo only reports a missing provider file from the
+// core goroutine after start, with no hint which provider was at fault.
+// http providers are skipped since their path is only a download cache.
+func checkMihomoProviderFiles(config map[string]interface{}, homeDir string) error {
+	for _, section := range []string{"proxy-providers", "rule-providers"} {
+		providers, _ := config[section].(map[string]interface{})
+
+		names := make([]string, 0, len(providers))
+		for name := range providers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			provider, _ := providers[name].(map[string]interface{})
+			providerType, _ := provider["type"].(string)
+			path, _ := provider["path"].(string)
+			if !strings.EqualFold(providerType, "file") {
+				continue
+			}
+			if path == "" {
+				return fmt.Errorf("%s %q has type file but no path", section, name)
+			}
+
+			resolved := path
+			if !filepath.IsAbs(resolved) {
+				resolved = filepath.Join(homeDir, path)
+			}
+			if _, err := os.Stat(resolved); err != nil {
+				return fmt.Errorf("%s %q references missing file %s (resolved to %s): %w", section, name, path, resolved, err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkTunDevice rejects a Mihomo config that enables tun without a way to
+// get the device: mobile platforms only hand it over as a file descriptor
+// from the VPN service, and on Linux creating one needs access to
+// /dev/net/tun. Mihomo itself only logs the failure from the core goroutine.
+func checkTunDevice(coreType CoreType, config map[string]interface{}, tunFD int) error {
+	if coreType != CoreTypeMihomo {
+		return nil
+	}
+	tun, _ := config["tun"].(map[string]interface{})
+	if enabled, _ := tun["enable"].(bool); !enabled {
+		return nil
+	}
+	if fd, _ := tun["file-descriptor"].(float64); fd > 0 || tunFD > 0 {
+		return nil
+	}
+
+	switch runtime.GOOS {
+	case "android", "ios":
+		return fmt.Errorf("tun requested but no device/fd set - call SetTunFD with the VPN service's file descriptor")
+	case "linux":
+		f, err := os.OpenFile("/dev/net/tun", os.O_RDWR, 0)
+		if err != nil {
+			return fmt.Errorf("tun requested but no device/fd set and /dev/net/tun is not usable (%v) - call SetTunFD or run with CAP_NET_ADMIN", err)
+		}
+		f.Close()
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package libunifiedcore
+
+import (
+	"context"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// prewarmWorkers bounds concurrent lookups in PrewarmServers.
+const prewarmWorkers = 8
+
+// prewarmTTL is how long a prewarmed result is served from the cache.
+const prewarmTTL = 10 * time.Minute
+
+type prewarmEntry struct {
+	addrs    []string
+	resolved time.Time
+}
+
+var (
+	prewarmMu    sync.RWMutex
+	prewarmCache = make(map[string]prewarmEntry)
+)
+
+// PrewarmServers resolves server hostnames with the system resolver (outside
+// the tunnel) before RunConfig, so the first connection does not stall on
+// DNS. Lookups run concurrently, each bounded by timeout; failures are
+// logged and skipped. Results are cached, see GetPrewarmedAddrs, and handed
+// to the core on the next start as static hosts: Xray dns.hosts, Mihomo
+// hosts. Entries the config already has are left alone.
+func PrewarmServers(hosts []string, timeout time.Duration) {
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+
+	for i := 0; i < prewarmWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for host := range jobs {
+				prewarmHost(host, timeout)
+			}
+		}()
+	}
+
+	seen := make(map[string]bool)
+	for _, host := range hosts {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if host == "" || seen[host] || net.ParseIP(host) != nil {
+			continue
+		}
+		seen[host] = true
+		jobs <- host
+	}
+	close(jobs)
+	wg.Wait()
+
+	log.Printf("Prewarmed DNS for %d hosts", len(seen))
+}
+
+func prewarmHost(host string, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		log.Printf("Prewarm lookup failed for %s: %v", host, err)
+		return
+	}
+
+	prewarmMu.Lock()
+	prewarmCache[host] = prewarmEntry{addrs: addrs, resolved: time.Now()}
+	prewarmMu.Unlock()
+}
+
+// GetPrewarmedAddrs returns the cached addresses of a prewarmed host as a
+// comma-separated list, or "" if it is not cached or has expired.
+func GetPrewarmedAddrs(host string) string {
+	prewarmMu.RLock()
+	defer prewarmMu.RUnlock()
+
+	entry, exists := prewarmCache[strings.ToLower(host)]
+	if !exists || time.Since(entry.resolved) > prewarmTTL {
+		return ""
+	}
+	return strings.Join(entry.addrs, ",")
+}
+
+// prewarmedHosts returns host -> addresses for every cached host that has
+// not expired.
+func prewarmedHosts() map[string][]string {
+	prewarmMu.RLock()
+	defer prewarmMu.RUnlock()
+
+	hosts := make(map[string][]string, len(prewarmCache))
+	for host, entry := range prewarmCache {
+		if time.Since(entry.resolved) > prewarmTTL {
+			continue
+		}
+		hosts[host] = append([]string(nil), entry.addrs...)
+	}
+	return hosts
+}
+
+// setPrewarmPatches registers the patches that write the prewarmed
+// addresses into a started config. The cache is read when the config is
+// built, so hosts prewarmed after this call are still picked up.
+func (u *UnifiedCoreManager) setPrewarmPatches() {
+	u.v2rayPatches.set("prewarm", func(config map[string]interface{}) error {
+		prewarmed := prewarmedHosts()
+		if len(prewarmed) == 0 {
+			return nil
+		}
+		addPrewarmedHosts(configSection(configSection(config, "dns"), "hosts"), prewarmed)
+		return nil
+	})
+	u.mihomoPatches.set("prewarm", func(config map[string]interface{}) error {
+		prewarmed := prewarmedHosts()
+		if len(prewarmed) == 0 {
+			return nil
+		}
+		addPrewarmedHosts(configSection(config, "hosts"), prewarmed)
+		return nil
+	})
+}
+
+// addPrewarmedHosts adds the prewarmed addresses to a hosts table, as a
+// single address or a list, both accepted by Xray and Mihomo. Hosts the
+// table already maps are kept as configured.
+func addPrewarmedHosts(table map[string]interface{}, prewarmed map[string][]string) {
+	for host, addrs := range prewarmed {
+		if _, exists := table[host]; exists || len(addrs) == 0 {
+			continue
+		}
+		if len(addrs) == 1 {
+			table[host] = addrs[0]
+			continue
+		}
+		sorted := append([]string(nil), addrs...)
+		sort.Strings(sorted)
+		list := make([]interface{}, len(sorted))
+		for i, addr := range sorted {
+			list[i] = addr
+		}
+		table[host] = list
+	}
+}
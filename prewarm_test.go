@@ -0,0 +1,74 @@
+package libunifiedcore
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func setPrewarmCache(t *testing.T, entries map[string]prewarmEntry) {
+	t.Helper()
+
+	prewarmMu.Lock()
+	saved := prewarmCache
+	prewarmCache = entries
+	prewarmMu.Unlock()
+
+	t.Cleanup(func() {
+		prewarmMu.Lock()
+		prewarmCache = saved
+		prewarmMu.Unlock()
+	})
+}
+
+func TestPrewarmPatchesAddHosts(t *testing.T) {
+	setPrewarmCache(t, map[string]prewarmEntry{
+		"one.example":     {addrs: []string{"192.0.2.1"}, resolved: time.Now()},
+		"two.example":     {addrs: []string{"192.0.2.3", "192.0.2.2"}, resolved: time.Now()},
+		"kept.example":    {addrs: []string{"192.0.2.4"}, resolved: time.Now()},
+		"expired.example": {addrs: []string{"192.0.2.5"}, resolved: time.Now().Add(-2 * prewarmTTL)},
+	})
+
+	u := NewUnifiedCoreManager()
+	want := map[string]interface{}{
+		"one.example":  "192.0.2.1",
+		"two.example":  []interface{}{"192.0.2.2", "192.0.2.3"},
+		"kept.example": "198.51.100.1",
+	}
+
+	xray := map[string]interface{}{
+		"dns": map[string]interface{}{
+			"hosts": map[string]interface{}{"kept.example": "198.51.100.1"},
+		},
+	}
+	if err := u.v2rayPatches.apply(xray); err != nil {
+		t.Fatalf("apply Xray patches: %v", err)
+	}
+	hosts := xray["dns"].(map[string]interface{})["hosts"]
+	if !reflect.DeepEqual(hosts, want) {
+		t.Errorf("Xray dns.hosts = %v, want %v", hosts, want)
+	}
+
+	mihomo := map[string]interface{}{
+		"hosts": map[string]interface{}{"kept.example": "198.51.100.1"},
+	}
+	if err := u.mihomoPatches.apply(mihomo); err != nil {
+		t.Fatalf("apply Mihomo patches: %v", err)
+	}
+	if !reflect.DeepEqual(mihomo["hosts"], want) {
+		t.Errorf("Mihomo hosts = %v, want %v", mihomo["hosts"], want)
+	}
+}
+
+func TestPrewarmPatchesLeaveConfigWithoutCache(t *testing.T) {
+	setPrewarmCache(t, map[string]prewarmEntry{})
+
+	u := NewUnifiedCoreManager()
+	xray := map[string]interface{}{}
+	if err := u.v2rayPatches.apply(xray); err != nil {
+		t.Fatalf("apply Xray patches: %v", err)
+	}
+	if _, exists := xray["dns"]; exists {
+		t.Errorf("Xray config got a dns section without prewarmed hosts: %v", xray)
+	}
+}
@@ -0,0 +1,48 @@
+package libunifiedcore
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// defaultProxyClientTimeout bounds requests made with ProxyHTTPClient.
+const defaultProxyClientTimeout = 30 * time.Second
+
+// ProxyHTTPClient returns an HTTP client that sends requests through the
+// running core's SOCKS port, with a 30s timeout.
+func (u *UnifiedCoreManager) ProxyHTTPClient() (*http.Client, error) {
+	return u.ProxyHTTPClientWithTimeout(defaultProxyClientTimeout)
+}
+
+// ProxyHTTPClientWithTimeout is ProxyHTTPClient with the given timeout. The
+// timeout covers the whole request: dialing the proxy, the SOCKS handshake,
+// sending the request and reading the response body, so a stalled proxy
+// cannot hang the caller.
+func (u *UnifiedCoreManager) ProxyHTTPClientWithTimeout(timeout time.Duration) (*http.Client, error) {
+	if timeout <= 0 {
+		return nil, fmt.Errorf("invalid timeout: %v", timeout)
+	}
+	port, err := u.GetBoundSOCKSPort()
+	if err != nil {
+		return nil, err
+	}
+	return socksHTTPClient(port, timeout), nil
+}
+
+// socksHTTPClient returns an HTTP client that goes through the local SOCKS5
+// port.
+func socksHTTPClient(port int, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:               http.ProxyURL(&url.URL{Scheme: "socks5", Host: net.JoinHostPort("127.0.0.1", strconv.Itoa(port))}),
+			DialContext:         (&net.Dialer{Timeout: timeout}).DialContext,
+			TLSHandshakeTimeout: timeout,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		Timeout: timeout,
+	}
+}
@@ -0,0 +1,48 @@
+package libunifiedcore
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// coreExitCheckInterval is how often RunUntilSignal checks that the core is
+// still serving.
+const coreExitCheckInterval = time.Second
+
+// RunUntilSignal starts configPath on the global manager and blocks until
+// SIGINT or SIGTERM, then stops the core and returns, for headless and
+// server deployments. It also returns, with an error, if the core exits on
+// its own.
+func RunUntilSignal(configPath string) error {
+	manager := GetGlobalManager()
+	if err := manager.RunConfig(configPath); err != nil {
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	ticker := time.NewTicker(coreExitCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case sig := <-signals:
+			log.Printf("Received %v, stopping core", sig)
+			if err := manager.Stop(); err != nil {
+				return fmt.Errorf("failed to stop core: %w", err)
+			}
+			return nil
+		case <-ticker.C:
+			if manager.coreExited() {
+				manager.Stop()
+				return fmt.Errorf("%s core exited unexpectedly", manager.GetCoreType().DisplayName())
+			}
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package libunifiedcore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/metacubex/mihomo/adapter"
+	"github.com/metacubex/mihomo/adapter/inbound"
+	N "github.com/metacubex/mihomo/common/net"
+	C "github.com/metacubex/mihomo/constant"
+	authStore "github.com/metacubex/mihomo/listener/auth"
+	LC "github.com/metacubex/mihomo/listener/config"
+	"github.com/metacubex/mihomo/listener/mixed"
+	core "github.com/xtls/xray-core/core"
+	serial "github.com/xtls/xray-core/infra/conf/serial"
+)
+
+// selfTestTimeout bounds each core's loopback probe in SelfTest.
+const selfTestTimeout = 5 * time.Second
+
+// SelfTestReport tells which cores work in this build, independent of any
+// user config.
+type SelfTestReport struct {
+	Xray      CoreProbeResult `json:"xray"`
+	Mihomo    CoreProbeResult `json:"mihomo"`
+	AllPassed bool            `json:"allPassed"`
+}
+
+// SelfTest checks that each core can accept and forward a connection. For
+// each core a local SOCKS/mixed listener with a direct outbound is started
+// on a free loopback port and an HTTP request to a server on loopback is
+// sent through it; nothing leaves the device. Mihomo's listener is created
+// on its own, without applying a config, so a running core of either type
+// keeps running. The error is only set when the test itself cannot run.
+func SelfTest() (*SelfTestReport, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start loopback server: %w", err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})}
+	go server.Serve(l)
+	defer server.Close()
+	probeURL := "http://" + l.Addr().String() + "/"
+
+	report := &SelfTestReport{
+		Xray:   coreProbeResult(selfTestXray(probeURL)),
+		Mihomo: coreProbeResult(selfTestMihomo(probeURL)),
+	}
+	report.AllPassed = report.Xray.Success && report.Mihomo.Success
+
+	log.Printf("Self test - Xray: %+v, Mihomo: %+v", report.Xray, report.Mihomo)
+	return report, nil
+}
+
+func selfTestXray(probeURL string) (int, error) {
+	port, err := freeTCPPort()
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate port: %w", err)
+	}
+	configBytes, err := json.Marshal(map[string]interface{}{
+		"log": map[string]interface{}{"loglevel": "warning"},
+		"inbounds": []interface{}{map[string]interface{}{
+			"listen":   "127.0.0.1",
+			"port":     port,
+			"protocol": "socks",
+			"settings": map[string]interface{}{"udp": false},
+		}},
+		"outbounds": []interface{}{map[string]interface{}{"protocol": "freedom"}},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	config, err := serial.LoadJSONConfig(bytes.NewReader(configBytes))
+	if err != nil {
+		return 0, fmt.Errorf("failed to load self test config: %w", err)
+	}
+	instance, err := core.New(config)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create instance: %w", err)
+	}
+	if err := instance.Start(); err != nil {
+		instance.Close()
+		return 0, fmt.Errorf("failed to start instance: %w", err)
+	}
+	defer instance.Close()
+
+	return probeHTTP(context.Background(), socksHTTPClient(port, selfTestTimeout), probeURL)
+}
+
+func selfTestMihomo(probeURL string) (int, error) {
+	direct, err := adapter.ParseProxy(map[string]interface{}{"name": "SELF-TEST-DIRECT", "type": "direct"})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create direct outbound: %w", err)
+	}
+	defer direct.Close()
+
+	listener, err := mixed.NewWithConfig(
+		LC.AuthServer{Enable: true, Listen: "127.0.0.1:0", AuthStore: authStore.Nil},
+		selfTestTunnel{direct: direct},
+		inbound.WithInName("SELF-TEST"),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start listener: %w", err)
+	}
+	defer listener.Close()
+
+	_, portStr, err := net.SplitHostPort(listener.Address())
+	if err != nil {
+		return 0, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return 0, err
+	}
+	return probeHTTP(context.Background(), socksHTTPClient(port, selfTestTimeout), probeURL)
+}
+
+// selfTestTunnel sends every connection of the self test listener to the
+// direct outbound, in place of Mihomo's global tunnel and its rules.
+type selfTestTunnel struct {
+	direct C.Proxy
+}
+
+func (t selfTestTunnel) HandleTCPConn(conn net.Conn, metadata *C.Metadata) {
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), selfTestTimeout)
+	defer cancel()
+	remote, err := t.direct.DialContext(ctx, metadata)
+	if err != nil {
+		return
+	}
+	defer remote.Close()
+	N.Relay(conn, remote)
+}
+
+func (selfTestTunnel) HandleUDPPacket(packet C.UDPPacket, _ *C.Metadata) {
+	packet.Drop()
+}
+
+func (selfTestTunnel) NatTable() C.NatTable {
+	return nil
+}
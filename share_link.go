@@ -0,0 +1,601 @@
+package libunifiedcore
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// shareLinkSOCKSPort is the mixed-port of the configs built by
+// ParseShareLinks; the manager reads it from the config when starting it.
+const shareLinkSOCKSPort = 10808
+
+// RunShareLink writes its generated config to shareLinkConfigName in
+// shareLinkConfigDir under the temp dir, which stays writable when the asset
+// dir is read-only.
+const (
+	shareLinkConfigDir  = "unifiedcore-sharelink"
+	shareLinkConfigName = "sharelink-config.json"
+)
+
+// shareLink is the protocol-independent form of a vless://, vmess://,
+// trojan:// or ss:// link.
+type shareLink struct {
+	Protocol string // vless, vmess, trojan, shadowsocks
+	Name     string
+	Server   string
+	Port     int
+
+	UUID     string // vless, vmess
+	AlterID  int    // vmess
+	Flow     string // vless
+	Password string // trojan, shadowsocks
+	Cipher   string // shadowsocks method, vmess security
+
+	Network     string // tcp, ws, grpc, http, httpupgrade, xhttp, kcp
+	Security    string // none, tls, reality
+	SNI         string
+	Host        string
+	Path        string
+	ServiceName string
+	HeaderType  string
+	ALPN        []string
+	Fingerprint string
+	PublicKey   string
+	ShortID     string
+	SpiderX     string
+	Insecure    bool
+}
+
+// RunShareLink parses a vless://, vmess://, trojan:// or ss:// link into an
+// Xray config with a local SOCKS inbound and runs it on the global manager.
+// The inbound listens on the manager's SOCKS port, or on a newly allocated
+// one when none is set, so GetSOCKSPort reports the port in use.
+func RunShareLink(link string) error {
+	parsed, err := parseShareLink(link)
+	if err != nil {
+		return err
+	}
+
+	manager := GetGlobalManager()
+	socksPort, err := manager.generatedConfigSOCKSPort()
+	if err != nil {
+		return fmt.Errorf("failed to allocate SOCKS port: %w", err)
+	}
+
+	config := map[string]interface{}{
+		"coreType":   "xray",
+		"mixed-port": socksPort,
+		"coreConfig": map[string]interface{}{
+			"log": map[string]interface{}{"loglevel": globalLogLevel},
+			"inbounds": []interface{}{
+				map[string]interface{}{
+					"tag":      "socks",
+					"listen":   "127.0.0.1",
+					"port":     socksPort,
+					"protocol": "socks",
+					"settings": map[string]interface{}{"udp": true},
+					"sniffing": map[string]interface{}{
+						"enabled":      true,
+						"destOverride": []string{"http", "tls"},
+					},
+				},
+			},
+			"outbounds": []interface{}{
+				parsed.xrayOutbound("proxy"),
+				map[string]interface{}{"tag": "direct", "protocol": "freedom"},
+			},
+		},
+	}
+	configBytes, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal share link config: %w", err)
+	}
+
+	dir := filepath.Join(os.TempDir(), shareLinkConfigDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create share link config dir: %w", err)
+	}
+	configPath := filepath.Join(dir, shareLinkConfigName)
+	if err := writeFileAtomic(configPath, configBytes); err != nil {
+		return fmt.Errorf("failed to write share link config: %w", err)
+	}
+
+	log.Printf("Running %s share link %q via %s:%d on SOCKS port %d", parsed.Protocol, parsed.Name, parsed.Server, parsed.Port, socksPort)
+	origin := firstNonEmpty(parsed.Name, fmt.Sprintf("%s:%d", parsed.Server, parsed.Port))
+	if err := manager.SetConfigSource(configPath, ConfigSourceShareLink, origin); err != nil {
+		return err
+	}
+	return manager.RunConfig(configPath)
+}
+
+// generatedConfigSOCKSPort returns the SOCKS port a config built by this
+// package listens on: the manager's current port, or a newly allocated one.
+func (u *UnifiedCoreManager) generatedConfigSOCKSPort() (int, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.socksPort != 0 {
+		return u.socksPort, nil
+	}
+	return u.allocatePortLocked(u.apiPort)
+}
+
+// parseShareLink parses a single share link.
+func parseShareLink(link string) (*shareLink, error) {
+	link = strings.TrimSpace(link)
+	scheme, _, found := strings.Cut(link, "://")
+	if !found {
+		return nil, fmt.Errorf("invalid share link: missing scheme")
+	}
+
+	var parsed *shareLink
+	var err error
+	switch strings.ToLower(scheme) {
+	case "vless", "trojan":
+		parsed, err = parseURLShareLink(link)
+	case "vmess":
+		parsed, err = parseVMessLink(link)
+	case "ss":
+		parsed, err = parseShadowsocksLink(link)
+	default:
+		return nil, fmt.Errorf("invalid share link: unsupported scheme %q", scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s link: %w", scheme, err)
+	}
+	if parsed.Name == "" {
+		parsed.Name = net.JoinHostPort(parsed.Server, strconv.Itoa(parsed.Port))
+	}
+	return parsed, nil
+}
+
+// parseURLShareLink parses the URL-style vless:// and trojan:// links, where
+// the credential is the userinfo and the transport is in the query.
+func parseURLShareLink(link string) (*shareLink, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, err
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("missing credentials")
+	}
+
+	parsed := &shareLink{Protocol: strings.ToLower(u.Scheme), Name: u.Fragment}
+	if err := parsed.setServer(u.Hostname(), u.Port()); err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+	if parsed.Protocol == "vless" {
+		parsed.UUID = u.User.Username()
+		parsed.Flow = q.Get("flow")
+		if encryption := q.Get("encryption"); encryption != "" && encryption != "none" {
+			return nil, fmt.Errorf("unsupported encryption %q", encryption)
+		}
+	} else {
+		parsed.Password = u.User.Username()
+	}
+
+	parsed.Network = q.Get("type")
+	parsed.Security = q.Get("security")
+	if parsed.Security == "" && parsed.Protocol == "trojan" {
+		parsed.Security = "tls"
+	}
+	parsed.SNI = firstNonEmpty(q.Get("sni"), q.Get("peer"))
+	parsed.Host = q.Get("host")
+	parsed.Path = q.Get("path")
+	parsed.ServiceName = q.Get("serviceName")
+	parsed.HeaderType = q.Get("headerType")
+	parsed.Fingerprint = q.Get("fp")
+	parsed.PublicKey = q.Get("pbk")
+	parsed.ShortID = q.Get("sid")
+	parsed.SpiderX = q.Get("spx")
+	parsed.Insecure = q.Get("allowInsecure") == "1" || q.Get("insecure") == "1"
+	if alpn := q.Get("alpn"); alpn != "" {
+		parsed.ALPN = strings.Split(alpn, ",")
+	}
+	return parsed, nil
+}
+
+// parseVMessLink parses the base64 JSON form of vmess:// links.
+func parseVMessLink(link string) (*shareLink, error) {
+	payload, err := decodeBase64(strings.TrimPrefix(link[len("vmess://"):], "//"))
+	if err != nil {
+		return nil, fmt.Errorf("payload is not base64: %w", err)
+	}
+
+	var v map[string]interface{}
+	if err := json.Unmarshal(payload, &v); err != nil {
+		return nil, fmt.Errorf("payload is not JSON: %w", err)
+	}
+	str := func(key string) string {
+		switch value := v[key].(type) {
+		case string:
+			return value
+		case float64:
+			return strconv.Itoa(int(value))
+		}
+		return ""
+	}
+
+	parsed := &shareLink{
+		Protocol:    "vmess",
+		Name:        str("ps"),
+		UUID:        str("id"),
+		Cipher:      firstNonEmpty(str("scy"), "auto"),
+		Network:     str("net"),
+		HeaderType:  str("type"),
+		Host:        str("host"),
+		Path:        str("path"),
+		SNI:         str("sni"),
+		Fingerprint: str("fp"),
+	}
+	if parsed.UUID == "" {
+		return nil, fmt.Errorf("missing id")
+	}
+	if err := parsed.setServer(str("add"), str("port")); err != nil {
+		return nil, err
+	}
+	if aid := str("aid"); aid != "" {
+		if parsed.AlterID, err = strconv.Atoi(aid); err != nil {
+			return nil, fmt.Errorf("invalid aid %q", aid)
+		}
+	}
+	if tls := str("tls"); tls != "" && tls != "none" {
+		parsed.Security = tls
+	}
+	if alpn := str("alpn"); alpn != "" {
+		parsed.ALPN = strings.Split(alpn, ",")
+	}
+	if parsed.Network == "grpc" {
+		parsed.ServiceName = parsed.Path
+	}
+	return parsed, nil
+}
+
+// parseShadowsocksLink parses SIP002 links (ss://base64(method:password)@host:port
+// or with a plain method:password) and the legacy fully base64-encoded form.
+func parseShadowsocksLink(link string) (*shareLink, error) {
+	body := link[len("ss://"):]
+	var name string
+	if i := strings.Index(body, "#"); i >= 0 {
+		name, _ = url.PathUnescape(body[i+1:])
+		body = body[:i]
+	}
+	if i := strings.Index(body, "?"); i >= 0 {
+		if plugin := body[i+1:]; strings.Contains(plugin, "plugin=") {
+			return nil, fmt.Errorf("plugins are not supported")
+		}
+		body = body[:i]
+	}
+	body = strings.TrimSuffix(body, "/")
+
+	if !strings.Contains(body, "@") {
+		decoded, err := decodeBase64(body)
+		if err != nil {
+			return nil, fmt.Errorf("payload is not base64: %w", err)
+		}
+		body = string(decoded)
+	}
+
+	at := strings.LastIndex(body, "@")
+	if at < 0 {
+		return nil, fmt.Errorf("missing server")
+	}
+	userInfo, hostPort := body[:at], body[at+1:]
+	if decoded, err := decodeBase64(userInfo); err == nil && strings.Contains(string(decoded), ":") {
+		userInfo = string(decoded)
+	} else if unescaped, err := url.PathUnescape(userInfo); err == nil {
+		userInfo = unescaped
+	}
+	method, password, found := strings.Cut(userInfo, ":")
+	if !found || method == "" || password == "" {
+		return nil, fmt.Errorf("missing method or password")
+	}
+
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server %q", hostPort)
+	}
+
+	parsed := &shareLink{Protocol: "shadowsocks", Name: name, Cipher: method, Password: password}
+	if err := parsed.setServer(host, port); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+func (l *shareLink) setServer(host, port string) error {
+	if host == "" {
+		return fmt.Errorf("missing server address")
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p <= 0 || p > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	l.Server = host
+	l.Port = p
+	return nil
+}
+
+// xrayOutbound converts the link into an Xray outbound with the given tag.
+func (l *shareLink) xrayOutbound(tag string) map[string]interface{} {
+	var settings map[string]interface{}
+	switch l.Protocol {
+	case "vless":
+		user := map[string]interface{}{"id": l.UUID, "encryption": "none"}
+		if l.Flow != "" {
+			user["flow"] = l.Flow
+		}
+		settings = map[string]interface{}{"vnext": []interface{}{
+			map[string]interface{}{"address": l.Server, "port": l.Port, "users": []interface{}{user}},
+		}}
+	case "vmess":
+		user := map[string]interface{}{"id": l.UUID, "alterId": l.AlterID, "security": l.Cipher}
+		settings = map[string]interface{}{"vnext": []interface{}{
+			map[string]interface{}{"address": l.Server, "port": l.Port, "users": []interface{}{user}},
+		}}
+	case "trojan":
+		settings = map[string]interface{}{"servers": []interface{}{
+			map[string]interface{}{"address": l.Server, "port": l.Port, "password": l.Password},
+		}}
+	case "shadowsocks":
+		settings = map[string]interface{}{"servers": []interface{}{
+			map[string]interface{}{"address": l.Server, "port": l.Port, "method": l.Cipher, "password": l.Password},
+		}}
+	}
+
+	return map[string]interface{}{
+		"tag":            tag,
+		"protocol":       l.Protocol,
+		"settings":       settings,
+		"streamSettings": l.xrayStreamSettings(),
+	}
+}
+
+func (l *shareLink) xrayStreamSettings() map[string]interface{} {
+	network := firstNonEmpty(l.Network, "tcp")
+	if network == "h2" {
+		network = "http"
+	}
+	stream := map[string]interface{}{"network": network}
+
+	switch network {
+	case "ws":
+		ws := map[string]interface{}{"path": firstNonEmpty(l.Path, "/")}
+		if l.Host != "" {
+			ws["headers"] = map[string]interface{}{"Host": l.Host}
+		}
+		stream["wsSettings"] = ws
+	case "grpc":
+		stream["grpcSettings"] = map[string]interface{}{"serviceName": l.ServiceName}
+	case "http":
+		h2 := map[string]interface{}{"path": firstNonEmpty(l.Path, "/")}
+		if l.Host != "" {
+			h2["host"] = strings.Split(l.Host, ",")
+		}
+		stream["httpSettings"] = h2
+	case "httpupgrade", "xhttp":
+		stream[network+"Settings"] = map[string]interface{}{"path": firstNonEmpty(l.Path, "/"), "host": l.Host}
+	case "tcp":
+		if l.HeaderType == "http" {
+			request := map[string]interface{}{"path": []string{firstNonEmpty(l.Path, "/")}}
+			if l.Host != "" {
+				request["headers"] = map[string]interface{}{"Host": strings.Split(l.Host, ",")}
+			}
+			stream["tcpSettings"] = map[string]interface{}{
+				"header": map[string]interface{}{"type": "http", "request": request},
+			}
+		}
+	}
+
+	switch l.Security {
+	case "tls":
+		tls := map[string]interface{}{"serverName": firstNonEmpty(l.SNI, l.Host), "allowInsecure": l.Insecure}
+		if len(l.ALPN) > 0 {
+			tls["alpn"] = l.ALPN
+		}
+		if l.Fingerprint != "" {
+			tls["fingerprint"] = l.Fingerprint
+		}
+		stream["security"] = "tls"
+		stream["tlsSettings"] = tls
+	case "reality":
+		stream["security"] = "reality"
+		stream["realitySettings"] = map[string]interface{}{
+			"serverName":  l.SNI,
+			"fingerprint": firstNonEmpty(l.Fingerprint, "chrome"),
+			"publicKey":   l.PublicKey,
+			"shortId":     l.ShortID,
+			"spiderX":     l.SpiderX,
+		}
+	}
+	return stream
+}
+
+// decodeBase64 accepts standard and URL-safe base64, padded or not.
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	for _, encoding := range []*base64.Encoding{
+		base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding,
+	} {
+		if decoded, err := encoding.DecodeString(s); err == nil {
+			return decoded, nil
+		}
+	}
+	return nil, fmt.Errorf("illegal base64 data")
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// ParseShareLinks converts share links into one Mihomo config (JSON, with the
+// injected coreType) containing every proxy and a select group routing all
+// traffic. Malformed or unsupported links are skipped and logged; an error is
+// returned only when no link could be converted.
+func ParseShareLinks(links []string) ([]byte, error) {
+	var proxies []interface{}
+	var names []string
+	var skipped []string
+	used := make(map[string]bool)
+
+	for i, link := range links {
+		if strings.TrimSpace(link) == "" {
+			continue
+		}
+		parsed, err := parseShareLink(link)
+		if err == nil {
+			var proxy map[string]interface{}
+			if proxy, err = parsed.mihomoProxy(); err == nil {
+				name := parsed.Name
+				for n := 2; used[name]; n++ {
+					name = fmt.Sprintf("%s %d", parsed.Name, n)
+				}
+				used[name] = true
+				proxy["name"] = name
+				proxies = append(proxies, proxy)
+				names = append(names, name)
+				continue
+			}
+		}
+		log.Printf("Skipping share link %d: %v", i+1, err)
+		skipped = append(skipped, fmt.Sprintf("link %d: %v", i+1, err))
+	}
+
+	if len(proxies) == 0 {
+		if len(skipped) == 0 {
+			return nil, fmt.Errorf("no share links given")
+		}
+		return nil, fmt.Errorf("no valid share links: %s", strings.Join(skipped, "; "))
+	}
+
+	config := map[string]interface{}{
+		"coreType":   "mihomo",
+		"mixed-port": shareLinkSOCKSPort,
+		"mode":       "rule",
+		"log-level":  globalLogLevel,
+		"proxies":    proxies,
+		"proxy-groups": []interface{}{
+			map[string]interface{}{"name": "PROXY", "type": "select", "proxies": names},
+		},
+		"rules": []string{"MATCH,PROXY"},
+	}
+	configBytes, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal share link config: %w", err)
+	}
+
+	log.Printf("Parsed %d share links into Mihomo config, skipped %d", len(proxies), len(skipped))
+	return configBytes, nil
+}
+
+// mihomoProxy converts the link into a Mihomo proxy entry, without a name.
+func (l *shareLink) mihomoProxy() (map[string]interface{}, error) {
+	proxy := map[string]interface{}{
+		"server": l.Server,
+		"port":   l.Port,
+		"udp":    true,
+	}
+	switch l.Protocol {
+	case "vless":
+		proxy["type"] = "vless"
+		proxy["uuid"] = l.UUID
+		if l.Flow != "" {
+			proxy["flow"] = l.Flow
+		}
+	case "vmess":
+		proxy["type"] = "vmess"
+		proxy["uuid"] = l.UUID
+		proxy["alterId"] = l.AlterID
+		proxy["cipher"] = l.Cipher
+	case "trojan":
+		proxy["type"] = "trojan"
+		proxy["password"] = l.Password
+	case "shadowsocks":
+		proxy["type"] = "ss"
+		proxy["cipher"] = l.Cipher
+		proxy["password"] = l.Password
+		return proxy, nil
+	}
+
+	network := firstNonEmpty(l.Network, "tcp")
+	switch network {
+	case "tcp":
+		if l.HeaderType == "http" {
+			proxy["network"] = "http"
+			opts := map[string]interface{}{"path": []string{firstNonEmpty(l.Path, "/")}}
+			if l.Host != "" {
+				opts["headers"] = map[string]interface{}{"Host": strings.Split(l.Host, ",")}
+			}
+			proxy["http-opts"] = opts
+		}
+	case "ws", "httpupgrade":
+		proxy["network"] = "ws"
+		opts := map[string]interface{}{"path": firstNonEmpty(l.Path, "/")}
+		if l.Host != "" {
+			opts["headers"] = map[string]interface{}{"Host": l.Host}
+		}
+		if network == "httpupgrade" {
+			opts["v2ray-http-upgrade"] = true
+		}
+		proxy["ws-opts"] = opts
+	case "grpc":
+		proxy["network"] = "grpc"
+		proxy["grpc-opts"] = map[string]interface{}{"grpc-service-name": l.ServiceName}
+	case "http", "h2":
+		if l.Protocol == "trojan" {
+			return nil, fmt.Errorf("network %s is not supported for trojan", network)
+		}
+		proxy["network"] = "h2"
+		opts := map[string]interface{}{"path": firstNonEmpty(l.Path, "/")}
+		if l.Host != "" {
+			opts["host"] = strings.Split(l.Host, ",")
+		}
+		proxy["h2-opts"] = opts
+	default:
+		return nil, fmt.Errorf("network %s is not supported by Mihomo", network)
+	}
+
+	if l.Security == "tls" || l.Security == "reality" {
+		serverName := firstNonEmpty(l.SNI, l.Host)
+		if l.Protocol == "trojan" {
+			if serverName != "" {
+				proxy["sni"] = serverName
+			}
+		} else {
+			proxy["tls"] = true
+			if serverName != "" {
+				proxy["servername"] = serverName
+			}
+		}
+		if l.Fingerprint != "" {
+			proxy["client-fingerprint"] = l.Fingerprint
+		}
+		if len(l.ALPN) > 0 {
+			proxy["alpn"] = l.ALPN
+		}
+		if l.Insecure {
+			proxy["skip-cert-verify"] = true
+		}
+	}
+	if l.Security == "reality" {
+		proxy["reality-opts"] = map[string]interface{}{"public-key": l.PublicKey, "short-id": l.ShortID}
+		if l.Fingerprint == "" {
+			proxy["client-fingerprint"] = "chrome"
+		}
+	}
+	return proxy, nil
+}
@@ -0,0 +1,456 @@
+package libunifiedcore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/xtls/xray-core/features/inbound"
+)
+
+const (
+	// softRestartTimeout bounds startup and the health probe of the new core.
+	softRestartTimeout = 5 * time.Second
+
+	// softRestartDrain is how long the old Xray core keeps serving the
+	// connections it already has before it is stopped. Xray does not track
+	// connections, so this is a fixed grace period.
+	softRestartDrain = 15 * time.Second
+)
+
+// SoftRestart switches to configPath without a connectivity gap.
+//
+// Xray: the new config is started as a second instance with its inbounds
+// moved to free ports and probed through its default outbound, outside the
+// manager lock so status calls keep answering. The SOCKS port is then held by
+// a forwarder that passes every new connection to the active instance, and
+// the swap only changes where it forwards, so clients keep using the same
+// port and never see a refused connection. GetAPIPort and the other inbounds
+// report the new instance's ports. The old instance keeps its connections for
+// softRestartDrain and is then stopped. If the new core fails its check it
+// is stopped and the old one stays active.
+//
+// Mihomo is a single in-process core, so a second instance is not possible;
+// SoftRestart goes through ApplyConfig, which hot-reloads without dropping
+// connections when the ports and tun settings are unchanged. A different
+// core type, a tun inbound (the device cannot be shared by two instances), a
+// changed SOCKS port, or no running core, falls back to RunConfig.
+func (u *UnifiedCoreManager) SoftRestart(configPath string) error {
+	absPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve config path: %w", err)
+	}
+	retries, delay := u.configReadPolicy()
+	configBytes, err := readConfigFile(absPath, retries, delay)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(configBytes, &config); err != nil {
+		return fmt.Errorf("failed to parse injected config as JSON: %w", err)
+	}
+	coreTypeStr, _ := config["coreType"].(string)
+	newCoreType, err := ParseCoreType(coreTypeStr)
+	if err != nil {
+		return fmt.Errorf("invalid coreType in injected config: %s - %w", coreTypeStr, err)
+	}
+
+	u.mu.RLock()
+	running, coreType, socksPort := u.running, u.coreType, u.socksPort
+	lastConfig := u.lastConfig
+	u.mu.RUnlock()
+
+	switch {
+	case !running || newCoreType != coreType:
+		log.Printf("Soft restart not possible, starting %s normally", newCoreType.DisplayName())
+		return u.RunConfig(absPath)
+	case coreType == CoreTypeMihomo:
+		return u.ApplyConfig(absPath)
+	case xrayHasTunInbound(unwrapCoreConfig(config)) || xrayHasTunInbound(unwrapCoreConfig(lastConfig)):
+		log.Println("Soft restart not possible with a tun inbound, restarting normally")
+		return u.RunConfig(absPath)
+	}
+	coreConfigBytes, err := json.Marshal(unwrapCoreConfig(config))
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	if socks := xraySOCKSInbound(coreConfigBytes); !socks.found || socks.port != socksPort {
+		log.Println("Soft restart not possible, the SOCKS port changes; restarting normally")
+		return u.RunConfig(absPath)
+	}
+
+	return u.applies.submit(func() error {
+		return u.softRestartXray(absPath, configBytes, config)
+	})
+}
+
+// softRestartXray starts configPath as a second Xray instance and makes it
+// the active core once it is healthy.
+func (u *UnifiedCoreManager) softRestartXray(absPath string, configBytes []byte, config map[string]interface{}) error {
+	u.mu.Lock()
+	old := u.v2rayManager
+	if !u.running || old == nil {
+		u.mu.Unlock()
+		return fmt.Errorf("V2Ray core is not running")
+	}
+	next, ports, dir, err := u.prepareSoftRestartLocked(config)
+	if err != nil {
+		u.mu.Unlock()
+		return err
+	}
+	probeURL := u.connectivityProbeURLLocked()
+	u.mu.Unlock()
+
+	discard := func() {
+		next.Stop()
+		if dir != "" {
+			globalTempDirs.Remove(dir)
+		}
+	}
+
+	if err := next.RunConfig(absPath); err != nil {
+		discard()
+		return fmt.Errorf("failed to start new core: %w", err)
+	}
+	if err := next.waitHealthy(probeURL, softRestartTimeout); err != nil {
+		discard()
+		return fmt.Errorf("new core failed health check, keeping the current one: %w", err)
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if !u.running || u.v2rayManager != old {
+		discard()
+		return fmt.Errorf("core was restarted during soft restart, discarding the new core")
+	}
+
+	u.flushTrafficStatsLocked()
+	u.releaseKillSwitchLocked()
+	u.switchSOCKSFrontLocked(old, config, ports.remap(u.socksPort))
+	u.v2rayManager = next
+	globalV2RayManager = next
+	apiPort := u.configuredAPIPortLocked()
+	u.apiPort = ports.remap(apiPort)
+	u.softRestartAPIPort = 0
+	if u.apiPort != apiPort {
+		u.softRestartAPIPort = apiPort
+	}
+	u.configPath = absPath
+	if dir != "" {
+		u.ephemeralDir = dir
+		u.adoptEphemeralDirLocked(dir)
+	}
+	u.recordAppliedConfigLocked(configBytes, config)
+	u.markTrafficBaselineLocked()
+	u.markStatsCountedLocked()
+	u.startTrafficAlertLocked()
+	u.startKillSwitchLocked()
+	u.startStatsRecorderLocked()
+	u.startTrafficHistoryLocked()
+	log.Printf("Soft restart switched to new core, SOCKS port %d, API port %d", u.socksPort, u.apiPort)
+
+	go func() {
+		time.Sleep(softRestartDrain)
+		if err := old.Stop(); err != nil {
+			log.Printf("Failed to stop drained core: %v", err)
+			return
+		}
+		log.Println("Drained core stopped after soft restart")
+	}()
+	return nil
+}
+
+// portMap maps the ports of a config to the ports of its soft restart
+// instance.
+type portMap map[int]int
+
+func (p portMap) remap(port int) int {
+	if mapped, ok := p[port]; ok {
+		return mapped
+	}
+	return port
+}
+
+// prepareSoftRestartLocked runs the start preflight for config and builds
+// the second instance with every inbound moved to a free port. The returned
+// dir is the instance's ephemeral state dir, if any; it is not made the
+// manager's until the swap. Callers must hold u.mu.
+func (u *UnifiedCoreManager) prepareSoftRestartLocked(config map[string]interface{}) (*V2RayCoreManager, portMap, string, error) {
+	coreConfig := unwrapCoreConfig(config)
+	if err := checkGeoAssets(u.coreType, config, u.assetPath); err != nil {
+		return nil, nil, "", fmt.Errorf("asset preflight failed: %w", err)
+	}
+	if err := u.checkAllowedProtocolsLocked(u.coreType, config); err != nil {
+		return nil, nil, "", err
+	}
+	if err := checkTunDevice(u.coreType, coreConfig, u.tunFD); err != nil {
+		return nil, nil, "", fmt.Errorf("tun preflight failed: %w", err)
+	}
+
+	// Move every inbound to a free port so both instances can run at once
+	ports := make(portMap)
+	var allocated []int
+	for _, lp := range configListenPorts(u.coreType, coreConfig) {
+		if _, done := ports[lp.port]; done {
+			continue
+		}
+		port, err := u.allocatePortLocked(allocated...)
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("failed to allocate port for %s: %w", lp.purpose, err)
+		}
+		ports[lp.port] = port
+		allocated = append(allocated, port)
+	}
+
+	// The running core keeps its state dir until it is drained
+	runningDir := u.ephemeralDir
+	dir, err := u.prepareEphemeralLocked()
+	u.ephemeralDir = runningDir
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	next := NewV2RayCoreManager(ports.remap(u.socksPort), ports.remap(u.configuredAPIPortLocked()))
+	if u.scopedHomeDir {
+		next.SetHomeDirForManager(u.assetPath)
+	} else {
+		next.SetAssetPath(u.assetPath)
+	}
+	next.SetLogLevel(u.logLevel)
+	next.setSharedPatches(u.v2rayPatches.clone())
+	old := u.v2rayManager
+	old.mu.RLock()
+	next.patches = old.patches.clone()
+	old.mu.RUnlock()
+	next.patches.set(softRestartPortsPatch, func(config map[string]interface{}) error {
+		for _, inbound := range configMaps(config, "inbounds") {
+			if port, ok := inbound["port"].(float64); ok {
+				inbound["port"] = ports.remap(int(port))
+			}
+		}
+		return nil
+	})
+	return next, ports, dir, nil
+}
+
+// softRestartPortsPatch names the patch that moves the inbounds of a soft
+// restart instance to their free ports.
+const softRestartPortsPatch = "soft-restart-ports"
+
+// configuredAPIPortLocked returns the API port of the config, before any
+// soft restart moved it. Callers must hold u.mu.
+func (u *UnifiedCoreManager) configuredAPIPortLocked() int {
+	if u.softRestartAPIPort != 0 {
+		return u.softRestartAPIPort
+	}
+	return u.apiPort
+}
+
+// clearSoftRestartLocked undoes the port moves of earlier soft restarts, so
+// that a normal start binds the ports of its config. The soft restart
+// instance stays the global V2Ray manager and would otherwise keep moving its
+// inbounds. Callers must hold u.mu.
+func (u *UnifiedCoreManager) clearSoftRestartLocked() {
+	if u.softRestartAPIPort != 0 {
+		u.apiPort = u.softRestartAPIPort
+		u.softRestartAPIPort = 0
+	}
+	if globalV2RayManager != nil {
+		globalV2RayManager.mu.Lock()
+		globalV2RayManager.patches.set(softRestartPortsPatch, nil)
+		globalV2RayManager.mu.Unlock()
+	}
+}
+
+// switchSOCKSFrontLocked points the SOCKS port at backend. On the first soft
+// restart the port still belongs to the old instance's inbound, which is
+// closed so the forwarder can take the port over; connections it already
+// accepted keep running. Callers must hold u.mu.
+func (u *UnifiedCoreManager) switchSOCKSFrontLocked(old *V2RayCoreManager, config map[string]interface{}, backend int) {
+	if u.socksFront != nil {
+		u.socksFront.setBackend(backend)
+		return
+	}
+
+	host := ""
+	for _, lp := range configListenPorts(u.coreType, unwrapCoreConfig(config)) {
+		if lp.port == u.socksPort {
+			host = lp.host
+			break
+		}
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(u.socksPort))
+
+	if err := old.closeSOCKSInbound(); err != nil {
+		log.Printf("Could not close the SOCKS inbound of the old core: %v", err)
+	}
+	front, err := startSOCKSFront(addr, backend)
+	if err != nil {
+		// Clients have to follow the new core's port instead
+		log.Printf("Could not hold SOCKS port %s across the restart, moving to port %d: %v", addr, backend, err)
+		u.socksPort = backend
+		return
+	}
+	u.socksFront = front
+}
+
+// closeSOCKSFrontLocked stops forwarding the SOCKS port, so the next core can
+// bind it itself. Callers must hold u.mu.
+func (u *UnifiedCoreManager) closeSOCKSFrontLocked() {
+	if u.socksFront == nil {
+		return
+	}
+	u.socksFront.close()
+	u.socksFront = nil
+}
+
+// closeSOCKSInbound removes the SOCKS inbound of the running instance, which
+// closes its listener.
+func (v *V2RayCoreManager) closeSOCKSInbound() error {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if v.instance == nil || !v.socksInbound.found {
+		return fmt.Errorf("no SOCKS inbound")
+	}
+	if v.socksInbound.tag != "" {
+		manager, ok := v.instance.GetFeature(inbound.ManagerType()).(inbound.Manager)
+		if !ok {
+			return fmt.Errorf("no inbound manager")
+		}
+		return manager.RemoveHandler(context.Background(), v.socksInbound.tag)
+	}
+	handler := findXrayInbound(v.instance, v.socksInbound)
+	if handler == nil {
+		return fmt.Errorf("SOCKS inbound not found")
+	}
+	return handler.Close()
+}
+
+// xrayHasTunInbound reports whether an Xray config has a tun inbound.
+func xrayHasTunInbound(config map[string]interface{}) bool {
+	for _, inbound := range configMaps(config, "inbounds") {
+		if protocol, _ := inbound["protocol"].(string); protocol == "tun" {
+			return true
+		}
+	}
+	return false
+}
+
+// socksFront holds the SOCKS port across soft restarts and forwards each
+// connection to the local port of the active core. A backend of 0 rejects
+// connections.
+type socksFront struct {
+	listener net.Listener
+	backend  atomic.Int32
+}
+
+// socksFrontBindAttempts is how often the forwarder retries binding a port
+// the old core has just released.
+const socksFrontBindAttempts = 10
+
+func startSOCKSFront(addr string, backend int) (*socksFront, error) {
+	var l net.Listener
+	var err error
+	for i := 0; i < socksFrontBindAttempts; i++ {
+		if l, err = net.Listen("tcp", addr); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f := &socksFront{listener: l}
+	f.setBackend(backend)
+	go f.serve()
+	log.Printf("SOCKS port %s now forwards to port %d", addr, backend)
+	return f, nil
+}
+
+func (f *socksFront) setBackend(port int) {
+	f.backend.Store(int32(port))
+}
+
+func (f *socksFront) port() int {
+	return f.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (f *socksFront) close() {
+	f.listener.Close()
+}
+
+func (f *socksFront) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.forward(conn)
+	}
+}
+
+// forward pipes conn to the backend it was accepted for. A later swap does
+// not move it; it ends when the old core closes it after draining.
+func (f *socksFront) forward(conn net.Conn) {
+	defer conn.Close()
+
+	port := f.backend.Load()
+	if port == 0 {
+		return
+	}
+	backend, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port))), softRestartTimeout)
+	if err != nil {
+		return
+	}
+	defer backend.Close()
+
+	go func() {
+		io.Copy(backend, conn)
+		if tcp, ok := backend.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		}
+	}()
+	io.Copy(conn, backend)
+}
+
+// waitHealthy waits for the instance to start and probes its default
+// outbound.
+func (v *V2RayCoreManager) waitHealthy(probeURL string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for !v.startupTimings().Done {
+		if v.exited() {
+			return fmt.Errorf("core exited during startup")
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("core did not start within %v", timeout)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return fmt.Errorf("core did not start within %v", timeout)
+	}
+	_, _, err := probeXrayDefault(v, probeURL, remaining)
+	return err
+}
+
+// freeTCPPort asks the OS for an unused local TCP port.
+func freeTCPPort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,67 @@
+package libunifiedcore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRestartAfterSoftRestartUsesConfigPorts(t *testing.T) {
+	probe := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(probe.Close)
+
+	port := freePort(t)
+	path := writeXrayConfig(t, t.TempDir(), "config.json", port)
+
+	u := NewUnifiedCoreManager()
+	if err := u.SetProbeURLs(probe.URL, ""); err != nil {
+		t.Fatalf("SetProbeURLs: %v", err)
+	}
+	if err := u.RunConfig(path); err != nil {
+		t.Fatalf("RunConfig: %v", err)
+	}
+	t.Cleanup(func() { u.Stop() })
+
+	if err := u.SoftRestart(path); err != nil {
+		t.Fatalf("SoftRestart: %v", err)
+	}
+	u.mu.RLock()
+	front := u.socksFront
+	u.mu.RUnlock()
+	if front == nil {
+		t.Fatal("SoftRestart did not hold the SOCKS port with a forwarder")
+	}
+
+	if err := u.Restart(); err != nil {
+		t.Fatalf("Restart: %v", err)
+	}
+	u.mu.RLock()
+	front, manager := u.socksFront, u.v2rayManager
+	u.mu.RUnlock()
+	if front != nil {
+		t.Error("forwarder still running after Restart")
+	}
+	manager.mu.RLock()
+	_, leftover := manager.patches.patches[softRestartPortsPatch]
+	manager.mu.RUnlock()
+	if leftover {
+		t.Error("soft restart port patch left on the manager after Restart")
+	}
+
+	if got := u.GetSOCKSPort(); got != port {
+		t.Errorf("GetSOCKSPort = %d, want %d", got, port)
+	}
+	bound, err := u.GetBoundSOCKSPort()
+	if err != nil {
+		t.Fatalf("GetBoundSOCKSPort: %v", err)
+	}
+	if bound != port {
+		t.Errorf("core bound SOCKS port %d, want the configured %d", bound, port)
+	}
+	if err := probeSOCKS(port, true, time.Second); err != nil {
+		t.Errorf("SOCKS handshake on port %d after Restart: %v", port, err)
+	}
+}
@@ -0,0 +1,193 @@
+package libunifiedcore
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/metacubex/mihomo/listener"
+	"github.com/metacubex/mihomo/tunnel"
+)
+
+// portReadyTimeout bounds how long RunConfigWithDiagnostics waits for the
+// SOCKS/mixed port to accept connections.
+const portReadyTimeout = 10 * time.Second
+
+// startupTimings records how long the core-side startup phases took. Cores
+// start asynchronously, so Done reports whether apply has finished.
+type startupTimings struct {
+	Convert time.Duration
+	Apply   time.Duration
+	Done    bool
+}
+
+// StartupDiagnostics is the timing breakdown and resolved listeners of a
+// RunConfigWithDiagnostics call. Durations are in milliseconds so the struct
+// marshals the same on both sides of the gomobile boundary.
+type StartupDiagnostics struct {
+	CoreType   string `json:"coreType"`
+	ConfigPath string `json:"configPath"`
+
+	ReadMs      int64 `json:"readMs"`      // reading the config file
+	ParseMs     int64 `json:"parseMs"`     // decoding JSON, detecting core type, preflight
+	ConvertMs   int64 `json:"convertMs"`   // core-specific config conversion
+	ApplyMs     int64 `json:"applyMs"`     // creating/applying the core instance
+	PortReadyMs int64 `json:"portReadyMs"` // start call until the SOCKS port accepts connections
+	TotalMs     int64 `json:"totalMs"`
+
+	SOCKSPort int      `json:"socksPort"`
+	APIPort   int      `json:"apiPort"`
+	Listeners []string `json:"listeners"`
+	PortReady bool     `json:"portReady"`
+
+	// PortFallbacks explains each port RunConfig allocated because the
+	// config did not specify it.
+	PortFallbacks []string `json:"portFallbacks,omitempty"`
+
+	startCallAt time.Time
+}
+
+// RunConfigWithDiagnostics behaves like RunConfig and additionally reports
+// how long each startup phase took and which listeners the core opened.
+// Diagnostics are returned even when startup fails, up to the failing phase.
+func (u *UnifiedCoreManager) RunConfigWithDiagnostics(configPath string) (*StartupDiagnostics, error) {
+	diag := &StartupDiagnostics{ConfigPath: configPath}
+	start := time.Now()
+
+	u.clearWarmStart()
+
+	if err := u.runConfig(configPath, diag); err != nil {
+		diag.TotalMs = time.Since(start).Milliseconds()
+		return diag, err
+	}
+
+	u.mu.RLock()
+	coreType := u.coreType
+	diag.CoreType = coreType.String()
+	diag.SOCKSPort = u.socksPort
+	diag.APIPort = u.apiPort
+	u.mu.RUnlock()
+
+	diag.PortReady = waitForPort(diag.SOCKSPort, portReadyTimeout)
+	diag.PortReadyMs = time.Since(diag.startCallAt).Milliseconds()
+	if !diag.PortReady {
+		log.Printf("Warning: SOCKS port %d not accepting connections after %v", diag.SOCKSPort, portReadyTimeout)
+	}
+
+	// Listeners can come up before the core finishes applying (Mihomo loads
+	// providers afterwards), so give apply a moment to complete.
+	timings := u.waitStartupDone(2 * time.Second)
+
+	u.mu.RLock()
+	switch coreType {
+	case CoreTypeV2Ray, CoreTypeXray:
+		diag.Listeners = xrayListeners(u.v2rayManager)
+	case CoreTypeMihomo:
+		diag.Listeners = mihomoListeners()
+	}
+	u.mu.RUnlock()
+
+	diag.ConvertMs = timings.Convert.Milliseconds()
+	diag.ApplyMs = timings.Apply.Milliseconds()
+	diag.TotalMs = time.Since(start).Milliseconds()
+
+	log.Printf("Startup diagnostics: read=%dms parse=%dms convert=%dms apply=%dms port-ready=%dms total=%dms",
+		diag.ReadMs, diag.ParseMs, diag.ConvertMs, diag.ApplyMs, diag.PortReadyMs, diag.TotalMs)
+	return diag, nil
+}
+
+// notePortFallback logs why a port was allocated instead of taken from the
+// config, and records the reason into diag when non-nil.
+func (u *UnifiedCoreManager) notePortFallback(diag *StartupDiagnostics, reason string) {
+	log.Printf("Warning: %s", reason)
+	if diag != nil {
+		diag.PortFallbacks = append(diag.PortFallbacks, reason)
+	}
+}
+
+func (u *UnifiedCoreManager) coreStartupTimings() startupTimings {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	switch u.coreType {
+	case CoreTypeV2Ray, CoreTypeXray:
+		if u.v2rayManager != nil {
+			return u.v2rayManager.startupTimings()
+		}
+	case CoreTypeMihomo:
+		if u.mihomoManager != nil {
+			return u.mihomoManager.startupTimings()
+		}
+	}
+	return startupTimings{}
+}
+
+// waitStartupDone polls the core's startup timings until apply has finished
+// or the timeout passes, and returns the last timings seen.
+func (u *UnifiedCoreManager) waitStartupDone(timeout time.Duration) startupTimings {
+	timings := u.coreStartupTimings()
+	for deadline := time.Now().Add(timeout); !timings.Done && time.Now().Before(deadline); {
+		time.Sleep(20 * time.Millisecond)
+		timings = u.coreStartupTimings()
+	}
+	return timings
+}
+
+// waitForPort polls until a TCP connection to the local port succeeds.
+func waitForPort(port int, timeout time.Duration) bool {
+	if port <= 0 {
+		return false
+	}
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.DialTimeout("tcp", addr, 200*time.Millisecond)
+		if err == nil {
+			conn.Close()
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func xrayListeners(v *V2RayCoreManager) []string {
+	if v == nil {
+		return nil
+	}
+	v.mu.RLock()
+	inbounds := v.lastInbounds
+	v.mu.RUnlock()
+	return inbounds
+}
+
+func mihomoListeners() []string {
+	var listeners []string
+	ports := listener.GetPorts()
+	for _, p := range []struct {
+		name string
+		port int
+	}{
+		{"http", ports.Port},
+		{"socks", ports.SocksPort},
+		{"redir", ports.RedirPort},
+		{"tproxy", ports.TProxyPort},
+		{"mixed", ports.MixedPort},
+	} {
+		if p.port != 0 {
+			listeners = append(listeners, fmt.Sprintf("%s :%d", p.name, p.port))
+		}
+	}
+
+	var named []string
+	for name, l := range tunnel.Listeners() {
+		named = append(named, fmt.Sprintf("%s %s", name, l.Address()))
+	}
+	sort.Strings(named)
+	return append(listeners, named...)
+}
@@ -0,0 +1,214 @@
+package libunifiedcore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// statsFlushInterval is how often traffic of the running profile is added
+// to the stats store.
+const statsFlushInterval = 30 * time.Second
+
+type profileTraffic struct {
+	Upload   int64     `json:"upload"`
+	Download int64     `json:"download"`
+	LastUsed time.Time `json:"lastUsed"`
+}
+
+// statsStore is the on-disk record of cumulative traffic per profile, keyed
+// by config checksum.
+type statsStore struct {
+	path     string
+	Profiles map[string]*profileTraffic `json:"profiles"`
+}
+
+func loadStatsStore(path string) (*statsStore, error) {
+	store := &statsStore{path: path, Profiles: make(map[string]*profileTraffic)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stats store: %w", err)
+	}
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, fmt.Errorf("failed to parse stats store: %w", err)
+	}
+	if store.Profiles == nil {
+		store.Profiles = make(map[string]*profileTraffic)
+	}
+	return store, nil
+}
+
+// save writes the store through a temp file so a crash mid-write cannot
+// lose the existing totals.
+func (s *statsStore) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+// SetStatsStorePath persists cumulative traffic per profile (identified by
+// the checksum of its config file) to path, so totals survive app restarts.
+// Existing totals are loaded from path. Traffic of the running profile is
+// added every statsFlushInterval and when the core stops or changes config.
+// An empty path stops persisting.
+func (u *UnifiedCoreManager) SetStatsStorePath(path string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.flushTrafficStatsLocked()
+	u.stopStatsRecorderLocked()
+	if path == "" {
+		u.statsStore = nil
+		u.updateTrafficStatsPatchLocked()
+		log.Println("Stats store disabled")
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create stats store directory: %w", err)
+	}
+	store, err := loadStatsStore(path)
+	if err != nil {
+		return err
+	}
+	u.statsStore = store
+	u.updateTrafficStatsPatchLocked()
+
+	if u.running {
+		u.markStatsCountedLocked()
+		u.startStatsRecorderLocked()
+	}
+	log.Printf("Stats store loaded from %s with %d profiles", path, len(store.Profiles))
+	return nil
+}
+
+// GetTotalTraffic returns the totals per profile, including the running
+// profile's traffic so far, as
+// {"current_profile": checksum, "profiles": {checksum: {"upload", "download", "last_used"}}}.
+// It does not write the store; that happens every statsFlushInterval and on
+// stop.
+func (u *UnifiedCoreManager) GetTotalTraffic() map[string]interface{} {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.collectTrafficStatsLocked()
+
+	profiles := make(map[string]interface{})
+	if u.statsStore != nil {
+		for checksum, traffic := range u.statsStore.Profiles {
+			profiles[checksum] = map[string]interface{}{
+				"upload":    traffic.Upload,
+				"download":  traffic.Download,
+				"last_used": traffic.LastUsed.Unix(),
+			}
+		}
+	}
+
+	current := ""
+	if u.running {
+		current = u.lastConfigChecksum
+	}
+	return map[string]interface{}{
+		"current_profile": current,
+		"profiles":        profiles,
+	}
+}
+
+// startStatsRecorderLocked starts periodic flushing for the current run.
+// Callers must hold u.mu.
+func (u *UnifiedCoreManager) startStatsRecorderLocked() {
+	u.stopStatsRecorderLocked()
+	if u.statsStore == nil || u.ctx == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(u.ctx)
+	u.statsRecorderCancel = cancel
+	go func() {
+		ticker := time.NewTicker(statsFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			u.mu.Lock()
+			if ctx.Err() == nil {
+				u.flushTrafficStatsLocked()
+			}
+			u.mu.Unlock()
+		}
+	}()
+}
+
+// stopStatsRecorderLocked stops periodic flushing. Callers must hold u.mu.
+func (u *UnifiedCoreManager) stopStatsRecorderLocked() {
+	if u.statsRecorderCancel != nil {
+		u.statsRecorderCancel()
+		u.statsRecorderCancel = nil
+	}
+}
+
+// markStatsCountedLocked records the core's counters as already accounted
+// for, since the cores keep totals across restarts. Callers must hold u.mu.
+func (u *UnifiedCoreManager) markStatsCountedLocked() {
+	up, down, err := u.trafficSourceLocked()()
+	if err != nil {
+		up, down = 0, 0
+	}
+	u.statsCountedUp, u.statsCountedDown = up, down
+}
+
+// flushTrafficStatsLocked adds the traffic since the last flush to the
+// running profile and saves the store. Callers must hold u.mu.
+func (u *UnifiedCoreManager) flushTrafficStatsLocked() {
+	if !u.collectTrafficStatsLocked() {
+		return
+	}
+	if err := u.statsStore.save(); err != nil {
+		log.Printf("Failed to save stats store: %v", err)
+	}
+}
+
+// collectTrafficStatsLocked adds the traffic since the last collection to
+// the running profile in memory. It reports whether the store changed.
+// Callers must hold u.mu.
+func (u *UnifiedCoreManager) collectTrafficStatsLocked() bool {
+	if u.statsStore == nil || !u.running || u.lastConfigChecksum == "" {
+		return false
+	}
+	up, down, err := u.trafficSourceLocked()()
+	if err != nil {
+		return false
+	}
+
+	deltaUp, deltaDown := up-u.statsCountedUp, down-u.statsCountedDown
+	// Counters went backwards, e.g. reset by Mihomo's API
+	if deltaUp < 0 {
+		deltaUp = up
+	}
+	if deltaDown < 0 {
+		deltaDown = down
+	}
+	u.statsCountedUp, u.statsCountedDown = up, down
+
+	profile := u.statsStore.Profiles[u.lastConfigChecksum]
+	if profile == nil {
+		profile = &profileTraffic{}
+		u.statsStore.Profiles[u.lastConfigChecksum] = profile
+	}
+	profile.Upload += deltaUp
+	profile.Download += deltaDown
+	profile.LastUsed = time.Now()
+	return true
+}
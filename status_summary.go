@@ -0,0 +1,120 @@
+package libunifiedcore
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	C "github.com/metacubex/mihomo/constant"
+	"github.com/metacubex/mihomo/tunnel"
+	"github.com/xtls/xray-core/features/outbound"
+)
+
+// StatusSummary returns a one-line status for notifications, e.g.
+// "Mihomo running — TOKYO-01 — 12ms — up 3m". The proxy is the one the
+// default route currently uses, followed through selector groups for Mihomo
+// and the default outbound for Xray. The latency is Mihomo's last URL test
+// of that proxy and is left out when unknown, as it always is for Xray.
+func (u *UnifiedCoreManager) StatusSummary() string {
+	u.mu.RLock()
+	running := u.running
+	coreType := u.coreType
+	startedAt := u.startedAt
+	v2rayManager := u.v2rayManager
+	u.mu.RUnlock()
+
+	if !running {
+		return fmt.Sprintf("%s stopped", coreType.DisplayName())
+	}
+
+	parts := []string{coreType.DisplayName() + " running"}
+	var proxy string
+	var latency int
+	switch coreType {
+	case CoreTypeV2Ray, CoreTypeXray:
+		proxy = xrayDefaultOutboundTag(v2rayManager)
+	case CoreTypeMihomo:
+		proxy, latency = mihomoActiveProxy()
+	}
+	if proxy != "" {
+		parts = append(parts, proxy)
+	}
+	if latency > 0 {
+		parts = append(parts, fmt.Sprintf("%dms", latency))
+	}
+	if !startedAt.IsZero() {
+		parts = append(parts, "up "+formatUptime(time.Since(startedAt)))
+	}
+	return strings.Join(parts, " — ")
+}
+
+// xrayDefaultOutboundTag returns the tag of the running instance's default
+// outbound.
+func xrayDefaultOutboundTag(v *V2RayCoreManager) string {
+	if v == nil {
+		return ""
+	}
+	v.mu.RLock()
+	instance := v.instance
+	v.mu.RUnlock()
+	if instance == nil {
+		return ""
+	}
+	if manager, ok := instance.GetFeature(outbound.ManagerType()).(outbound.Manager); ok {
+		if handler := manager.GetDefaultHandler(); handler != nil {
+			return handler.Tag()
+		}
+	}
+	return ""
+}
+
+// mihomoActiveProxy follows the MATCH rule's target through the selections
+// of its groups and returns the proxy it ends at with its last delay.
+func mihomoActiveProxy() (string, int) {
+	name := "GLOBAL"
+	for _, rule := range tunnel.Rules() {
+		if rule.RuleType() == C.MATCH {
+			name = rule.Adapter()
+			break
+		}
+	}
+
+	proxies := tunnel.Proxies()
+	proxy, exists := proxies[name]
+	if !exists {
+		return name, 0
+	}
+	// Nested groups are rarely deeper than a few levels; the bound guards
+	// against cycles.
+	for depth := 0; depth < 8; depth++ {
+		now, ok := proxy.Adapter().(groupNow)
+		if !ok || now.Now() == "" {
+			break
+		}
+		next, exists := proxies[now.Now()]
+		if !exists {
+			return now.Now(), 0
+		}
+		name, proxy = now.Now(), next
+	}
+
+	history := proxy.DelayHistory()
+	if len(history) == 0 {
+		return name, 0
+	}
+	return name, int(history[len(history)-1].Delay)
+}
+
+// formatUptime renders d at a coarse resolution, e.g. 45s, 3m, 2h5m, 1d3h.
+func formatUptime(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh%dm", int(d.Hours()), int(d.Minutes())%60)
+	default:
+		return fmt.Sprintf("%dd%dh", int(d.Hours())/24, int(d.Hours())%24)
+	}
+}
@@ -0,0 +1,125 @@
+package libunifiedcore
+
+import (
+	"log"
+	"os"
+	"sync"
+)
+
+// TempDirRegistry tracks temporary directories so they can be removed in one
+// place instead of accumulating on the device.
+type TempDirRegistry struct {
+	mu   sync.Mutex
+	dirs map[string]bool
+}
+
+func NewTempDirRegistry() *TempDirRegistry {
+	return &TempDirRegistry{dirs: make(map[string]bool)}
+}
+
+// globalTempDirs holds every temp dir created or registered through this
+// package, see CleanupTempDirs.
+var globalTempDirs = NewTempDirRegistry()
+
+// MkdirTemp creates a temp dir like os.MkdirTemp and registers it.
+func (r *TempDirRegistry) MkdirTemp(pattern string) (string, error) {
+	dir, err := os.MkdirTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	r.Register(dir)
+	return dir, nil
+}
+
+// Register adds an existing directory to the registry.
+func (r *TempDirRegistry) Register(dir string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dirs[dir] = true
+}
+
+// Remove deletes a registered directory and forgets it.
+func (r *TempDirRegistry) Remove(dir string) error {
+	r.mu.Lock()
+	delete(r.dirs, dir)
+	r.mu.Unlock()
+	return os.RemoveAll(dir)
+}
+
+// Cleanup deletes every registered directory and returns the first error.
+func (r *TempDirRegistry) Cleanup() error {
+	r.mu.Lock()
+	dirs := r.dirs
+	r.dirs = make(map[string]bool)
+	r.mu.Unlock()
+
+	var firstErr error
+	for dir := range dirs {
+		if err := os.RemoveAll(dir); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Count returns the number of registered directories.
+func (r *TempDirRegistry) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.dirs)
+}
+
+// CreateTempDir creates a temp dir that CleanupTempDirs will remove.
+func CreateTempDir(pattern string) (string, error) {
+	return globalTempDirs.MkdirTemp(pattern)
+}
+
+// CleanupTempDirs removes every temp dir created through CreateTempDir or
+// registered on a manager that has not stopped yet.
+func CleanupTempDirs() error {
+	count := globalTempDirs.Count()
+	if err := globalTempDirs.Cleanup(); err != nil {
+		log.Printf("Failed to clean up temp dirs: %v", err)
+		return err
+	}
+	log.Printf("Cleaned up %d temp dirs", count)
+	return nil
+}
+
+// RegisterTempDir marks dir as owned by this manager; it is removed when the
+// manager stops.
+func (m *MihomoCoreManager) RegisterTempDir(dir string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tempDirs = append(m.tempDirs, dir)
+	globalTempDirs.Register(dir)
+}
+
+// removeTempDirsLocked deletes the manager's temp dirs. Callers must hold m.mu.
+func (m *MihomoCoreManager) removeTempDirsLocked() {
+	for _, dir := range m.tempDirs {
+		if err := globalTempDirs.Remove(dir); err != nil {
+			log.Printf("Failed to remove temp dir %s: %v", dir, err)
+		}
+	}
+	m.tempDirs = nil
+}
+
+// RegisterTempDir marks dir as owned by this manager; it is removed when the
+// manager stops.
+func (v *V2RayCoreManager) RegisterTempDir(dir string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.tempDirs = append(v.tempDirs, dir)
+	globalTempDirs.Register(dir)
+}
+
+// removeTempDirsLocked deletes the manager's temp dirs. Callers must hold v.mu.
+func (v *V2RayCoreManager) removeTempDirsLocked() {
+	for _, dir := range v.tempDirs {
+		if err := globalTempDirs.Remove(dir); err != nil {
+			log.Printf("Failed to remove temp dir %s: %v", dir, err)
+		}
+	}
+	v.tempDirs = nil
+}
@@ -0,0 +1,248 @@
+package libunifiedcore
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/metacubex/mihomo/tunnel/statistic"
+	"github.com/xtls/xray-core/features/stats"
+)
+
+// trafficAlertInterval is how often the traffic alert monitor polls the core.
+const trafficAlertInterval = time.Second
+
+type trafficAlert struct {
+	limit    int64
+	onExceed func(total int64)
+}
+
+// SetTrafficAlert registers onExceed to be called once when the traffic
+// (upload + download) since the core started reaches limitBytes. A limit of
+// 0 or a nil callback removes the alert. The monitor stops with the core and
+// is re-armed on every start.
+func (u *UnifiedCoreManager) SetTrafficAlert(limitBytes int64, onExceed func(total int64)) error {
+	if limitBytes < 0 {
+		return fmt.Errorf("invalid traffic limit: %d", limitBytes)
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if limitBytes == 0 || onExceed == nil {
+		u.trafficAlert = nil
+		u.stopTrafficAlertLocked()
+		u.updateTrafficStatsPatchLocked()
+		log.Println("Traffic alert cleared")
+		return nil
+	}
+
+	u.trafficAlert = &trafficAlert{limit: limitBytes, onExceed: onExceed}
+	u.updateTrafficStatsPatchLocked()
+
+	if u.running {
+		u.startTrafficAlertLocked()
+	}
+	log.Printf("Traffic alert set at %d bytes", limitBytes)
+	return nil
+}
+
+// startTrafficAlertLocked (re)starts the monitor for the current alert.
+// Callers must hold u.mu and the core must be running.
+func (u *UnifiedCoreManager) startTrafficAlertLocked() {
+	u.stopTrafficAlertLocked()
+	if u.trafficAlert == nil || u.ctx == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(u.ctx)
+	u.trafficAlertCancel = cancel
+	go monitorTraffic(ctx, *u.trafficAlert, u.trafficSourceLocked(), u.trafficBaseline)
+}
+
+// stopTrafficAlertLocked stops a running monitor. Callers must hold u.mu.
+func (u *UnifiedCoreManager) stopTrafficAlertLocked() {
+	if u.trafficAlertCancel != nil {
+		u.trafficAlertCancel()
+		u.trafficAlertCancel = nil
+	}
+}
+
+// trafficSourceLocked returns a function reporting the cumulative traffic of
+// the active core. Callers must hold u.mu.
+func (u *UnifiedCoreManager) trafficSourceLocked() func() (int64, int64, error) {
+	switch u.coreType {
+	case CoreTypeV2Ray, CoreTypeXray:
+		if u.v2rayManager != nil {
+			return u.v2rayManager.trafficTotals
+		}
+	case CoreTypeMihomo:
+		if u.mihomoManager != nil {
+			return u.mihomoManager.trafficTotals
+		}
+	}
+	return func() (int64, int64, error) {
+		return 0, 0, fmt.Errorf("no core running")
+	}
+}
+
+// markTrafficBaselineLocked records the counters at core start, so traffic
+// is measured since start even when the core keeps totals across restarts.
+// Callers must hold u.mu.
+func (u *UnifiedCoreManager) markTrafficBaselineLocked() {
+	up, down, err := u.trafficSourceLocked()()
+	if err != nil {
+		u.trafficBaseline = 0
+		return
+	}
+	u.trafficBaseline = up + down
+}
+
+// ResetTraffic zeroes the running core's cumulative upload/download counters
+// without restarting it, so open connections are kept. A traffic alert is
+// re-armed to count from the reset.
+func (u *UnifiedCoreManager) ResetTraffic() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if !u.running {
+		return fmt.Errorf("no core running")
+	}
+	u.collectTrafficStatsLocked()
+
+	var err error
+	switch u.coreType {
+	case CoreTypeV2Ray, CoreTypeXray:
+		if u.v2rayManager == nil {
+			return fmt.Errorf("V2Ray core is not running")
+		}
+		err = u.v2rayManager.resetTraffic()
+	case CoreTypeMihomo:
+		statistic.DefaultManager.ResetStatistic()
+	default:
+		err = fmt.Errorf("unsupported core type: %v", u.coreType)
+	}
+	if err != nil {
+		return err
+	}
+
+	u.trafficBaseline = 0
+	u.markStatsCountedLocked()
+	u.startTrafficAlertLocked()
+	log.Printf("%s traffic counters reset", u.coreType.DisplayName())
+	return nil
+}
+
+func monitorTraffic(ctx context.Context, alert trafficAlert, source func() (int64, int64, error), baseline int64) {
+	ticker := time.NewTicker(trafficAlertInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		up, down, err := source()
+		if err != nil {
+			continue
+		}
+		total := up + down - baseline
+		if total >= alert.limit {
+			log.Printf("Traffic alert: %d bytes used, limit %d", total, alert.limit)
+			alert.onExceed(total)
+			return
+		}
+	}
+}
+
+// updateTrafficStatsPatchLocked enables Xray's traffic counters while a
+// feature reading them is on (traffic alert, stats store, traffic history or
+// an open TrafficStream) and removes them once none is. Xray only counts
+// traffic when outbound stats are enabled in the config, so a change takes
+// effect from the next start. Callers must hold u.mu.
+func (u *UnifiedCoreManager) updateTrafficStatsPatchLocked() {
+	if u.trafficAlert != nil || u.statsStore != nil || u.trafficHistoryOn || u.trafficStreams > 0 {
+		u.v2rayPatches.set("traffic-stats", enableXrayTrafficStats)
+		return
+	}
+	u.v2rayPatches.set("traffic-stats", nil)
+}
+
+// enableXrayTrafficStats turns on the stats manager and per-outbound traffic
+// counters that Xray needs to report totals.
+func enableXrayTrafficStats(config map[string]interface{}) error {
+	configSection(config, "stats")
+	system := configSection(configSection(config, "policy"), "system")
+	system["statsOutboundUplink"] = true
+	system["statsOutboundDownlink"] = true
+	return nil
+}
+
+// counterVisitor is implemented by the Xray stats manager.
+type counterVisitor interface {
+	VisitCounters(func(string, stats.Counter) bool)
+}
+
+// trafficTotals sums the outbound traffic counters of the running instance.
+func (v *V2RayCoreManager) trafficTotals() (int64, int64, error) {
+	v.mu.RLock()
+	instance := v.instance
+	v.mu.RUnlock()
+
+	if instance == nil {
+		return 0, 0, fmt.Errorf("V2Ray core is not running")
+	}
+	visitor, ok := instance.GetFeature(stats.ManagerType()).(counterVisitor)
+	if !ok {
+		return 0, 0, fmt.Errorf("stats are not enabled in V2Ray config")
+	}
+
+	var up, down int64
+	visitor.VisitCounters(func(name string, counter stats.Counter) bool {
+		if !strings.HasPrefix(name, "outbound>>>") {
+			return true
+		}
+		switch {
+		case strings.HasSuffix(name, ">>>traffic>>>uplink"):
+			up += counter.Value()
+		case strings.HasSuffix(name, ">>>traffic>>>downlink"):
+			down += counter.Value()
+		}
+		return true
+	})
+	return up, down, nil
+}
+
+// resetTraffic zeroes the outbound traffic counters of the running instance.
+func (v *V2RayCoreManager) resetTraffic() error {
+	v.mu.RLock()
+	instance := v.instance
+	v.mu.RUnlock()
+
+	if instance == nil {
+		return fmt.Errorf("V2Ray core is not running")
+	}
+	visitor, ok := instance.GetFeature(stats.ManagerType()).(counterVisitor)
+	if !ok {
+		return fmt.Errorf("stats are not enabled in V2Ray config")
+	}
+
+	visitor.VisitCounters(func(name string, counter stats.Counter) bool {
+		if strings.Contains(name, ">>>traffic>>>") {
+			counter.Set(0)
+		}
+		return true
+	})
+	return nil
+}
+
+// trafficTotals returns Mihomo's cumulative traffic. The totals are kept by
+// the process-wide tracker and survive restarts.
+func (m *MihomoCoreManager) trafficTotals() (int64, int64, error) {
+	snapshot := statistic.DefaultManager.Snapshot()
+	return snapshot.UploadTotal, snapshot.DownloadTotal, nil
+}
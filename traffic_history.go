@@ -0,0 +1,160 @@
+package libunifiedcore
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// The traffic history is sampled every trafficHistoryInterval and kept for
+// trafficHistoryRetention.
+const (
+	trafficHistoryInterval   = time.Second
+	trafficHistoryRetention  = time.Hour
+	maxTrafficHistoryBuckets = 1000
+)
+
+// TrafficBucket is the traffic of one GetTrafficHistory bucket. Start is
+// the beginning of the bucket in Unix milliseconds.
+type TrafficBucket struct {
+	Start int64 `json:"start"`
+	Up    int64 `json:"up"`
+	Down  int64 `json:"down"`
+}
+
+type trafficSample struct {
+	at       time.Time
+	up, down int64
+}
+
+// trafficHistory holds the samples of the last trafficHistoryRetention,
+// oldest first. It is kept across core restarts.
+type trafficHistory struct {
+	mu      sync.Mutex
+	samples []trafficSample
+}
+
+func (h *trafficHistory) add(sample trafficSample) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.samples = append(h.samples, sample)
+	cutoff := sample.at.Add(-trafficHistoryRetention)
+	drop := 0
+	for drop < len(h.samples) && !h.samples[drop].at.After(cutoff) {
+		drop++
+	}
+	if drop > 0 {
+		h.samples = append(h.samples[:0], h.samples[drop:]...)
+	}
+}
+
+// SetTrafficHistoryEnabled turns the history read by GetTrafficHistory on
+// or off. While enabled, traffic is sampled every second while a core runs
+// and kept for an hour; disabling drops the samples. Xray only counts
+// traffic with stats enabled, which takes effect from the next start.
+func (u *UnifiedCoreManager) SetTrafficHistoryEnabled(enabled bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.trafficHistoryOn = enabled
+	u.updateTrafficStatsPatchLocked()
+	if !enabled {
+		u.trafficHistory.mu.Lock()
+		u.trafficHistory.samples = nil
+		u.trafficHistory.mu.Unlock()
+	}
+	u.startTrafficHistoryLocked()
+	log.Printf("Traffic history enabled: %v", enabled)
+}
+
+// GetTrafficHistory returns the bytes sent and received over the last
+// window, split into buckets of equal length, oldest first, so a chart can
+// be drawn without having listened to TrafficStream. It fails unless
+// SetTrafficHistoryEnabled turned the history on; buckets from before the
+// first sample or while no core ran are zero.
+func (u *UnifiedCoreManager) GetTrafficHistory(window time.Duration, buckets int) ([]TrafficBucket, error) {
+	if window <= 0 || window > trafficHistoryRetention {
+		return nil, fmt.Errorf("invalid window: %v, must be between 0 and %v", window, trafficHistoryRetention)
+	}
+	if buckets <= 0 || buckets > maxTrafficHistoryBuckets {
+		return nil, fmt.Errorf("invalid bucket count: %d, must be between 1 and %d", buckets, maxTrafficHistoryBuckets)
+	}
+	width := window / time.Duration(buckets)
+	if width < trafficHistoryInterval {
+		return nil, fmt.Errorf("buckets of %v are shorter than the %v sample interval", width, trafficHistoryInterval)
+	}
+
+	u.mu.RLock()
+	enabled := u.trafficHistoryOn
+	u.mu.RUnlock()
+	if !enabled {
+		return nil, fmt.Errorf("traffic history is not enabled")
+	}
+
+	end := time.Now()
+	start := end.Add(-window)
+	result := make([]TrafficBucket, buckets)
+	for i := range result {
+		result[i].Start = start.Add(time.Duration(i) * width).UnixMilli()
+	}
+
+	u.trafficHistory.mu.Lock()
+	defer u.trafficHistory.mu.Unlock()
+	for _, sample := range u.trafficHistory.samples {
+		if !sample.at.After(start) {
+			continue
+		}
+		i := int(sample.at.Sub(start) / width)
+		if i >= buckets {
+			i = buckets - 1
+		}
+		result[i].Up += sample.up
+		result[i].Down += sample.down
+	}
+	return result, nil
+}
+
+// startTrafficHistoryLocked starts sampling the current run into the
+// history, or stops sampling when the history is disabled. Callers must
+// hold u.mu.
+func (u *UnifiedCoreManager) startTrafficHistoryLocked() {
+	if u.trafficHistoryCancel != nil {
+		u.trafficHistoryCancel()
+		u.trafficHistoryCancel = nil
+	}
+	if !u.trafficHistoryOn || !u.running || u.ctx == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(u.ctx)
+	u.trafficHistoryCancel = cancel
+	go recordTrafficHistory(ctx, &u.trafficHistory, u.trafficSourceLocked())
+}
+
+func recordTrafficHistory(ctx context.Context, history *trafficHistory, source func() (int64, int64, error)) {
+	ticker := time.NewTicker(trafficHistoryInterval)
+	defer ticker.Stop()
+
+	lastUp, lastDown, _ := source()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		up, down, err := source()
+		if err != nil {
+			continue
+		}
+		// Counters go back to zero on ResetTraffic
+		if up < lastUp || down < lastDown {
+			lastUp, lastDown = 0, 0
+		}
+		history.add(trafficSample{at: time.Now(), up: up - lastUp, down: down - lastDown})
+		lastUp, lastDown = up, down
+	}
+}
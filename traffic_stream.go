@@ -0,0 +1,82 @@
+package libunifiedcore
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// TrafficPair is the traffic of one TrafficStream interval.
+type TrafficPair struct {
+	Up   int64 `json:"up"`
+	Down int64 `json:"down"`
+}
+
+// TrafficStream emits the bytes sent and received during each interval, for
+// live bandwidth graphs. The channel is closed when ctx is canceled or the
+// core stops; it is closed right away if no core is running. Ticks are
+// skipped while the reader is behind, and the next pair covers the whole
+// time since the last delivered one. An interval of 0 or less means one
+// second. Xray only counts traffic with stats enabled, which takes effect
+// from the next start; they stay enabled until ctx is canceled.
+func (u *UnifiedCoreManager) TrafficStream(ctx context.Context, interval time.Duration) <-chan TrafficPair {
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	u.mu.Lock()
+	u.trafficStreams++
+	u.updateTrafficStatsPatchLocked()
+	coreCtx := u.ctx
+	running := u.running
+	u.mu.Unlock()
+
+	context.AfterFunc(ctx, func() {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		u.trafficStreams--
+		u.updateTrafficStatsPatchLocked()
+	})
+
+	out := make(chan TrafficPair, 1)
+	if !running || coreCtx == nil {
+		close(out)
+		return out
+	}
+
+	go func() {
+		defer close(out)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		lastUp, lastDown, err := u.trafficTotals()
+		if err != nil {
+			log.Printf("Traffic stream stopped: %v", err)
+			return
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-coreCtx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			up, down, err := u.trafficTotals()
+			if err != nil {
+				continue
+			}
+			// Counters go back to zero on ResetTraffic
+			if up < lastUp || down < lastDown {
+				lastUp, lastDown = 0, 0
+			}
+			select {
+			case out <- TrafficPair{Up: up - lastUp, Down: down - lastDown}:
+				lastUp, lastDown = up, down
+			default:
+			}
+		}
+	}()
+	return out
+}
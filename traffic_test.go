@@ -0,0 +1,53 @@
+package libunifiedcore
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTrafficStatsPatchFollowsFeatures(t *testing.T) {
+	u := NewUnifiedCoreManager()
+	enabled := func() bool {
+		u.mu.RLock()
+		defer u.mu.RUnlock()
+		_, ok := u.v2rayPatches.patches["traffic-stats"]
+		return ok
+	}
+
+	if enabled() {
+		t.Fatal("traffic stats enabled on a new manager")
+	}
+
+	if err := u.SetTrafficAlert(1<<20, func(int64) {}); err != nil {
+		t.Fatalf("SetTrafficAlert: %v", err)
+	}
+	if err := u.SetStatsStorePath(filepath.Join(t.TempDir(), "stats.json")); err != nil {
+		t.Fatalf("SetStatsStorePath: %v", err)
+	}
+	u.SetTrafficHistoryEnabled(true)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	u.TrafficStream(ctx, time.Second)
+
+	steps := []struct {
+		name string
+		off  func()
+		want bool
+	}{
+		{"alert cleared", func() { u.SetTrafficAlert(0, nil) }, true},
+		{"stats store disabled", func() { u.SetStatsStorePath("") }, true},
+		{"history disabled", func() { u.SetTrafficHistoryEnabled(false) }, true},
+		{"stream canceled", cancel, false},
+	}
+	for _, step := range steps {
+		if !enabled() {
+			t.Fatalf("traffic stats disabled before %s", step.name)
+		}
+		step.off()
+		if !waitFor(time.Second, func() bool { return enabled() == step.want }) {
+			t.Errorf("after %s: traffic stats enabled = %v, want %v", step.name, enabled(), step.want)
+		}
+	}
+}
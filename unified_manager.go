@@ -5,20 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"os"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"time"
 )
 
-// minInt returns the minimum of two integers
-func minInt(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
 type UnifiedCoreManager struct {
 	mu       sync.RWMutex
 	coreType CoreType
@@ -36,7 +30,95 @@ type UnifiedCoreManager struct {
 	configFormat string
 
 	assetPath string
-	logLevel  string
+	cacheDir  string // Mihomo cache.db location, see SetCacheDir
+
+	connectTimeout time.Duration // see SetConnectTimeout
+	warmStart      bool          // traffic held until Resume, see warm_start.go
+
+	// Retries for a config that is not written yet, see config_read.go
+	configReadRetries int
+	configReadDelay   time.Duration
+
+	// Per-start state dir, see ephemeral.go
+	ephemeral    bool
+	ephemeralDir string
+	logLevel     string
+
+	// coreTypeExplicit records that the type came from SetCoreType rather
+	// than the default; strictCoreType makes RunConfig enforce it.
+	coreTypeExplicit bool
+	strictCoreType   bool
+
+	// scopedHomeDir is set by SetHomeDirForManager, see home_dir.go
+	scopedHomeDir bool
+
+	// Config patches pushed down to the core managers on start, see
+	// unified_options.go
+	v2rayPatches  patchSet
+	mihomoPatches patchSet
+
+	// Traffic alert state, see traffic.go
+	trafficAlert       *trafficAlert
+	trafficAlertCancel context.CancelFunc
+	trafficBaseline    int64
+
+	// Last started config, see config_apply.go
+	lastConfigChecksum string
+	lastConfig         map[string]interface{}
+	lastApplyAction    string
+
+	// Protocol allowlist, see allowed_protocols.go
+	allowedProtocols map[string]bool
+
+	// Where applied configs came from, see config_meta.go
+	configOrigins     map[string]configOrigin
+	appliedConfigPath string
+	configAppliedAt   time.Time
+
+	// Port range for allocated ports, see port_range.go
+	portRangeMin int
+	portRangeMax int
+
+	// Tun file descriptor from the platform VPN service, see SetTunFD
+	tunFD int
+
+	// When the running core was started, see StatusSummary
+	startedAt time.Time
+
+	// Probe URL overrides, see apparent_ip.go
+	probeURL  string
+	ipEchoURL string
+
+	// Persistent per-profile traffic, see stats_store.go
+	statsStore          *statsStore
+	statsRecorderCancel context.CancelFunc
+	statsCountedUp      int64
+	statsCountedDown    int64
+
+	// Rolling traffic samples, see traffic_history.go
+	trafficHistory       trafficHistory
+	trafficHistoryOn     bool
+	trafficHistoryCancel context.CancelFunc
+
+	// TrafficStream calls whose context is not done yet, see
+	// traffic_stream.go
+	trafficStreams int
+
+	// Kill switch state, see kill_switch.go
+	killSwitchEnabled   bool
+	killSwitchCancel    context.CancelFunc
+	killSwitchEngaged   bool
+	killSwitchListener  net.Listener
+	killSwitchTunStop   chan struct{}
+	killSwitchSuspended int
+
+	// Forwarder holding the SOCKS port after a soft restart, and the
+	// config's API port when a soft restart moved it, see soft_restart.go
+	socksFront         *socksFront
+	softRestartAPIPort int
+
+	// Serializes Restart and ApplyConfig, see apply_queue.go
+	applies applyQueue
 }
 
 func (u *UnifiedCoreManager) setCoreType(coreType CoreType) error {
@@ -52,12 +134,22 @@ func (u *UnifiedCoreManager) setCoreType(coreType CoreType) error {
 	}
 
 	u.coreType = coreType
+	u.coreTypeExplicit = true
 	u.configFormat = "json" // Always use JSON format
 
 	log.Printf("Core type set to: %s", coreType.DisplayName())
 	return nil
 }
 
+// SetStrictCoreType makes RunConfig fail when the injected coreType differs
+// from the one set explicitly via SetCoreType, instead of silently preferring
+// the config.
+func (u *UnifiedCoreManager) SetStrictCoreType(strict bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.strictCoreType = strict
+}
+
 func (u *UnifiedCoreManager) SetCoreType(coreTypeStr string) error {
 	coreType, err := ParseCoreType(coreTypeStr)
 	if err != nil {
@@ -74,7 +166,6 @@ func (u *UnifiedCoreManager) SetCoreTypeFromString(coreTypeStr string) error {
 	return u.setCoreType(coreType)
 }
 
-
 func (u *UnifiedCoreManager) SetPorts(socksPort, apiPort int) error {
 	u.mu.Lock()
 	defer u.mu.Unlock()
@@ -102,6 +193,7 @@ func (u *UnifiedCoreManager) SetAssetPath(assetPath string) {
 	u.mu.Lock()
 	defer u.mu.Unlock()
 	u.assetPath = assetPath
+	u.scopedHomeDir = false
 }
 
 func (u *UnifiedCoreManager) SetLogLevel(logLevel string) {
@@ -111,24 +203,47 @@ func (u *UnifiedCoreManager) SetLogLevel(logLevel string) {
 }
 
 func (u *UnifiedCoreManager) RunConfig(configPath string) error {
+	u.clearWarmStart()
+	return u.runConfig(configPath, nil)
+}
+
+// runConfig starts the core, recording phase timings into diag when non-nil.
+func (u *UnifiedCoreManager) runConfig(configPath string, diag *StartupDiagnostics) error {
+	// Store an absolute path so Restart keeps working if the CWD changes
+	absPath, absErr := filepath.Abs(configPath)
+	if absErr != nil {
+		return fmt.Errorf("failed to resolve config path: %w", absErr)
+	}
+	configPath = absPath
+
+	// Always read coreType from Flutter's injected config. The file is read
+	// before taking u.mu, so waiting for a config that is still being
+	// written does not block the manager.
+	readStart := time.Now()
+	retries, delay := u.configReadPolicy()
+	configBytes, readErr := readConfigFile(configPath, retries, delay)
+	readMs := time.Since(readStart).Milliseconds()
+
 	u.mu.Lock()
 	defer u.mu.Unlock()
 
+	// Account the traffic of a core this call is about to replace
+	u.flushTrafficStatsLocked()
 	u.configPath = configPath
 
 	log.Printf("Starting core with initial type: %s", u.coreType.DisplayName())
 
-	// Always read coreType from Flutter's injected config
-	configBytes, readErr := os.ReadFile(configPath)
 	if readErr != nil {
 		return fmt.Errorf("failed to read config file: %w", readErr)
 	}
-
-	log.Printf("Config file content preview: %s", string(configBytes[:minInt(200, len(configBytes))]))
+	if diag != nil {
+		diag.ReadMs = readMs
+	}
+	phaseStart := time.Now()
 
 	// Parse the injected config (must be JSON with coreType field)
 	var injectedConfig map[string]interface{}
- 	if err := json.Unmarshal(configBytes, &injectedConfig); err != nil {
+	if err := json.Unmarshal(configBytes, &injectedConfig); err != nil {
 		return fmt.Errorf("failed to parse injected config as JSON: %w", err)
 	}
 
@@ -143,10 +258,30 @@ func (u *UnifiedCoreManager) RunConfig(configPath string) error {
 		return fmt.Errorf("invalid coreType in injected config: %s - %w", coreTypeStr, parseErr)
 	}
 
+	if u.strictCoreType && u.coreTypeExplicit && detectedCoreType != u.coreType {
+		return fmt.Errorf("injected coreType %s does not match explicitly set core type %s", detectedCoreType, u.coreType)
+	}
+
+	// Fail fast on missing geo databases, before touching a running core
+	if err := checkGeoAssets(detectedCoreType, injectedConfig, u.assetPath); err != nil {
+		return fmt.Errorf("asset preflight failed: %w", err)
+	}
+	if err := u.checkAllowedProtocolsLocked(detectedCoreType, injectedConfig); err != nil {
+		return err
+	}
+	if err := checkTunDevice(detectedCoreType, unwrapCoreConfig(injectedConfig), u.tunFD); err != nil {
+		return fmt.Errorf("tun preflight failed: %w", err)
+	}
+
+	if diag != nil {
+		diag.CoreType = detectedCoreType.String()
+		diag.ParseMs = time.Since(phaseStart).Milliseconds()
+	}
+
 	// Check if we need to switch core types
 	if u.running && u.coreType != detectedCoreType {
 		log.Printf("Core type change detected: %s -> %s, stopping current core first", u.coreType.DisplayName(), detectedCoreType.DisplayName())
-		
+
 		// Stop the current running core
 		var stopErr error
 		switch u.coreType {
@@ -180,7 +315,7 @@ func (u *UnifiedCoreManager) RunConfig(configPath string) error {
 	// If already running the same core type, stop it first to restart with new config
 	if u.running {
 		log.Printf("Core already running, stopping first to restart with new config")
-		
+
 		var stopErr error
 		switch u.coreType {
 		case CoreTypeV2Ray, CoreTypeXray:
@@ -206,6 +341,9 @@ func (u *UnifiedCoreManager) RunConfig(configPath string) error {
 		time.Sleep(50 * time.Millisecond)
 	}
 
+	// A normal start binds the config's own ports again
+	u.clearSoftRestartLocked()
+
 	// Extract ports from Flutter's injected config instead of generating random ones
 	if socksPortRaw, exists := injectedConfig["mixed-port"]; exists {
 		if socksPortFloat, ok := socksPortRaw.(float64); ok {
@@ -230,18 +368,47 @@ func (u *UnifiedCoreManager) RunConfig(configPath string) error {
 			}
 		}
 	}
-	
-	// Fallback to random ports if not found in config
+
+	// Fallback to free ports if not found in config, see SetPortRange
 	if u.socksPort == 0 {
-		u.socksPort = 10000 + time.Now().Nanosecond()%50000
+		port, err := u.allocatePortLocked(u.apiPort)
+		if err != nil {
+			return fmt.Errorf("failed to allocate SOCKS port: %w", err)
+		}
+		u.socksPort = port
+		u.notePortFallback(diag, fmt.Sprintf("config did not specify mixed-port, using allocated port %d", port))
 	}
 	if u.apiPort == 0 {
-		u.apiPort = 10000 + time.Now().Nanosecond()%50000
+		port, err := u.allocatePortLocked(u.socksPort)
+		if err != nil {
+			return fmt.Errorf("failed to allocate API port: %w", err)
+		}
+		u.apiPort = port
+		u.notePortFallback(diag, fmt.Sprintf("config did not specify external-controller, using allocated port %d", port))
 	}
 	log.Printf("Final ports configured - SOCKS: %d, API: %d", u.socksPort, u.apiPort)
 
+	// The kill switch or a soft restart may be holding the SOCKS port the
+	// new core needs
+	u.releaseKillSwitchLocked()
+	u.closeSOCKSFrontLocked()
+
+	// Explain a taken port here rather than failing inside the core
+	if err := checkListenPorts(u.coreType, injectedConfig); err != nil {
+		return fmt.Errorf("port preflight failed: %w", err)
+	}
+
+	ephemeralDir, ephemeralErr := u.prepareEphemeralLocked()
+	if ephemeralErr != nil {
+		return ephemeralErr
+	}
+
 	u.ctx, u.cancel = context.WithCancel(context.Background())
 
+	if diag != nil {
+		diag.startCallAt = time.Now()
+	}
+
 	var err error
 	switch u.coreType {
 	case CoreTypeV2Ray, CoreTypeXray:
@@ -260,10 +427,24 @@ func (u *UnifiedCoreManager) RunConfig(configPath string) error {
 		if u.cancel != nil {
 			u.cancel()
 		}
+		if ephemeralDir != "" {
+			globalTempDirs.Remove(ephemeralDir)
+		}
 		return fmt.Errorf("failed to start %s core: %w", u.coreType.DisplayName(), err)
 	}
+	if ephemeralDir != "" {
+		u.adoptEphemeralDirLocked(ephemeralDir)
+	}
 
 	u.running = true
+	u.startedAt = time.Now()
+	u.recordAppliedConfigLocked(configBytes, injectedConfig)
+	u.markTrafficBaselineLocked()
+	u.startTrafficAlertLocked()
+	u.startKillSwitchLocked()
+	u.markStatsCountedLocked()
+	u.startStatsRecorderLocked()
+	u.startTrafficHistoryLocked()
 	log.Printf("%s core started successfully with config: %s", u.coreType.DisplayName(), configPath)
 	return nil
 }
@@ -272,9 +453,13 @@ func (u *UnifiedCoreManager) Stop() error {
 	u.mu.Lock()
 	defer u.mu.Unlock()
 
+	u.releaseKillSwitchLocked()
+	u.closeSOCKSFrontLocked()
+
 	if !u.running {
 		return nil
 	}
+	u.flushTrafficStatsLocked()
 
 	var err error
 	switch u.coreType {
@@ -332,9 +517,32 @@ func (u *UnifiedCoreManager) GetAPIPort() int {
 }
 
 func (u *UnifiedCoreManager) TestConfig(configPath string) error {
+	configBytes, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(configBytes, &config); err != nil {
+		return fmt.Errorf("failed to parse config JSON: %w", err)
+	}
+
+	// Test with the core the file declares, as runConfig does; a file
+	// without coreType is tested with the current core type
 	u.mu.RLock()
 	coreType := u.coreType
 	u.mu.RUnlock()
+	if coreTypeStr, ok := config["coreType"].(string); ok {
+		if coreType, err = ParseCoreType(coreTypeStr); err != nil {
+			return fmt.Errorf("invalid coreType in config: %s - %w", coreTypeStr, err)
+		}
+	}
+
+	u.mu.RLock()
+	err = u.checkAllowedProtocolsLocked(coreType, config)
+	u.mu.RUnlock()
+	if err != nil {
+		return err
+	}
 
 	switch coreType {
 	case CoreTypeV2Ray, CoreTypeXray:
@@ -346,7 +554,13 @@ func (u *UnifiedCoreManager) TestConfig(configPath string) error {
 	}
 }
 
+// Restart stops the core and starts it again with the current config. It is
+// coalesced with ApplyConfig, see there.
 func (u *UnifiedCoreManager) Restart() error {
+	return u.applies.submit(u.restart)
+}
+
+func (u *UnifiedCoreManager) restart() error {
 	u.mu.RLock()
 	configPath := u.configPath
 	u.mu.RUnlock()
@@ -355,9 +569,23 @@ func (u *UnifiedCoreManager) Restart() error {
 		return fmt.Errorf("no configuration path set")
 	}
 
+	resume := u.suspendKillSwitch()
+	defer resume()
+
+	u.mu.RLock()
+	mihomoManager := u.mihomoManager
+	u.mu.RUnlock()
+	var selections map[string]string
+	if mihomoManager != nil {
+		selections = mihomoManager.selectionsForRestart()
+	}
+
 	if err := u.Stop(); err != nil {
 		return fmt.Errorf("failed to stop core for restart: %w", err)
 	}
+	if mihomoManager != nil {
+		mihomoManager.restoreSelectionsOnStart(selections)
+	}
 
 	time.Sleep(100 * time.Millisecond)
 
@@ -389,18 +617,50 @@ func (u *UnifiedCoreManager) SwitchCoreType(newCoreType CoreType) error {
 	return nil
 }
 
+// CoreStats is the typed form of GetStats for Go callers.
+type CoreStats struct {
+	CoreType     string
+	CoreName     string
+	Running      bool
+	SOCKSPort    int
+	APIPort      int
+	ConfigPath   string
+	ConfigFormat string
+}
+
+// GetStatsTyped returns the fields of GetStats common to both cores.
+func (u *UnifiedCoreManager) GetStatsTyped() CoreStats {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.statsLocked()
+}
+
+// statsLocked is GetStatsTyped for callers holding u.mu.
+func (u *UnifiedCoreManager) statsLocked() CoreStats {
+	return CoreStats{
+		CoreType:     u.coreType.String(),
+		CoreName:     u.coreType.DisplayName(),
+		Running:      u.running,
+		SOCKSPort:    u.socksPort,
+		APIPort:      u.apiPort,
+		ConfigPath:   u.configPath,
+		ConfigFormat: u.configFormat,
+	}
+}
+
 func (u *UnifiedCoreManager) GetStats() map[string]interface{} {
 	u.mu.RLock()
 	defer u.mu.RUnlock()
 
+	typed := u.statsLocked()
 	stats := map[string]interface{}{
-		"core_type":     u.coreType.String(),
-		"core_name":     u.coreType.DisplayName(),
-		"running":       u.running,
-		"socks_port":    u.socksPort,
-		"api_port":      u.apiPort,
-		"config_path":   u.configPath,
-		"config_format": u.configFormat,
+		"core_type":     typed.CoreType,
+		"core_name":     typed.CoreName,
+		"running":       typed.Running,
+		"socks_port":    typed.SOCKSPort,
+		"api_port":      typed.APIPort,
+		"config_path":   typed.ConfigPath,
+		"config_format": typed.ConfigFormat,
 	}
 
 	switch u.coreType {
@@ -411,66 +671,141 @@ func (u *UnifiedCoreManager) GetStats() map[string]interface{} {
 	case CoreTypeMihomo:
 		if u.mihomoManager != nil {
 			stats["mihomo_running"] = u.mihomoManager.IsRunning()
+			if mode, err := u.mihomoManager.GetMode(); err == nil {
+				stats["mode"] = mode
+			}
 		}
 	}
 
 	return stats
 }
 
+// GetMode returns the routing mode of the running Mihomo core. Xray has no
+// modes.
+func (u *UnifiedCoreManager) GetMode() (string, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	if u.coreType != CoreTypeMihomo {
+		return "", fmt.Errorf("%s has no routing mode", u.coreType.DisplayName())
+	}
+	if !u.running || u.mihomoManager == nil {
+		return "", fmt.Errorf("no core running")
+	}
+	return u.mihomoManager.GetMode()
+}
+
+// SetMode switches the routing mode of the running Mihomo core, see
+// MihomoCoreManager.SetMode. Xray has no modes.
+func (u *UnifiedCoreManager) SetMode(mode string) error {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	if u.coreType != CoreTypeMihomo {
+		return fmt.Errorf("%s has no routing mode", u.coreType.DisplayName())
+	}
+	if !u.running || u.mihomoManager == nil {
+		return fmt.Errorf("no core running")
+	}
+	return u.mihomoManager.SetMode(mode)
+}
+
 func (u *UnifiedCoreManager) startV2RayCore(configPath string) error {
 	if globalV2RayManager == nil {
 		globalV2RayManager = NewV2RayCoreManager(u.socksPort, u.apiPort)
 	} else {
 		// Update ports for this test
-		globalV2RayManager.socksPort = u.socksPort
-		globalV2RayManager.apiPort = u.apiPort
+		globalV2RayManager.setPorts(u.socksPort, u.apiPort)
+	}
+	if u.scopedHomeDir {
+		globalV2RayManager.SetHomeDirForManager(u.assetPath)
+	} else {
+		globalV2RayManager.SetAssetPath(u.assetPath)
 	}
-	globalV2RayManager.SetAssetPath(u.assetPath)
 	globalV2RayManager.SetLogLevel(u.logLevel)
-	
+	globalV2RayManager.setSharedPatches(u.v2rayPatches.clone())
+
 	u.v2rayManager = globalV2RayManager
 	return u.v2rayManager.RunConfig(configPath)
 }
 
 func (u *UnifiedCoreManager) stopV2RayCore() error {
-	if u.v2rayManager != nil {
-		return u.v2rayManager.Stop()
+	if u.v2rayManager == nil {
+		return nil
 	}
-	return nil
+	stopped, err := stopWithin(u.v2rayManager.Stop, stopTimeout)
+	if !stopped {
+		u.abandonV2RayLocked()
+		return fmt.Errorf("core did not stop within %v, abandoned it", stopTimeout)
+	}
+	return err
 }
 
 func (u *UnifiedCoreManager) testV2RayConfig(configPath string) error {
 	if globalV2RayManager == nil {
 		globalV2RayManager = NewV2RayCoreManager(u.socksPort, u.apiPort)
 	}
+	u.mu.RLock()
+	globalV2RayManager.setSharedPatches(u.v2rayPatches.clone())
+	u.mu.RUnlock()
 	return globalV2RayManager.TestConfig(configPath)
 }
 
+// mihomoStartTimeout bounds how long RunConfig waits for Mihomo to report
+// whether the config was applied.
+const mihomoStartTimeout = 5 * time.Second
+
 func (u *UnifiedCoreManager) startMihomoCore(configPath string) error {
 	if globalMihomoManager == nil {
 		globalMihomoManager = NewMihomoCoreManager(u.socksPort, u.apiPort)
 	} else {
 		// Update ports for this test
-		globalMihomoManager.socksPort = u.socksPort
-		globalMihomoManager.apiPort = u.apiPort
+		globalMihomoManager.setPorts(u.socksPort, u.apiPort)
 	}
 	globalMihomoManager.SetAssetPath(u.assetPath)
 	globalMihomoManager.SetLogLevel(u.logLevel)
-	
+	// Set on every start, so a cache left in an earlier run's ephemeral
+	// dir is moved back
+	if err := globalMihomoManager.SetCacheDir(firstNonEmpty(u.ephemeralDir, u.cacheDir)); err != nil {
+		return err
+	}
+	globalMihomoManager.SetConnectTimeout(u.connectTimeout)
+	globalMihomoManager.setForwardingPaused(u.warmStart)
+	globalMihomoManager.setSharedPatches(u.mihomoPatches.clone())
+	globalMihomoManager.setAllowedProtocols(u.allowedProtocols)
+
 	u.mihomoManager = globalMihomoManager
-	return u.mihomoManager.RunConfig(configPath)
+	if err := u.mihomoManager.RunConfig(configPath); err != nil {
+		return err
+	}
+	// Mihomo parses and applies the config on its own goroutine; report a
+	// bad config here instead of a start that silently did nothing
+	if err := u.mihomoManager.waitStarted(mihomoStartTimeout); err != nil {
+		u.mihomoManager.Stop()
+		return err
+	}
+	return nil
 }
 
 func (u *UnifiedCoreManager) stopMihomoCore() error {
-	if u.mihomoManager != nil {
-		return u.mihomoManager.Stop()
+	if u.mihomoManager == nil {
+		return nil
 	}
-	return nil
+	stopped, err := stopWithin(u.mihomoManager.Stop, stopTimeout)
+	if !stopped {
+		u.abandonMihomoLocked()
+		return fmt.Errorf("core did not stop within %v, abandoned it", stopTimeout)
+	}
+	return err
 }
 
 func (u *UnifiedCoreManager) testMihomoConfig(configPath string) error {
 	if globalMihomoManager == nil {
 		globalMihomoManager = NewMihomoCoreManager(u.socksPort, u.apiPort)
 	}
+	u.mu.RLock()
+	globalMihomoManager.setSharedPatches(u.mihomoPatches.clone())
+	globalMihomoManager.setAllowedProtocols(u.allowedProtocols)
+	u.mu.RUnlock()
 	return globalMihomoManager.TestConfig(configPath)
 }
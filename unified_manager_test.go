@@ -0,0 +1,45 @@
+package libunifiedcore
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRestartAfterChdir(t *testing.T) {
+	dir := t.TempDir()
+	writeXrayConfig(t, dir, "config.json", freePort(t))
+
+	t.Chdir(dir)
+	u := NewUnifiedCoreManager()
+	if err := u.RunConfig("config.json"); err != nil {
+		t.Fatalf("RunConfig: %v", err)
+	}
+	t.Cleanup(func() { u.Stop() })
+
+	// The relative path no longer resolves from here
+	t.Chdir(t.TempDir())
+	if err := u.Restart(); err != nil {
+		t.Fatalf("Restart after changing the working directory: %v", err)
+	}
+	if !u.IsRunning() {
+		t.Fatal("core not running after Restart")
+	}
+
+	u.mu.RLock()
+	configPath := u.configPath
+	u.mu.RUnlock()
+	if !filepath.IsAbs(configPath) {
+		t.Fatalf("stored config path %q is not absolute", configPath)
+	}
+	got, err := filepath.EvalSymlinks(configPath)
+	if err != nil {
+		t.Fatalf("stored config path %q: %v", configPath, err)
+	}
+	want, err := filepath.EvalSymlinks(filepath.Join(dir, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("stored config path %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,550 @@
+package libunifiedcore
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SetTCPOptions tunes TCP keepalive and fast-open on the outbounds of both
+// cores. keepaliveSec of 0 keeps each core's default interval; fastOpen
+// false leaves the fast-open setting of the config as it is. Takes effect
+// on the next start.
+//
+// Xray: streamSettings.sockopt.tcpKeepAliveInterval / tcpFastOpen per outbound.
+// Mihomo: global keep-alive-interval and per-proxy tfo.
+func (u *UnifiedCoreManager) SetTCPOptions(keepaliveSec int, fastOpen bool) error {
+	if keepaliveSec < 0 {
+		return fmt.Errorf("invalid keepalive interval: %d", keepaliveSec)
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if keepaliveSec == 0 && !fastOpen {
+		u.v2rayPatches.set("tcp-options", nil)
+		u.mihomoPatches.set("tcp-options", nil)
+		log.Printf("TCP options removed")
+		return nil
+	}
+
+	u.v2rayPatches.set("tcp-options", func(config map[string]interface{}) error {
+		for _, outbound := range xrayOutbounds(config) {
+			if protocol, _ := outbound["protocol"].(string); protocol == "blackhole" || protocol == "dns" {
+				continue
+			}
+			sockopt := configSection(configSection(outbound, "streamSettings"), "sockopt")
+			if keepaliveSec > 0 {
+				sockopt["tcpKeepAliveInterval"] = keepaliveSec
+			}
+			if fastOpen {
+				sockopt["tcpFastOpen"] = true
+			}
+		}
+		return nil
+	})
+
+	u.mihomoPatches.set("tcp-options", func(config map[string]interface{}) error {
+		if keepaliveSec > 0 {
+			config["keep-alive-interval"] = keepaliveSec
+		}
+		if fastOpen {
+			for _, proxy := range mihomoProxies(config) {
+				proxy["tfo"] = true
+			}
+		}
+		return nil
+	})
+
+	log.Printf("TCP options set - keepalive: %ds, fast open: %v", keepaliveSec, fastOpen)
+	return nil
+}
+
+// bandwidthProxyTypes are the Mihomo proxy types whose congestion control
+// needs up/down bandwidth hints. TUIC uses its own congestion controller and
+// takes no bandwidth settings.
+var bandwidthProxyTypes = map[string]bool{
+	"hysteria":  true,
+	"hysteria2": true,
+}
+
+// SetBandwidth sets the up/down bandwidth hints (in Mbps) injected into
+// Hysteria/Hysteria2 proxies before start, overriding values from the
+// config. Only Mihomo is affected; the linked Xray build has no outbound
+// that takes bandwidth hints.
+func (u *UnifiedCoreManager) SetBandwidth(upMbps, downMbps int) error {
+	if upMbps <= 0 || downMbps <= 0 {
+		return fmt.Errorf("invalid bandwidth: up=%d down=%d, both must be positive", upMbps, downMbps)
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.mihomoPatches.set("bandwidth", func(config map[string]interface{}) error {
+		for _, proxy := range mihomoProxies(config) {
+			proxyType, _ := proxy["type"].(string)
+			if !bandwidthProxyTypes[proxyType] {
+				continue
+			}
+			proxy["up"] = fmt.Sprintf("%d Mbps", upMbps)
+			proxy["down"] = fmt.Sprintf("%d Mbps", downMbps)
+		}
+		return nil
+	})
+
+	log.Printf("Bandwidth set - up: %d Mbps, down: %d Mbps", upMbps, downMbps)
+	return nil
+}
+
+// SetOutboundInterface binds the outbound connections of both cores to the
+// named network interface, for multi-homed hosts where the tunnel must leave
+// through a specific NIC. An empty name removes the binding. Takes effect on
+// the next start.
+//
+// Xray: streamSettings.sockopt.interface per outbound (Linux and Android).
+// Mihomo: global interface-name.
+func (u *UnifiedCoreManager) SetOutboundInterface(name string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if name == "" {
+		u.v2rayPatches.set("outbound-interface", nil)
+		u.mihomoPatches.set("outbound-interface", nil)
+		log.Println("Outbound interface binding removed")
+		return nil
+	}
+
+	if _, err := net.InterfaceByName(name); err != nil {
+		return fmt.Errorf("network interface %s not found: %w", name, err)
+	}
+
+	u.v2rayPatches.set("outbound-interface", func(config map[string]interface{}) error {
+		for _, outbound := range xrayOutbounds(config) {
+			if protocol, _ := outbound["protocol"].(string); protocol == "blackhole" || protocol == "dns" {
+				continue
+			}
+			configSection(configSection(outbound, "streamSettings"), "sockopt")["interface"] = name
+		}
+		return nil
+	})
+
+	u.mihomoPatches.set("outbound-interface", func(config map[string]interface{}) error {
+		config["interface-name"] = name
+		return nil
+	})
+
+	log.Printf("Outbound interface set to %s", name)
+	return nil
+}
+
+// SetCacheDir sets where Mihomo keeps its cache.db (stored selections and
+// fake-ip mappings), separate from the asset directory. See
+// MihomoCoreManager.SetCacheDir; takes effect on the next start.
+func (u *UnifiedCoreManager) SetCacheDir(dir string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.cacheDir = dir
+	log.Printf("Mihomo cache directory set to: %s", dir)
+}
+
+// SetConnectTimeout bounds how long outbounds may take to establish a
+// connection, so a bad network fails fast instead of hanging the app. Takes
+// effect on the next start; 0 restores the core defaults.
+//
+// Xray has no dial timeout setting; the timeout is set as
+// sockopt.tcpUserTimeout on every outbound, which bounds the TCP handshake
+// (and later unacknowledged data) on Linux and Android only. Mihomo: dials
+// are cancelled after d, see MihomoCoreManager.SetConnectTimeout; Mihomo
+// itself gives up after 5s, so longer values have no effect.
+func (u *UnifiedCoreManager) SetConnectTimeout(d time.Duration) error {
+	if d < 0 {
+		return fmt.Errorf("invalid connect timeout: %v", d)
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.connectTimeout = d
+	if d == 0 {
+		u.v2rayPatches.set("connect-timeout", nil)
+		log.Println("Connect timeout removed")
+		return nil
+	}
+	u.v2rayPatches.set("connect-timeout", func(config map[string]interface{}) error {
+		for _, outbound := range xrayOutbounds(config) {
+			if protocol, _ := outbound["protocol"].(string); protocol == "blackhole" || protocol == "dns" {
+				continue
+			}
+			sockopt := configSection(configSection(outbound, "streamSettings"), "sockopt")
+			sockopt["tcpUserTimeout"] = d.Milliseconds()
+		}
+		return nil
+	})
+	log.Printf("Connect timeout set to %v", d)
+	return nil
+}
+
+// inboundNetworksBlockTag is the blackhole outbound SetInboundNetworks adds
+// to Xray configs for a disallowed network.
+const inboundNetworksBlockTag = "inbound-networks-block"
+
+// SetInboundNetworks limits the SOCKS/mixed/HTTP inbounds to "tcp", "udp" or
+// both. Other inbounds, such as tun, are not affected. Takes effect on the
+// next start; an empty list or both networks remove the limit.
+//
+// Xray: UDP is turned off with the socks inbound's udp setting; TCP through
+// these inbounds is routed to a blackhole outbound. SOCKS5 UDP still needs
+// its TCP control connection, which is not routed and keeps working.
+// Mihomo: matching connections are rejected by an IN-TYPE rule put in front
+// of the config's rules.
+func (u *UnifiedCoreManager) SetInboundNetworks(networks []string) error {
+	allowTCP, allowUDP := len(networks) == 0, len(networks) == 0
+	for _, network := range networks {
+		switch strings.ToLower(strings.TrimSpace(network)) {
+		case "tcp":
+			allowTCP = true
+		case "udp":
+			allowUDP = true
+		default:
+			return fmt.Errorf("invalid network %q, expected tcp or udp", network)
+		}
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if allowTCP && allowUDP {
+		u.v2rayPatches.set("inbound-networks", nil)
+		u.mihomoPatches.set("inbound-networks", nil)
+		log.Println("Inbound network limit removed")
+		return nil
+	}
+
+	blocked := "udp"
+	if !allowTCP {
+		blocked = "tcp"
+	}
+
+	u.v2rayPatches.set("inbound-networks", func(config map[string]interface{}) error {
+		var tags []interface{}
+		for i, inbound := range configMaps(config, "inbounds") {
+			protocol, _ := inbound["protocol"].(string)
+			if protocol != "socks" && protocol != "http" && protocol != "mixed" {
+				continue
+			}
+			if protocol == "socks" {
+				configSection(inbound, "settings")["udp"] = allowUDP
+			}
+			tag, _ := inbound["tag"].(string)
+			if tag == "" {
+				tag = fmt.Sprintf("%s-in-%d", protocol, i)
+				inbound["tag"] = tag
+			}
+			tags = append(tags, tag)
+		}
+		if !allowTCP && len(tags) > 0 {
+			outbounds, _ := config["outbounds"].([]interface{})
+			config["outbounds"] = append(outbounds, map[string]interface{}{
+				"protocol": "blackhole",
+				"tag":      inboundNetworksBlockTag,
+			})
+			routing := configSection(config, "routing")
+			rules, _ := routing["rules"].([]interface{})
+			routing["rules"] = append([]interface{}{map[string]interface{}{
+				"type":        "field",
+				"network":     "tcp",
+				"inboundTag":  tags,
+				"outboundTag": inboundNetworksBlockTag,
+			}}, rules...)
+		}
+		return nil
+	})
+
+	u.mihomoPatches.set("inbound-networks", func(config map[string]interface{}) error {
+		rules, _ := config["rules"].([]interface{})
+		rule := fmt.Sprintf("AND,((IN-TYPE,SOCKS4/SOCKS5/HTTP/HTTPS),(NETWORK,%s)),REJECT", strings.ToUpper(blocked))
+		config["rules"] = append([]interface{}{rule}, rules...)
+		return nil
+	})
+
+	log.Printf("Inbound networks limited, %s blocked", blocked)
+	return nil
+}
+
+// SetTunFD hands the tun device's file descriptor from the platform VPN
+// service (Android VpnService, iOS packet tunnel) to Mihomo as
+// tun.file-descriptor on the next start. A config that enables tun without
+// an fd is rejected on mobile platforms. fd <= 0 removes it.
+func (u *UnifiedCoreManager) SetTunFD(fd int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if fd <= 0 {
+		u.tunFD = 0
+		u.mihomoPatches.set("tun-fd", nil)
+		log.Println("Tun file descriptor cleared")
+		return
+	}
+
+	u.tunFD = fd
+	u.mihomoPatches.set("tun-fd", func(config map[string]interface{}) error {
+		tun, ok := config["tun"].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		tun["file-descriptor"] = fd
+		return nil
+	})
+	log.Printf("Tun file descriptor set to %d", fd)
+}
+
+// Tags SetRemoteDNS gives the Xray DNS module and its hijack outbound.
+const (
+	remoteDNSTag         = "remote-dns"
+	remoteDNSOutboundTag = "remote-dns-out"
+)
+
+// SetRemoteDNS makes the core resolve names through server over the proxy
+// instead of the local network, so lookups do not leak to the ISP. server
+// is an IP, optionally with port, or a tcp://, udp://, tls:// or https://
+// URL. Takes effect on the next start; an empty server removes it.
+//
+// Xray: the DNS module uses server only, its queries are routed to the first
+// proxy outbound, and DNS sent to port 53 through the inbounds is answered by
+// a dns outbound. tls:// is not supported by Xray. Mihomo: server becomes the
+// only nameserver and respect-rules sends its queries through the rules;
+// Mihomo then needs proxy-server-nameserver, which is set to server too when
+// the config has none.
+func (u *UnifiedCoreManager) SetRemoteDNS(server string) error {
+	server = strings.TrimSpace(server)
+	if server != "" {
+		if err := checkDNSServer(server); err != nil {
+			return fmt.Errorf("invalid DNS server %q: %w", server, err)
+		}
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if server == "" {
+		u.v2rayPatches.set("remote-dns", nil)
+		u.mihomoPatches.set("remote-dns", nil)
+		log.Println("Remote DNS removed")
+		return nil
+	}
+
+	u.v2rayPatches.set("remote-dns", func(config map[string]interface{}) error {
+		if strings.HasPrefix(server, "tls://") {
+			return fmt.Errorf("xray does not support DNS over TLS: %s", server)
+		}
+		var proxyTag string
+		for _, outbound := range xrayOutbounds(config) {
+			if protocol, _ := outbound["protocol"].(string); !builtinOutboundProtocols[protocol] {
+				proxyTag, _ = outbound["tag"].(string)
+				break
+			}
+		}
+		if proxyTag == "" {
+			return fmt.Errorf("remote DNS needs a tagged proxy outbound")
+		}
+
+		dns := configSection(config, "dns")
+		dns["servers"] = []interface{}{server}
+		dns["tag"] = remoteDNSTag
+
+		outbounds, _ := config["outbounds"].([]interface{})
+		config["outbounds"] = append(outbounds, map[string]interface{}{
+			"protocol": "dns",
+			"tag":      remoteDNSOutboundTag,
+		})
+		routing := configSection(config, "routing")
+		rules, _ := routing["rules"].([]interface{})
+		routing["rules"] = append([]interface{}{
+			map[string]interface{}{
+				"type":        "field",
+				"inboundTag":  []interface{}{remoteDNSTag},
+				"outboundTag": proxyTag,
+			},
+			map[string]interface{}{
+				"type":        "field",
+				"port":        "53",
+				"outboundTag": remoteDNSOutboundTag,
+			},
+		}, rules...)
+		return nil
+	})
+
+	u.mihomoPatches.set("remote-dns", func(config map[string]interface{}) error {
+		dns := configSection(config, "dns")
+		dns["enable"] = true
+		dns["nameserver"] = []interface{}{server}
+		dns["respect-rules"] = true
+		if servers, _ := dns["proxy-server-nameserver"].([]interface{}); len(servers) == 0 {
+			dns["proxy-server-nameserver"] = []interface{}{server}
+		}
+		return nil
+	})
+
+	log.Printf("Remote DNS set to %s", server)
+	return nil
+}
+
+// UpdateDNS replaces the dns section of the running Xray config, see
+// V2RayCoreManager.UpdateDNS. Xray cannot swap its DNS at runtime, so the
+// core goes through Restart: the restart is serialized with ApplyConfig and
+// the kill switch does not treat the gap as a crash. If the core does not
+// come back with the new section, the previous one is restored and the core
+// restarted with it. A nil or empty dnsConfig removes the replacement.
+func (u *UnifiedCoreManager) UpdateDNS(dnsConfig json.RawMessage) error {
+	patch, err := xrayDNSPatch(dnsConfig)
+	if err != nil {
+		return err
+	}
+
+	return u.applies.submit(func() error {
+		u.mu.RLock()
+		coreType, running, v2rayManager := u.coreType, u.running, u.v2rayManager
+		configPath := u.configPath
+		u.mu.RUnlock()
+
+		switch {
+		case coreType != CoreTypeV2Ray && coreType != CoreTypeXray:
+			return fmt.Errorf("DNS updates are only supported for Xray, current core is %s", coreType.DisplayName())
+		case v2rayManager == nil:
+			return fmt.Errorf("V2Ray core is not running")
+		}
+		previous := v2rayManager.swapDNSPatch(patch)
+		if !running {
+			return nil
+		}
+
+		resume := u.suspendKillSwitch()
+		defer resume()
+
+		if err := u.restart(); err != nil {
+			// A failed start has already cleared the config path
+			v2rayManager.swapDNSPatch(previous)
+			if rollbackErr := u.RunConfig(configPath); rollbackErr != nil {
+				return fmt.Errorf("failed to restart core with new DNS config: %v; restoring the previous DNS config failed too: %w", err, rollbackErr)
+			}
+			return fmt.Errorf("failed to restart core with new DNS config, previous DNS config restored: %w", err)
+		}
+		return nil
+	})
+}
+
+// checkDNSServer accepts an IP, an IP with port, or a URL with a DNS scheme
+// both cores understand.
+func checkDNSServer(server string) error {
+	if net.ParseIP(server) != nil {
+		return nil
+	}
+	if host, _, err := net.SplitHostPort(server); err == nil && net.ParseIP(host) != nil {
+		return nil
+	}
+	u, err := url.Parse(server)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "tcp", "udp", "tls", "https":
+	default:
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("missing host")
+	}
+	return nil
+}
+
+// dohBootstrapOutboundTag tags the Xray outbound SetDoHBootstrap dials the
+// resolver through.
+const dohBootstrapOutboundTag = "doh-bootstrap-out"
+
+// SetDoHBootstrap makes both cores resolve names with the DNS-over-HTTPS
+// resolver at resolverURL, pinning the resolver's hostname to bootstrapIP so
+// it is never looked up in plaintext, e.g. on a network that poisons DNS.
+// Like SetRemoteDNS it replaces the DNS servers of the config. Takes effect
+// on the next start; an empty resolverURL removes it.
+//
+// Xray: dns.servers, plus a freedom outbound redirected to bootstrapIP and a
+// routing rule sending the resolver's host to it. Xray dials DoH through its
+// router by hostname and never consults dns.hosts for it, so the redirect is
+// what keeps the lookup off the network; TLS still uses the hostname for SNI
+// and certificate checks. Mihomo: nameserver, and proxy-server-nameserver if
+// the config has none, plus a hosts entry, which Mihomo checks before asking
+// its default-nameserver.
+func (u *UnifiedCoreManager) SetDoHBootstrap(resolverURL, bootstrapIP string) error {
+	resolverURL = strings.TrimSpace(resolverURL)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if resolverURL == "" {
+		u.v2rayPatches.set("doh-bootstrap", nil)
+		u.mihomoPatches.set("doh-bootstrap", nil)
+		log.Println("DoH bootstrap removed")
+		return nil
+	}
+
+	parsed, err := url.Parse(resolverURL)
+	if err != nil || parsed.Scheme != "https" || parsed.Hostname() == "" {
+		return fmt.Errorf("invalid DoH resolver URL: %q", resolverURL)
+	}
+	host := parsed.Hostname()
+	if net.ParseIP(host) != nil {
+		return fmt.Errorf("DoH resolver %s is an IP address and needs no bootstrap", host)
+	}
+	ip := net.ParseIP(strings.TrimSpace(bootstrapIP))
+	if ip == nil {
+		return fmt.Errorf("invalid bootstrap IP: %q", bootstrapIP)
+	}
+	bootstrap := ip.String()
+
+	port := parsed.Port()
+	if port == "" {
+		port = "443"
+	}
+	u.v2rayPatches.set("doh-bootstrap", func(config map[string]interface{}) error {
+		dns := configSection(config, "dns")
+		dns["servers"] = []interface{}{resolverURL}
+
+		outbounds, _ := config["outbounds"].([]interface{})
+		config["outbounds"] = append(outbounds, map[string]interface{}{
+			"protocol": "freedom",
+			"tag":      dohBootstrapOutboundTag,
+			"settings": map[string]interface{}{
+				"redirect": net.JoinHostPort(bootstrap, port),
+			},
+		})
+		routing := configSection(config, "routing")
+		rules, _ := routing["rules"].([]interface{})
+		routing["rules"] = append([]interface{}{
+			map[string]interface{}{
+				"type":        "field",
+				"domain":      []interface{}{"full:" + host},
+				"port":        port,
+				"outboundTag": dohBootstrapOutboundTag,
+			},
+		}, rules...)
+		return nil
+	})
+
+	u.mihomoPatches.set("doh-bootstrap", func(config map[string]interface{}) error {
+		configSection(config, "hosts")[host] = bootstrap
+		dns := configSection(config, "dns")
+		dns["enable"] = true
+		dns["nameserver"] = []interface{}{resolverURL}
+		if servers, _ := dns["proxy-server-nameserver"].([]interface{}); len(servers) == 0 {
+			dns["proxy-server-nameserver"] = []interface{}{resolverURL}
+		}
+		return nil
+	})
+
+	log.Printf("DoH resolver set to %s via %s", resolverURL, bootstrap)
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"runtime"
 	"sync"
 	"time"
@@ -31,6 +32,27 @@ type V2RayCoreManager struct {
 	assetPath  string
 	logLevel   string
 	shouldOff  chan int
+
+	// Receives the outcome of a start in progress, see RunConfig
+	started chan error
+
+	// patches are set on this manager directly, sharedPatches are pushed
+	// down by the unified manager before each start.
+	patches       patchSet
+	sharedPatches patchSet
+
+	timings         startupTimings
+	lastInbounds    []string
+	lastOutbounds   []map[string]interface{} // see GetActiveTransportInfo
+	appliedLogLevel string                   // log.loglevel of the loaded config
+	socksInbound    xrayInboundRef
+	inboundPorts    []int // TCP ports of the started config's inbounds
+
+	// scopedHomeDir is set by SetHomeDirForManager, see home_dir.go
+	scopedHomeDir bool
+
+	// Temp dirs removed on Stop, see temp_dirs.go
+	tempDirs []string
 }
 
 func NewV2RayCoreManager(socksPort, apiPort int) *V2RayCoreManager {
@@ -46,6 +68,15 @@ func (v *V2RayCoreManager) SetAssetPath(assetPath string) {
 	v.mu.Lock()
 	defer v.mu.Unlock()
 	v.assetPath = assetPath
+	v.scopedHomeDir = false
+}
+
+// setPorts updates the ports reported by this manager.
+func (v *V2RayCoreManager) setPorts(socksPort, apiPort int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.socksPort = socksPort
+	v.apiPort = apiPort
 }
 
 func (v *V2RayCoreManager) SetLogLevel(logLevel string) {
@@ -61,67 +92,123 @@ func (v *V2RayCoreManager) RunConfig(configPath string) error {
 	if v.isRunning {
 		return fmt.Errorf("V2Ray core is already running")
 	}
+	if v.started != nil {
+		return fmt.Errorf("V2Ray core is already starting")
+	}
 
+	absPath, absErr := filepath.Abs(configPath)
+	if absErr != nil {
+		return fmt.Errorf("failed to resolve config path: %w", absErr)
+	}
+	configPath = absPath
 	v.configPath = configPath
+	v.timings = startupTimings{}
 
-	// Set environment variables
-	if v.assetPath != "" {
+	// Set environment variables, unless the home dir is scoped to this manager
+	if v.assetPath != "" && !v.scopedHomeDir {
 		os.Setenv("v2ray.location.asset", v.assetPath)
 		os.Setenv("xray.location.asset", v.assetPath)
 	}
 
 	// Create context for cancellation
 	v.ctx, v.cancel = context.WithCancel(context.Background())
+	ctx := v.ctx
+	started := make(chan error, 1)
+	v.started = started
 
-	// Start core in goroutine
-	go v.runConfigSync(configPath)
+	// Start core in goroutine; it needs v.mu until the instance is up
+	go v.runConfigSync(ctx, configPath, v.patchesLocked(), started)
+	v.mu.Unlock()
+	err := <-started
+	v.mu.Lock()
+	v.started = nil
 
-	// Wait a bit to ensure startup
-	time.Sleep(100 * time.Millisecond)
+	if err == nil && ctx.Err() != nil {
+		err = fmt.Errorf("V2Ray core was stopped while starting")
+	}
+	if err != nil {
+		if v.ctx == ctx {
+			v.cancel()
+		}
+		return err
+	}
 
 	v.isRunning = true
 	log.Printf("V2Ray core started successfully on SOCKS port %d, API port %d", v.socksPort, v.apiPort)
 	return nil
 }
 
-// runConfigSync runs the core synchronously (internal method)
-func (v *V2RayCoreManager) runConfigSync(configPath string) {
+// runConfigSync runs the core synchronously (internal method). The outcome
+// of starting the instance is sent on started.
+func (v *V2RayCoreManager) runConfigSync(ctx context.Context, configPath string, patches patchSet, started chan<- error) {
 	defer func() {
 		if r := recover(); r != nil {
 			log.Printf("V2Ray core panic recovered: %v", r)
+			select {
+			case started <- fmt.Errorf("V2Ray core panicked: %v", r):
+			default:
+			}
 		}
+		// A newer RunConfig may have started by now, leave its state alone
 		v.mu.Lock()
-		v.isRunning = false
+		if v.ctx == ctx {
+			v.isRunning = false
+		}
 		v.mu.Unlock()
 	}()
 
-	configBytes, err := v.readAndInjectConfig(configPath)
+	phaseStart := time.Now()
+
+	configBytes, err := v.readAndInjectConfig(configPath, patches)
 	if err != nil {
 		log.Printf("Failed to read/inject V2Ray config: %v", err)
+		started <- fmt.Errorf("failed to read V2Ray config: %w", err)
 		return
 	}
 
 	// Parse configuration
-	r := bytes.NewReader(configBytes)
-	config, err := serial.LoadJSONConfig(r)
+	var config *core.Config
+	v.loadWithAssetEnv(func() {
+		config, err = serial.LoadJSONConfig(bytes.NewReader(configBytes))
+	})
 	if err != nil {
 		log.Printf("Failed to parse V2Ray config: %v", err)
+		started <- fmt.Errorf("failed to parse V2Ray config: %w", err)
 		return
 	}
 
+	inbounds := describeXrayInbounds(configBytes)
+	outbounds := xrayConfigOutbounds(configBytes)
+	socksInbound := xraySOCKSInbound(configBytes)
+	inboundPorts := xrayInboundPorts(configBytes)
+	v.mu.Lock()
+	v.timings.Convert = time.Since(phaseStart)
+	v.lastInbounds = inbounds
+	v.lastOutbounds = outbounds
+	v.appliedLogLevel = xrayLogLevel(configBytes)
+	v.socksInbound = socksInbound
+	v.inboundPorts = inboundPorts
+	v.mu.Unlock()
+	phaseStart = time.Now()
+
 	// Check if already running
 	v.mu.RLock()
 	if v.instance != nil {
 		v.mu.RUnlock()
 		log.Println("V2Ray instance already exists")
+		started <- fmt.Errorf("V2Ray instance already exists")
 		return
 	}
 	v.mu.RUnlock()
 
 	// Create new instance
-	instance, err := core.New(config)
+	var instance *core.Instance
+	v.loadWithAssetEnv(func() {
+		instance, err = core.New(config)
+	})
 	if err != nil {
 		log.Printf("Failed to create V2Ray instance: %v", err)
+		started <- fmt.Errorf("failed to create V2Ray instance: %w", err)
 		return
 	}
 
@@ -136,10 +223,18 @@ func (v *V2RayCoreManager) runConfigSync(configPath string) {
 		v.mu.Lock()
 		v.instance = nil
 		v.mu.Unlock()
+		instance.Close()
+		started <- fmt.Errorf("failed to start V2Ray instance: %w", err)
 		return
 	}
 
+	v.mu.Lock()
+	v.timings.Apply = time.Since(phaseStart)
+	v.timings.Done = true
+	v.mu.Unlock()
+
 	log.Printf("V2Ray core started and listening with pre-injected config from Flutter")
+	started <- nil
 
 	// Explicitly trigger GC to remove garbage from config loading
 	runtime.GC()
@@ -148,17 +243,17 @@ func (v *V2RayCoreManager) runConfigSync(configPath string) {
 	select {
 	case <-v.shouldOff:
 		log.Println("V2Ray core received shutdown signal")
-	case <-v.ctx.Done():
+	case <-ctx.Done():
 		log.Println("V2Ray core context cancelled")
 	}
 
 	// Cleanup
+	// Stop closes the instance itself; only close it if it is still ours
 	v.mu.Lock()
-	if v.instance != nil {
+	if v.instance == instance {
 		v.instance.Close()
 		v.instance = nil
 	}
-	v.isRunning = false
 	v.mu.Unlock()
 
 	log.Println("V2Ray core stopped")
@@ -167,15 +262,19 @@ func (v *V2RayCoreManager) runConfigSync(configPath string) {
 func (v *V2RayCoreManager) Stop() error {
 	v.mu.Lock()
 	defer v.mu.Unlock()
+	defer v.removeTempDirsLocked()
 
-	if !v.isRunning {
+	// A start in progress is cancelled, RunConfig then reports it
+	if !v.isRunning && v.started == nil {
 		return nil
 	}
 
-	select {
-	case v.shouldOff <- 1:
-	default:
-		// Channel already has a signal or is closed
+	if v.isRunning {
+		select {
+		case v.shouldOff <- 1:
+		default:
+			// Channel already has a signal or is closed
+		}
 	}
 
 	// Cancel context
@@ -201,14 +300,19 @@ func (v *V2RayCoreManager) IsRunning() bool {
 }
 
 func (v *V2RayCoreManager) TestConfig(configPath string) error {
+	v.mu.RLock()
+	patches := v.patchesLocked()
+	v.mu.RUnlock()
+
 	// Read and inject configuration
-	configBytes, err := v.readAndInjectConfig(configPath)
+	configBytes, err := v.readAndInjectConfig(configPath, patches)
 	if err != nil {
 		return fmt.Errorf("failed to read/inject config: %w", err)
 	}
 
-	r := bytes.NewReader(configBytes)
-	_, err = serial.LoadJSONConfig(r)
+	v.loadWithAssetEnv(func() {
+		_, err = serial.LoadJSONConfig(bytes.NewReader(configBytes))
+	})
 	if err != nil {
 		return fmt.Errorf("invalid V2Ray configuration: %w", err)
 	}
@@ -217,7 +321,55 @@ func (v *V2RayCoreManager) TestConfig(configPath string) error {
 	return nil
 }
 
-func (v *V2RayCoreManager) readAndInjectConfig(configPath string) ([]byte, error) {
+func (v *V2RayCoreManager) startupTimings() startupTimings {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.timings
+}
+
+// describeXrayInbounds lists the inbounds of a config as "tag protocol listen:port".
+func describeXrayInbounds(configBytes []byte) []string {
+	var config struct {
+		Inbounds []struct {
+			Tag      string      `json:"tag"`
+			Protocol string      `json:"protocol"`
+			Listen   string      `json:"listen"`
+			Port     interface{} `json:"port"`
+		} `json:"inbounds"`
+	}
+	if err := json.Unmarshal(configBytes, &config); err != nil {
+		return nil
+	}
+
+	inbounds := make([]string, 0, len(config.Inbounds))
+	for _, in := range config.Inbounds {
+		listen := in.Listen
+		if listen == "" {
+			listen = "0.0.0.0"
+		}
+		inbounds = append(inbounds, fmt.Sprintf("%s %s %s:%v", in.Tag, in.Protocol, listen, in.Port))
+	}
+	return inbounds
+}
+
+// setSharedPatches replaces the patches owned by the unified manager.
+func (v *V2RayCoreManager) setSharedPatches(patches patchSet) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.sharedPatches = patches
+}
+
+// patchesLocked returns shared patches followed by manager patches.
+// Callers must hold v.mu.
+func (v *V2RayCoreManager) patchesLocked() patchSet {
+	all := v.sharedPatches.clone()
+	for _, name := range v.patches.names {
+		all.set(name, v.patches.patches[name])
+	}
+	return all
+}
+
+func (v *V2RayCoreManager) readAndInjectConfig(configPath string, patches patchSet) ([]byte, error) {
 
 	configBytes, err := v.readFileAsBytes(configPath)
 	if err != nil {
@@ -244,7 +396,14 @@ func (v *V2RayCoreManager) readAndInjectConfig(configPath string) ([]byte, error
 		return nil, fmt.Errorf("failed to parse config JSON: %w", err)
 	}
 
-	// Use config as-is since Flutter ConfigInjectorUnified already injected everything
+	stripInjectedFields(config)
+
+	// Flutter ConfigInjectorUnified already injected everything, only apply
+	// the options configured on the managers
+	if err := patches.apply(config); err != nil {
+		return nil, err
+	}
+
 	finalConfigBytes, err := json.Marshal(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal config: %w", err)
@@ -0,0 +1,136 @@
+package libunifiedcore
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// freePort returns a local TCP port that is free right now.
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	port, err := freeTCPPort()
+	if err != nil {
+		t.Fatalf("free port: %v", err)
+	}
+	return port
+}
+
+// writeXrayConfig writes an injected Xray config with a socks inbound on
+// socksPort and a freedom outbound to dir/name and returns its path.
+func writeXrayConfig(t *testing.T, dir, name string, socksPort int) string {
+	t.Helper()
+
+	config := map[string]interface{}{
+		"coreType":   "xray",
+		"mixed-port": socksPort,
+		"log":        map[string]interface{}{"loglevel": "warning"},
+		"inbounds": []interface{}{
+			map[string]interface{}{
+				"tag":      "socks",
+				"protocol": "socks",
+				"listen":   "127.0.0.1",
+				"port":     socksPort,
+				"settings": map[string]interface{}{"udp": false},
+			},
+		},
+		"outbounds": []interface{}{
+			map[string]interface{}{"tag": "direct", "protocol": "freedom"},
+		},
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatalf("marshal config: %v", err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+// hammer calls fn from several goroutines until the returned func is called.
+func hammer(fn func()) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				fn()
+			}
+		}()
+	}
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// Run with -race: GetStats must not race with the instance being replaced.
+func TestV2RayGetStatsDuringStopAndRunConfig(t *testing.T) {
+	port := freePort(t)
+	path := writeXrayConfig(t, t.TempDir(), "config.json", port)
+
+	v := NewV2RayCoreManager(port, 0)
+	if err := v.RunConfig(path); err != nil {
+		t.Fatalf("RunConfig: %v", err)
+	}
+	t.Cleanup(func() { v.Stop() })
+
+	stop := hammer(func() {
+		stats := v.GetStats()
+		if stats["core_type"] != "v2ray" {
+			t.Errorf("GetStats core_type = %v", stats["core_type"])
+		}
+		v.IsRunning()
+	})
+	defer stop()
+
+	for i := 0; i < 10; i++ {
+		if err := v.Stop(); err != nil {
+			t.Fatalf("cycle %d: Stop: %v", i, err)
+		}
+		if err := v.RunConfig(path); err != nil {
+			t.Fatalf("cycle %d: RunConfig: %v", i, err)
+		}
+	}
+}
+
+// Run with -race: the unified manager's stats must not race with the core
+// being stopped and started.
+func TestUnifiedGetStatsDuringStopAndRunConfig(t *testing.T) {
+	port := freePort(t)
+	path := writeXrayConfig(t, t.TempDir(), "config.json", port)
+
+	u := NewUnifiedCoreManager()
+	if err := u.RunConfig(path); err != nil {
+		t.Fatalf("RunConfig: %v", err)
+	}
+	t.Cleanup(func() { u.Stop() })
+
+	stop := hammer(func() {
+		u.GetStats()
+		u.GetStatsTyped()
+		u.IsRunning()
+	})
+	defer stop()
+
+	for i := 0; i < 10; i++ {
+		if err := u.Stop(); err != nil {
+			t.Fatalf("cycle %d: Stop: %v", i, err)
+		}
+		if err := u.RunConfig(path); err != nil {
+			t.Fatalf("cycle %d: RunConfig: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package libunifiedcore
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/xtls/xray-core/infra/conf"
+)
+
+// transportParamNetworks lists, per transport override key, the stream
+// networks it applies to and the settings object it is written to.
+var transportParamNetworks = map[string]map[string]string{
+	"serviceName": {"grpc": "grpcSettings"},
+	"authority":   {"grpc": "grpcSettings"},
+	"path": {
+		"ws": "wsSettings", "httpupgrade": "httpupgradeSettings", "xhttp": "xhttpSettings",
+		"splithttp": "splithttpSettings", "http": "httpSettings", "h2": "httpSettings",
+	},
+	"host": {
+		"ws": "wsSettings", "httpupgrade": "httpupgradeSettings", "xhttp": "xhttpSettings",
+		"splithttp": "splithttpSettings", "http": "httpSettings", "h2": "httpSettings",
+	},
+	"headers": {
+		"ws": "wsSettings", "httpupgrade": "httpupgradeSettings", "xhttp": "xhttpSettings",
+		"splithttp": "splithttpSettings",
+	},
+}
+
+// SetTransportParams overrides transport settings of every outbound using a
+// matching transport on the next start, so a server that moved its path or
+// service name can be fixed without re-importing. Keys: serviceName and
+// authority (grpc), path and host (ws, httpupgrade, xhttp, http), and
+// headers.<Name> (ws, httpupgrade, xhttp). Outbounds on other transports are
+// left alone. An empty map removes the overrides.
+func (v *V2RayCoreManager) SetTransportParams(params map[string]string) error {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		name := key
+		if strings.HasPrefix(key, "headers.") {
+			if strings.TrimPrefix(key, "headers.") == "" {
+				return fmt.Errorf("invalid transport param %q: missing header name", key)
+			}
+			name = "headers"
+		}
+		if _, known := transportParamNetworks[name]; !known {
+			return fmt.Errorf("unknown transport param %q", key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if len(params) == 0 {
+		v.patches.set("transport-params", nil)
+		log.Println("Transport param overrides removed")
+		return nil
+	}
+
+	overrides := make(map[string]string, len(params))
+	for key, value := range params {
+		overrides[key] = value
+	}
+
+	v.patches.set("transport-params", func(config map[string]interface{}) error {
+		for _, outbound := range xrayOutbounds(config) {
+			stream, ok := outbound["streamSettings"].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			network, _ := stream["network"].(string)
+			for _, key := range keys {
+				applyTransportParam(stream, network, key, overrides[key])
+			}
+		}
+		return nil
+	})
+
+	log.Printf("Transport param overrides set: %v", keys)
+	return nil
+}
+
+func applyTransportParam(stream map[string]interface{}, network, key, value string) {
+	name := key
+	if strings.HasPrefix(key, "headers.") {
+		name = "headers"
+	}
+	settingsKey, applies := transportParamNetworks[name][network]
+	if !applies {
+		return
+	}
+	settings := configSection(stream, settingsKey)
+
+	switch {
+	case name == "headers":
+		configSection(settings, "headers")[strings.TrimPrefix(key, "headers.")] = value
+	case name == "host" && settingsKey == "httpSettings":
+		// HTTP/2 takes a list of hosts
+		settings["host"] = strings.Split(value, ",")
+	default:
+		settings[key] = value
+	}
+}
+
+// UpdateDNS replaces the dns section of the config with dnsConfig and
+// applies it to the running instance. Xray builds its DNS client into the
+// router and outbounds when the instance is created and has no feature
+// reload for it, so the section cannot be hot-swapped: the instance is
+// restarted with the same config file and open connections are dropped. If
+// it does not come back, the previous section is restored and the instance
+// restarted with it. The replacement is kept for later starts. A nil or empty
+// dnsConfig removes it.
+//
+// A core started by UnifiedCoreManager should be updated through its
+// UpdateDNS, which restarts through the manager.
+func (v *V2RayCoreManager) UpdateDNS(dnsConfig json.RawMessage) error {
+	patch, err := xrayDNSPatch(dnsConfig)
+	if err != nil {
+		return err
+	}
+	previous := v.swapDNSPatch(patch)
+
+	v.mu.RLock()
+	running, configPath := v.isRunning, v.configPath
+	v.mu.RUnlock()
+	if !running {
+		return nil
+	}
+
+	restart := func() error {
+		if err := v.Stop(); err != nil {
+			return fmt.Errorf("failed to stop core for DNS update: %w", err)
+		}
+		return v.RunConfig(configPath)
+	}
+	if err := restart(); err != nil {
+		v.swapDNSPatch(previous)
+		if rollbackErr := restart(); rollbackErr != nil {
+			return fmt.Errorf("failed to restart core with new DNS config: %v; restoring the previous DNS config failed too: %w", err, rollbackErr)
+		}
+		return fmt.Errorf("failed to restart core with new DNS config, previous DNS config restored: %w", err)
+	}
+	return nil
+}
+
+// xrayDNSPatch returns the patch that makes dnsConfig the dns section, after
+// checking that Xray accepts it. An empty dnsConfig gives a nil patch.
+func xrayDNSPatch(dnsConfig json.RawMessage) (configPatch, error) {
+	if len(dnsConfig) == 0 {
+		return nil, nil
+	}
+
+	var parsed conf.DNSConfig
+	if err := json.Unmarshal(dnsConfig, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse DNS config: %w", err)
+	}
+	if _, err := parsed.Build(); err != nil {
+		return nil, fmt.Errorf("invalid DNS config: %w", err)
+	}
+
+	return func(config map[string]interface{}) error {
+		// Each start gets its own copy, patches may modify the section
+		var dns map[string]interface{}
+		if err := json.Unmarshal(dnsConfig, &dns); err != nil {
+			return err
+		}
+		config["dns"] = dns
+		return nil
+	}, nil
+}
+
+// swapDNSPatch sets the dns override used from the next start and returns
+// the one it replaces, nil if there was none.
+func (v *V2RayCoreManager) swapDNSPatch(patch configPatch) configPatch {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	previous := v.patches.patches["dns"]
+	v.patches.set("dns", patch)
+	if patch == nil {
+		log.Println("DNS override removed")
+	} else {
+		log.Println("DNS config replaced")
+	}
+	return previous
+}
+
+// SetSkipCertVerify sets allowInsecure in the TLS settings of the outbound
+// tagged proxyName on the next start, for servers with self-signed
+// certificates. When a config was already run, the outbound is checked
+// against it right away; otherwise a missing outbound fails the start.
+// Skipping verification makes the connection open to interception, so a
+// warning is logged whenever it is enabled.
+func (v *V2RayCoreManager) SetSkipCertVerify(proxyName string, skip bool) error {
+	if proxyName == "" {
+		return fmt.Errorf("proxy name is required")
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.configPath != "" {
+		configBytes, err := os.ReadFile(v.configPath)
+		if err != nil {
+			return fmt.Errorf("failed to read config file: %w", err)
+		}
+		var config map[string]interface{}
+		if err := json.Unmarshal(configBytes, &config); err != nil {
+			return fmt.Errorf("failed to parse config: %w", err)
+		}
+		if _, err := xrayTLSSettings(unwrapCoreConfig(config), proxyName); err != nil {
+			return err
+		}
+	}
+
+	v.patches.set("skip-cert-verify:"+proxyName, func(config map[string]interface{}) error {
+		tls, err := xrayTLSSettings(config, proxyName)
+		if err != nil {
+			return err
+		}
+		tls["allowInsecure"] = skip
+		return nil
+	})
+
+	if skip {
+		log.Printf("WARNING: certificate verification disabled for outbound %s, the connection can be intercepted", proxyName)
+	} else {
+		log.Printf("Certificate verification enabled for outbound %s", proxyName)
+	}
+	return nil
+}
+
+// xrayTLSSettings returns the tlsSettings of the outbound tagged tag, which
+// must use TLS security.
+func xrayTLSSettings(config map[string]interface{}, tag string) (map[string]interface{}, error) {
+	for _, outbound := range xrayOutbounds(config) {
+		if t, _ := outbound["tag"].(string); t != tag {
+			continue
+		}
+		stream, _ := outbound["streamSettings"].(map[string]interface{})
+		if security, _ := stream["security"].(string); security != "tls" {
+			return nil, fmt.Errorf("outbound %s does not use TLS", tag)
+		}
+		return configSection(stream, "tlsSettings"), nil
+	}
+	return nil, fmt.Errorf("outbound not found: %s", tag)
+}
@@ -0,0 +1,138 @@
+package libunifiedcore
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/metacubex/mihomo/tunnel"
+	"github.com/xtls/xray-core/features/routing"
+)
+
+// warmStartRuleTag tags the Xray routing rule that sends all traffic to the
+// warmStartBlockTag blackhole until Resume.
+const (
+	warmStartRuleTag  = "warm-start-pause"
+	warmStartBlockTag = "warm-start-block"
+)
+
+// WarmStart starts the core like RunConfig but holds back all traffic, so
+// parsing and applying the config and loading geo data happen ahead of time
+// and Resume connects instantly. Connections that arrive before Resume are
+// closed. RunConfig starts without holding traffic back; restarts in
+// between keep it held back.
+//
+// Xray: a blackhole routing rule in front of all others, which Resume
+// removes from the running router. Mihomo: the tunnel is suspended once the
+// config is applied, as Mihomo does itself while applying a config.
+func (u *UnifiedCoreManager) WarmStart(configPath string) error {
+	u.mu.Lock()
+	u.setWarmStartLocked(true)
+	u.mu.Unlock()
+
+	if err := u.runConfig(configPath, nil); err != nil {
+		u.clearWarmStart()
+		return err
+	}
+	log.Println("Warm start complete, traffic held until Resume")
+	return nil
+}
+
+// Resume lets traffic through a core started with WarmStart.
+func (u *UnifiedCoreManager) Resume() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if !u.warmStart {
+		return fmt.Errorf("core was not warm started")
+	}
+	if !u.running {
+		return fmt.Errorf("no core running")
+	}
+	u.setWarmStartLocked(false)
+
+	switch u.coreType {
+	case CoreTypeV2Ray, CoreTypeXray:
+		if u.v2rayManager != nil {
+			if err := u.v2rayManager.removeRoutingRule(warmStartRuleTag); err != nil {
+				return fmt.Errorf("failed to resume traffic: %w", err)
+			}
+		}
+	case CoreTypeMihomo:
+		if u.mihomoManager != nil {
+			u.mihomoManager.setForwardingPaused(false)
+		}
+	}
+	log.Println("Traffic resumed after warm start")
+	return nil
+}
+
+// clearWarmStart drops a pending warm start before a regular start.
+func (u *UnifiedCoreManager) clearWarmStart() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.warmStart {
+		u.setWarmStartLocked(false)
+	}
+}
+
+// setWarmStartLocked records the warm start and sets the Xray patch; the
+// Mihomo manager picks the state up in startMihomoCore. Callers must hold
+// u.mu.
+func (u *UnifiedCoreManager) setWarmStartLocked(enabled bool) {
+	u.warmStart = enabled
+
+	// Re-added so it runs after the other patches and its rule ends up first
+	u.v2rayPatches.set("warm-start", nil)
+	if !enabled {
+		return
+	}
+	u.v2rayPatches.set("warm-start", func(config map[string]interface{}) error {
+		outbounds, _ := config["outbounds"].([]interface{})
+		config["outbounds"] = append(outbounds, map[string]interface{}{
+			"protocol": "blackhole",
+			"tag":      warmStartBlockTag,
+		})
+		routing := configSection(config, "routing")
+		rules, _ := routing["rules"].([]interface{})
+		routing["rules"] = append([]interface{}{map[string]interface{}{
+			"type":        "field",
+			"ruleTag":     warmStartRuleTag,
+			"network":     "tcp,udp",
+			"outboundTag": warmStartBlockTag,
+		}}, rules...)
+		return nil
+	})
+}
+
+// setForwardingPaused suspends or resumes the tunnel of the running core
+// and keeps it suspended across applies while paused.
+func (m *MihomoCoreManager) setForwardingPaused(paused bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.forwardingPaused = paused
+	if !m.isRunning {
+		return
+	}
+	if paused {
+		tunnel.OnSuspend()
+	} else {
+		tunnel.OnRunning()
+	}
+}
+
+// removeRoutingRule removes the rules tagged tag from the running router.
+func (v *V2RayCoreManager) removeRoutingRule(tag string) error {
+	v.mu.RLock()
+	instance := v.instance
+	v.mu.RUnlock()
+	if instance == nil {
+		return fmt.Errorf("V2Ray core is not running")
+	}
+
+	router, ok := instance.GetFeature(routing.RouterType()).(routing.Router)
+	if !ok {
+		return fmt.Errorf("router not available")
+	}
+	return router.RemoveRule(tag)
+}
@@ -0,0 +1,60 @@
+package libunifiedcore
+
+import (
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// xrayFeatureMessages maps Xray protocols, transports and security engines
+// to the config message their package registers when it is linked in.
+var xrayFeatureMessages = map[string]string{
+	"reality":     "xray.transport.internet.reality.Config",
+	"tls":         "xray.transport.internet.tls.Config",
+	"grpc":        "xray.transport.internet.grpc.encoding.Config",
+	"ws":          "xray.transport.internet.websocket.Config",
+	"httpupgrade": "xray.transport.internet.httpupgrade.Config",
+	"xhttp":       "xray.transport.internet.splithttp.Config",
+	"kcp":         "xray.transport.internet.kcp.Config",
+	"vless":       "xray.proxy.vless.outbound.Config",
+	"vmess":       "xray.proxy.vmess.outbound.Config",
+	"trojan":      "xray.proxy.trojan.ClientConfig",
+	"shadowsocks": "xray.proxy.shadowsocks.ClientConfig",
+	"socks":       "xray.proxy.socks.ClientConfig",
+	"http":        "xray.proxy.http.ClientConfig",
+	"wireguard":   "xray.proxy.wireguard.DeviceConfig",
+	"freedom":     "xray.proxy.freedom.Config",
+}
+
+// HasReality reports whether the linked Xray build supports REALITY.
+func HasReality() bool {
+	return HasXrayFeature("reality")
+}
+
+// HasXrayFeature reports whether the linked Xray build includes a protocol,
+// transport or security engine, named as in Xray configs ("vless", "xhttp",
+// "reality", ...). Unknown names report false. A feature is present when its
+// package was compiled in, which is what a config needs to load.
+func HasXrayFeature(name string) bool {
+	message, known := xrayFeatureMessages[strings.ToLower(name)]
+	if !known {
+		return false
+	}
+	_, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(message))
+	return err == nil
+}
+
+// GetXrayFeatures lists the features HasXrayFeature reports as present,
+// sorted.
+func GetXrayFeatures() []string {
+	var features []string
+	for name := range xrayFeatureMessages {
+		if HasXrayFeature(name) {
+			features = append(features, name)
+		}
+	}
+	sort.Strings(features)
+	return features
+}
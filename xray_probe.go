@@ -0,0 +1,195 @@
+package libunifiedcore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	xnet "github.com/xtls/xray-core/common/net"
+	core "github.com/xtls/xray-core/core"
+	serial "github.com/xtls/xray-core/infra/conf/serial"
+)
+
+// defaultProbeURL is used when a probe is requested without a test URL.
+const defaultProbeURL = "https://www.gstatic.com/generate_204"
+
+// TestOutbound probes a single outbound of an Xray config. Only the outbound
+// tagged outboundTag (plus any outbounds it chains through) is loaded into an
+// ephemeral instance with no inbounds, so nothing listens on a port. Returns
+// the HTTP round-trip latency in milliseconds, or a recent one from the ping
+// cache, see SetPingCacheTTL.
+func TestOutbound(configBytes []byte, outboundTag string, testURL string, timeout time.Duration) (int, error) {
+	return TestOutboundContext(context.Background(), configBytes, outboundTag, testURL, timeout)
+}
+
+// TestOutboundContext is TestOutbound with a context. Cancelling ctx aborts
+// the probe request and closes the ephemeral instance.
+func TestOutboundContext(ctx context.Context, configBytes []byte, outboundTag string, testURL string, timeout time.Duration) (int, error) {
+	if timeout <= 0 {
+		return 0, fmt.Errorf("invalid timeout: %v", timeout)
+	}
+	if testURL == "" {
+		testURL = defaultProbeURL
+	}
+	cacheKey := pingCacheKeyBytes(configBytes, outboundTag, testURL)
+	if latency, cached := pingCache.latency(cacheKey); cached {
+		log.Printf("Outbound %s latency served from ping cache: %dms", outboundTag, latency)
+		return latency, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	probeConfig, err := buildOutboundProbeConfig(configBytes, outboundTag)
+	if err != nil {
+		return 0, err
+	}
+
+	config, err := serial.LoadJSONConfig(bytes.NewReader(probeConfig))
+	if err != nil {
+		return 0, fmt.Errorf("invalid outbound %q: %w", outboundTag, err)
+	}
+
+	instance, err := core.New(config)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create probe instance: %w", err)
+	}
+	if err := instance.Start(); err != nil {
+		instance.Close()
+		return 0, fmt.Errorf("failed to start probe instance: %w", err)
+	}
+	defer instance.Close()
+
+	latency, err := probeHTTP(ctx, xrayHTTPClient(instance, timeout), testURL)
+	if err != nil {
+		return 0, fmt.Errorf("outbound %q unreachable: %w", outboundTag, err)
+	}
+
+	log.Printf("Outbound %s reachable, latency %dms", outboundTag, latency)
+	pingCache.put(cacheKey, latency)
+	return latency, nil
+}
+
+// buildOutboundProbeConfig extracts the outbound tagged tag, and every
+// outbound it chains through, into a minimal config with that outbound first
+// so it becomes the default route.
+func buildOutboundProbeConfig(configBytes []byte, tag string) ([]byte, error) {
+	var config map[string]interface{}
+	if err := json.Unmarshal(configBytes, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config JSON: %w", err)
+	}
+	if coreConfig, ok := config["coreConfig"].(map[string]interface{}); ok {
+		config = coreConfig
+	}
+
+	byTag := make(map[string]map[string]interface{})
+	for _, outbound := range xrayOutbounds(config) {
+		if t, _ := outbound["tag"].(string); t != "" {
+			byTag[t] = outbound
+		}
+	}
+	if _, exists := byTag[tag]; !exists {
+		return nil, fmt.Errorf("outbound not found: %s", tag)
+	}
+
+	var outbounds []interface{}
+	included := make(map[string]bool)
+	pending := []string{tag}
+	for len(pending) > 0 {
+		t := pending[0]
+		pending = pending[1:]
+		if included[t] {
+			continue
+		}
+		outbound, exists := byTag[t]
+		if !exists {
+			return nil, fmt.Errorf("outbound %s chains through missing outbound %s", tag, t)
+		}
+		included[t] = true
+		outbounds = append(outbounds, outbound)
+		pending = append(pending, chainedOutboundTags(outbound)...)
+	}
+
+	probe := map[string]interface{}{
+		"log":       map[string]interface{}{"loglevel": "warning"},
+		"outbounds": outbounds,
+	}
+	if dns, exists := config["dns"]; exists {
+		probe["dns"] = dns
+	}
+	return json.Marshal(probe)
+}
+
+// chainedOutboundTags returns the tags an outbound dials through, via
+// proxySettings.tag or streamSettings.sockopt.dialerProxy.
+func chainedOutboundTags(outbound map[string]interface{}) []string {
+	var tags []string
+	if proxySettings, ok := outbound["proxySettings"].(map[string]interface{}); ok {
+		if t, _ := proxySettings["tag"].(string); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	if streamSettings, ok := outbound["streamSettings"].(map[string]interface{}); ok {
+		if sockopt, ok := streamSettings["sockopt"].(map[string]interface{}); ok {
+			if t, _ := sockopt["dialerProxy"].(string); t != "" {
+				tags = append(tags, t)
+			}
+		}
+	}
+	return tags
+}
+
+// xrayHTTPClient returns an HTTP client whose connections are dispatched
+// through the instance's routing, without going through an inbound.
+func xrayHTTPClient(instance *core.Instance, timeout time.Duration) *http.Client {
+	transport := &http.Transport{
+		DisableKeepAlives: true,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return xrayDial(ctx, instance, addr)
+		},
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}
+}
+
+// xrayDial opens a TCP connection to addr through the instance's routing.
+func xrayDial(ctx context.Context, instance *core.Instance, addr string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, err
+	}
+	xport, err := xnet.PortFromInt(uint32(port))
+	if err != nil {
+		return nil, err
+	}
+	return core.Dial(ctx, instance, xnet.TCPDestination(xnet.ParseAddress(host), xport))
+}
+
+// probeHTTP fetches testURL and returns the round-trip time in milliseconds.
+func probeHTTP(ctx context.Context, client *http.Client, testURL string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, testURL, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return 0, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return int(time.Since(start).Milliseconds()), nil
+}
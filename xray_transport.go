@@ -0,0 +1,102 @@
+package libunifiedcore
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// TransportInfo describes how the active Xray outbound reaches its server.
+type TransportInfo struct {
+	Tag         string   `json:"tag"`
+	Protocol    string   `json:"protocol"`
+	Security    string   `json:"security"`  // tls, reality or none
+	Transport   string   `json:"transport"` // tcp, ws, grpc, ...
+	ALPN        []string `json:"alpn"`
+	SNI         string   `json:"sni"`
+	Fingerprint string   `json:"fingerprint"`
+	Flow        string   `json:"flow"`
+}
+
+// GetActiveTransportInfo reports the protocol, security, transport and ALPN
+// of the outbound the running core sends traffic to by default. Xray does
+// not expose what a connection negotiated, so the values are those the
+// outbound was started with; where Xray fixes the ALPN for a transport (ws
+// and httpupgrade use http/1.1, grpc uses h2) that value is reported, and
+// an unset ALPN is reported as Xray's default, h2 then http/1.1.
+func (v *V2RayCoreManager) GetActiveTransportInfo() (*TransportInfo, error) {
+	tag := xrayDefaultOutboundTag(v)
+
+	v.mu.RLock()
+	running, outbounds := v.isRunning, v.lastOutbounds
+	v.mu.RUnlock()
+	if !running {
+		return nil, fmt.Errorf("V2Ray core is not running")
+	}
+	if len(outbounds) == 0 {
+		return nil, fmt.Errorf("no outbound configured")
+	}
+
+	// Without a handler yet, Xray routes to the first outbound by default
+	outbound := outbounds[0]
+	for _, o := range outbounds {
+		if t, _ := o["tag"].(string); t == tag {
+			outbound = o
+			break
+		}
+	}
+	return xrayTransportInfo(outbound), nil
+}
+
+func xrayTransportInfo(outbound map[string]interface{}) *TransportInfo {
+	stream, _ := outbound["streamSettings"].(map[string]interface{})
+	info := &TransportInfo{
+		Tag:       stringValue(outbound["tag"]),
+		Protocol:  stringValue(outbound["protocol"]),
+		Security:  firstNonEmpty(stringValue(stream["security"]), "none"),
+		Transport: firstNonEmpty(stringValue(stream["network"]), "tcp"),
+	}
+	if info.Transport == "raw" {
+		info.Transport = "tcp"
+	}
+
+	settings, _ := outbound["settings"].(map[string]interface{})
+	if vnext := configMaps(settings, "vnext"); len(vnext) > 0 {
+		if users := configMaps(vnext[0], "users"); len(users) > 0 {
+			info.Flow = stringValue(users[0]["flow"])
+		}
+	}
+
+	switch info.Security {
+	case "tls":
+		tls, _ := stream["tlsSettings"].(map[string]interface{})
+		info.SNI = stringValue(tls["serverName"])
+		info.Fingerprint = stringValue(tls["fingerprint"])
+		info.ALPN = stringList(tls["alpn"])
+	case "reality":
+		reality, _ := stream["realitySettings"].(map[string]interface{})
+		info.SNI = stringValue(reality["serverName"])
+		info.Fingerprint = stringValue(reality["fingerprint"])
+	}
+	if info.Security != "none" {
+		switch info.Transport {
+		case "ws", "httpupgrade":
+			info.ALPN = []string{"http/1.1"}
+		case "grpc":
+			info.ALPN = []string{"h2"}
+		default:
+			if len(info.ALPN) == 0 {
+				info.ALPN = []string{"h2", "http/1.1"}
+			}
+		}
+	}
+	return info
+}
+
+// xrayConfigOutbounds returns the outbounds of an Xray config.
+func xrayConfigOutbounds(configBytes []byte) []map[string]interface{} {
+	var config map[string]interface{}
+	if err := json.Unmarshal(configBytes, &config); err != nil {
+		return nil
+	}
+	return xrayOutbounds(config)
+}